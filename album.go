@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+)
+
+// albums buffers the messages of a media album, which Telegram delivers
+// as separate updates sharing a GroupedID, so the album is classified and
+// forwarded once. A group is released ALBUM_WAIT after its latest part
+// arrived.
+type albums struct {
+	wait  time.Duration
+	ready chan *tg.Message
+
+	mu     sync.Mutex
+	groups map[albumKey]*albumGroup
+}
+
+type albumKey struct {
+	chatID  int64
+	groupID int64
+}
+
+type albumGroup struct {
+	msgs  []*tg.Message
+	timer *time.Timer
+}
+
+func newAlbums(wait time.Duration) *albums {
+	return &albums{wait: wait, ready: make(chan *tg.Message), groups: map[albumKey]*albumGroup{}}
+}
+
+// Add buffers an album part; the merged album is later sent on ready.
+func (b *albums) Add(msg *tg.Message, groupID int64) {
+	k := albumKey{chatID: getChatID(msg.GetPeerID()), groupID: groupID}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	g, ok := b.groups[k]
+	if !ok {
+		g = &albumGroup{}
+		b.groups[k] = g
+		g.timer = time.AfterFunc(b.wait, func() { b.release(k) })
+	} else {
+		// Parts can arrive a little apart; wait for the last one.
+		g.timer.Reset(b.wait)
+	}
+	g.msgs = append(g.msgs, msg)
+}
+
+func (b *albums) release(k albumKey) {
+	b.mu.Lock()
+	g := b.groups[k]
+	delete(b.groups, k)
+	b.mu.Unlock()
+	if g != nil {
+		b.ready <- mergeAlbum(g.msgs)
+	}
+}
+
+// mergeAlbum combines album parts into one message: the first captioned
+// part (or the first part) with every distinct caption as its text.
+func mergeAlbum(msgs []*tg.Message) *tg.Message {
+	sort.Slice(msgs, func(i, j int) bool { return msgs[i].ID < msgs[j].ID })
+	rep := msgs[0]
+	var captions []string
+	seen := map[string]bool{}
+	for _, m := range msgs {
+		c := strings.TrimSpace(m.Message)
+		if c == "" || seen[c] {
+			continue
+		}
+		if len(captions) == 0 {
+			rep = m
+		}
+		seen[c] = true
+		captions = append(captions, c)
+	}
+	merged := *rep
+	if len(captions) > 1 {
+		merged.Message = strings.Join(captions, "\n\n")
+		// Entities refer to the single caption's offsets.
+		merged.Entities = nil
+	}
+	return &merged
+}
+
+// runAlbums dispatches merged albums until ctx is done.
+func (a *App) runAlbums(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg := <-a.albums.ready:
+			if err := a.dispatchMessage(ctx, msg); err != nil {
+				a.lg.Error("Handle album", zap.Int("msg_id", msg.ID), zap.Error(err))
+			}
+		}
+	}
+}
@@ -0,0 +1,993 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	pebbledb "github.com/cockroachdb/pebble"
+	"github.com/go-faster/errors"
+	boltstor "github.com/gotd/contrib/bbolt"
+	"github.com/gotd/contrib/middleware/floodwait"
+	"github.com/gotd/contrib/pebble"
+	"github.com/gotd/contrib/storage"
+	"github.com/gotd/td/examples"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/telegram/auth"
+	"github.com/gotd/td/telegram/dcs"
+	"github.com/gotd/td/telegram/message"
+	"github.com/gotd/td/telegram/query/dialogs"
+	"github.com/gotd/td/telegram/updates"
+	"github.com/gotd/td/tg"
+	"go.etcd.io/bbolt"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"golang.org/x/time/rate"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+type App struct {
+	cfg        Config
+	lg         *zap.Logger
+	sessionDir string
+
+	db     *pebbledb.DB
+	boltdb *bbolt.DB
+	peerDB storage.PeerStorage
+	leads  LeadStore
+	cache  *ClassifyCache
+	shadow *ShadowStats
+	// senders holds recent relevant verdicts per sender.
+	senders *senderVerdicts
+	spread  *senderSpread
+	// threads caches the channel posts discussion threads belong to.
+	threads threadRoots
+	// parents caches previews of replied-to messages.
+	parents replyPreviews
+	// topics caches forum topic titles.
+	topics topicTitles
+	// refreshing is set while /refresh runs.
+	refreshing atomic.Bool
+	// runCtx is the client's run context, for work a command starts in
+	// the background, past its handler's HANDLER_TIMEOUT.
+	runCtx context.Context
+	queue  *DeliveryQueue
+	// cooldown is the SENDER_COOLDOWN hook, kept across reloads for its
+	// per-sender state.
+	cooldown LeadHook
+	// liveCfg holds the campaigns, thresholds and hooks CONFIG_RELOAD
+	// may replace; see live.
+	liveCfg atomic.Pointer[liveConfig]
+
+	classifier ChatCompleter
+	// texts classifies message text; with CLASSIFIER=openai it goes
+	// through classifier.
+	texts Classifier
+	// breaker wraps classifier, nil when CB_FAILURE_THRESHOLD is zero.
+	// spend wraps breaker, nil without a daily cap. replayNow is
+	// signaled when held messages can be classified again.
+	breaker   *circuitBreaker
+	spend     *spendCap
+	replayNow chan struct{}
+	// fallback classifies text while the spend cap is reached, nil
+	// without REGEX_RULES_FILE.
+	fallback  Classifier
+	chatLimit *chatLimiter
+	// senderLookups limits on-demand lookups of unknown senders.
+	senderLookups *rate.Limiter
+
+	dispatcher tg.UpdateDispatcher
+	updates    *updates.Manager
+	waiter     *floodwait.Waiter
+	client     *telegram.Client
+	api        *tg.Client
+	sender     *message.Sender
+	mailer     *Mailer
+	// sheet is the SHEET_SINK, nil when disabled.
+	sheet *SheetSink
+
+	selfID atomic.Int64
+	// albums merges album parts before dispatch, nil when ALBUM_WAIT is
+	// zero.
+	albums *albums
+	// debounce holds leads for FORWARD_DEBOUNCE, nil when disabled.
+	debounce *debouncer
+	// watched is the resolved WATCH_SENDERS set, nil until resolved or
+	// when unset.
+	watched map[int64]bool
+	// authFailures counts consecutive OpenAI authentication failures.
+	authFailures atomic.Int32
+	// lastUpdate is the UnixNano time of the last update or successful
+	// keep-alive.
+	lastUpdate atomic.Int64
+
+	// recipients, dryRun and self are set once at startup, before
+	// updates are processed.
+	recipients map[string]tg.InputPeerClass
+	dryRun     bool
+	self       *tg.User
+
+	// pausedUntil is the UnixNano time /pause lasts until, pausedForever,
+	// or zero when forwarding is not paused.
+	pausedUntil atomic.Int64
+	// graceUntil is the UnixNano time STARTUP_GRACE lasts until.
+	graceUntil atomic.Int64
+	// flushNow wakes flushQueue, e.g. after /resume.
+	flushNow chan struct{}
+
+	replies pendingReplies
+
+	// early holds messages arriving during peer collection, nil unless
+	// EARLY_MESSAGES=buffer.
+	early *earlyBuffer
+
+	// work feeds the message workers, nil when every update is handled
+	// in its own handler.
+	work chan *tg.Message
+
+	// unreachable holds recipients that blocked the account or deleted
+	// the chat; they are skipped until restart.
+	unreachableMu sync.Mutex
+	unreachable   map[string]bool
+
+	stats Stats
+	// out receives status output: stdout, or stderr when stdout carries
+	// OUTPUT_NDJSON.
+	out io.Writer
+	// results is the OUTPUT_NDJSON stream, nil when disabled.
+	results *resultStream
+
+	// sampler is set in -sample mode, where nothing is classified.
+	sampler *sampler
+}
+
+func New(cfg Config) (*App, error) {
+	a := &App{
+		cfg:       cfg,
+		chatLimit: newChatLimiter(cfg.PerChatInterval),
+		senders:   newSenderVerdicts(cfg.SenderVerdictTTL),
+		spread:    newSenderSpread(cfg.SpamWindow),
+		flushNow:  make(chan struct{}, 1),
+
+		replayNow: make(chan struct{}, 1),
+
+		senderLookups: rate.NewLimiter(senderLookupRate, 5),
+		unreachable:   map[string]bool{},
+		replies:       pendingReplies{byAdmin: map[int64]pendingReply{}},
+	}
+	if cfg.Workers > 0 {
+		a.work = make(chan *tg.Message, cfg.QueueSize)
+	}
+
+	a.out = os.Stdout
+	if cfg.OutputNDJSON {
+		// stdout carries only NDJSON; status output moves to stderr.
+		a.results = newResultStream(os.Stdout)
+		a.out = os.Stderr
+	}
+
+	// ---- Session + logs ----
+	sessionDir := sessionPath(cfg.SessionDir, cfg.Phone)
+	if cfg.Test {
+		sessionDir += "-test" // never mix test and production sessions
+	}
+	if err := os.MkdirAll(sessionDir, 0o700); err != nil {
+		return nil, errors.Wrap(err, "mkdir session")
+	}
+	a.sessionDir = sessionDir
+	logFilePath := filepath.Join(sessionDir, "log.jsonl")
+
+	logWriter := zapcore.AddSync(&lumberjack.Logger{
+		Filename:   logFilePath,
+		MaxBackups: cfg.LogMaxBackups,
+		MaxSize:    cfg.LogMaxSizeMB,
+		MaxAge:     cfg.LogMaxAgeDays,
+		Compress:   cfg.LogCompress,
+	})
+	logCore := zapcore.NewCore(
+		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		logWriter,
+		zap.DebugLevel,
+	)
+	a.lg = zap.New(logCore)
+	a.classifier = newClassifier(cfg, a.lg, a.out)
+	if cfg.BreakerThreshold > 0 {
+		a.breaker = newCircuitBreaker(a.classifier, cfg.BreakerThreshold, cfg.BreakerCooldown, a.lg.Named("breaker"), a.out, func() {
+			select {
+			case a.replayNow <- struct{}{}:
+			default:
+			}
+		})
+		a.classifier = a.breaker
+	}
+	if cfg.ExamplesFile != "" {
+		a.lg.Info("Loaded few-shot examples", zap.String("file", cfg.ExamplesFile), zap.Int("count", cfg.Examples.Count()))
+		fmt.Fprintf(a.out, "Loaded %d few-shot examples from %s\n", cfg.Examples.Count(), cfg.ExamplesFile)
+	}
+
+	sessionStorage, err := newEncryptedSession(&telegram.FileSessionStorage{
+		Path: filepath.Join(sessionDir, "session.json"),
+	}, cfg.SessionKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// ---- Peer storage & updates state ----
+	db, err := pebbledb.Open(filepath.Join(sessionDir, "peers.pebble.db"), &pebbledb.Options{})
+	if err != nil {
+		return nil, errors.Wrap(err, "pebble open")
+	}
+	a.db = db
+	a.peerDB = pebble.NewPeerStorage(db)
+	a.leads = NewPebbleLeadStore(db)
+	a.cache = NewClassifyCache(db, textModel, cfg.ClassifyCacheTTL)
+	a.shadow = NewShadowStats(db)
+	a.queue = NewDeliveryQueue(db)
+	// The spend cap persists its daily usage, so the classifier chain is
+	// completed once the store is open.
+	if cfg.DailyTokenBudget > 0 || cfg.DailySpendCapUSD > 0 {
+		a.spend = newSpendCap(a.classifier, db, cfg, a.lg.Named("spend"), a.out)
+		a.classifier = a.spend
+		if cfg.Classifier == ClassifierOpenAI && cfg.RegexRulesFile != "" {
+			a.fallback = liveRegexRules{a}
+		}
+	}
+	switch cfg.Classifier {
+	case ClassifierRegex:
+		a.texts = liveRegexRules{a}
+		fmt.Fprintf(a.out, "Classifying with %d regex rule(s) from %s\n", cfg.RegexRules.Count(), cfg.RegexRulesFile)
+	default:
+		a.texts = OpenAIClassifier{client: a.classifier, model: textModel}
+		if cfg.ChunkLongMessages {
+			a.texts = ChunkingClassifier{next: a.texts, size: cfg.MaxInputChars}
+		}
+	}
+	if err := checkSchema(db, a.leads, a.out); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	if err := a.loadPause(); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	a.cooldown = cooldownHook(cfg.SenderCooldown)
+	a.liveCfg.Store(a.newLiveConfig(cfg))
+
+	boltdb, err := bbolt.Open(filepath.Join(sessionDir, "updates.bolt.db"), 0o666, nil)
+	if err != nil {
+		_ = db.Close()
+		return nil, errors.Wrap(err, "bolt open")
+	}
+	a.boltdb = boltdb
+
+	a.dispatcher = tg.NewUpdateDispatcher()
+	updateHandler := storage.UpdateHook(shortMessages{
+		next:   a.dispatcher,
+		selfID: &a.selfID,
+		handle: a.dispatchMessage,
+	}, a.peerDB)
+	a.updates = updates.New(updates.Config{
+		Handler: telegram.UpdateHandlerFunc(func(ctx context.Context, u tg.UpdatesClass) error {
+			a.touch()
+			return updateHandler.Handle(ctx, u)
+		}),
+		Logger:  a.lg.Named("updates.recovery"),
+		Storage: boltstor.NewStateStorage(boltdb),
+	})
+
+	// FLOOD_WAIT & rate limit middlewares
+	a.waiter = floodwait.NewWaiter().WithCallback(func(ctx context.Context, wait floodwait.FloodWait) {
+		a.stats.AddFloodWait(wait.Duration)
+		if d, ok := deliveryFromContext(ctx); ok {
+			a.lg.Warn("Flood wait delayed lead delivery",
+				zap.Duration("wait", wait.Duration),
+				zap.Uint64("lead_id", d.LeadID),
+				zap.String("recipient", d.Recipient),
+			)
+			fmt.Fprintf(a.out, "FLOOD_WAIT delayed lead #%d to %s, retry after: %s\n", d.LeadID, d.Recipient, wait.Duration)
+			return
+		}
+		a.lg.Warn("Flood wait", zap.Duration("wait", wait.Duration))
+		fmt.Fprintln(a.out, "FLOOD_WAIT, retry after:", wait.Duration)
+	})
+
+	opts := telegram.Options{
+		Logger:         a.lg,
+		Device:         cfg.Device,
+		SessionStorage: sessionStorage,
+		UpdateHandler:  a.updates,
+		Middlewares: []telegram.Middleware{
+			a.waiter,
+			a.throttle(rate.NewLimiter(rate.Every(cfg.RateInterval), cfg.RateBurst)),
+		},
+	}
+	if cfg.Test {
+		opts.DC = 2
+		opts.DCList = dcs.Test()
+	}
+	a.client = telegram.NewClient(cfg.AppID, cfg.AppHash, opts)
+	a.api = a.client.API()
+
+	// ---- Sender for admin ----
+	a.sender = message.NewSender(a.api)
+	if cfg.SMTP.Host != "" {
+		a.mailer = NewMailer(cfg.SMTP, a.db, a.lg.Named("mail"), a.out, a.mailSent)
+	}
+	if cfg.SheetSink != "" {
+		a.sheet = NewSheetSink(cfg.SheetSink, a.db, a.lg.Named("sheet"), a.out)
+	}
+
+	a.dispatcher.OnNewMessage(func(ctx context.Context, e tg.Entities, u *tg.UpdateNewMessage) error {
+		msg, ok := u.Message.(*tg.Message)
+		if !ok || msg == nil {
+			return nil
+		}
+		if groupID, ok := msg.GetGroupedID(); ok && a.albums != nil {
+			a.albums.Add(msg, groupID)
+			return nil
+		}
+		return a.dispatchMessage(ctx, msg)
+	})
+	if cfg.EarlyMessages == EarlyBuffer {
+		a.early = &earlyBuffer{}
+	}
+	if cfg.AlbumWait > 0 {
+		a.albums = newAlbums(cfg.AlbumWait)
+	}
+	if cfg.ForwardDebounce > 0 {
+		a.debounce = newDebouncer(cfg.ForwardDebounce)
+	}
+	if cfg.ForwardDebounce > 0 || cfg.LateEdits > 0 {
+		a.dispatcher.OnEditMessage(func(ctx context.Context, e tg.Entities, u *tg.UpdateEditMessage) error {
+			if msg, ok := u.Message.(*tg.Message); ok {
+				return a.handleEdit(ctx, msg)
+			}
+			return nil
+		})
+		a.dispatcher.OnEditChannelMessage(func(ctx context.Context, e tg.Entities, u *tg.UpdateEditChannelMessage) error {
+			if msg, ok := u.Message.(*tg.Message); ok {
+				return a.handleEdit(ctx, msg)
+			}
+			return nil
+		})
+	}
+
+	return a, nil
+}
+
+func (a *App) Close() error {
+	st := a.stats.Snapshot()
+	a.lg.Info("Session stats",
+		zap.Int64("messages", st.Messages),
+		zap.Int64("leads", st.Leads),
+		zap.Int64("forwarded", st.Forwarded),
+		zap.Int64("errors", st.Errors),
+		zap.Int64("flood_waits", st.FloodWaits),
+		zap.Duration("flood_wait_time", st.FloodWaitTime),
+		zap.Int64("throttles", st.Throttles),
+		zap.Duration("throttle_time", st.ThrottleTime),
+	)
+	_ = a.lg.Sync()
+	if err := a.boltdb.Close(); err != nil {
+		return errors.Wrap(err, "bolt close")
+	}
+	if err := a.db.Close(); err != nil {
+		return errors.Wrap(err, "pebble close")
+	}
+	return nil
+}
+
+// handleMessage processes one message within HANDLER_TIMEOUT; a message
+// that takes longer is abandoned so handlers can't pile up.
+func (a *App) handleMessage(ctx context.Context, msg *tg.Message) error {
+	if a.cfg.HandlerTimeout <= 0 {
+		return a.processMessage(ctx, msg)
+	}
+	ctx, cancel := context.WithTimeout(ctx, a.cfg.HandlerTimeout)
+	defer cancel()
+	err := a.processMessage(ctx, msg)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		a.stats.IncErrors()
+		a.lg.Warn("Message processing timed out",
+			zap.Int64("chat_id", getChatID(msg.GetPeerID())),
+			zap.Int("msg_id", msg.ID),
+			zap.Duration("timeout", a.cfg.HandlerTimeout),
+		)
+		fmt.Fprintf(a.out, "Abandoned message %d in chat %d after %s\n", msg.ID, getChatID(msg.GetPeerID()), a.cfg.HandlerTimeout)
+		return nil
+	}
+	return err
+}
+
+func (a *App) processMessage(ctx context.Context, msg *tg.Message) error {
+	if a.sampler == nil && a.isTriage(msg) {
+		return a.triage(ctx, msg)
+	}
+	// Our own summaries and command replies to recipients are never
+	// classified, even with PROCESS_OUTGOING. In Saved Messages the
+	// admin's commands are outgoing too, so they are still handled.
+	own := msg.Out && (!a.cfg.ProcessOutgoing || a.isRecipientChat(msg.PeerID))
+	if own && !a.isSavedMessages(msg.PeerID) {
+		return nil
+	}
+	if handled, err := a.handleCommand(ctx, msg); handled {
+		if err != nil {
+			a.lg.Error("Admin command", zap.String("text", msg.Message), zap.Error(err))
+		}
+		return nil
+	}
+	if own {
+		return nil
+	}
+	a.stats.IncMessages()
+	// Only the classifier sees the normalized text; leads keep the original.
+	text := a.extractText(msg)
+	clean := normalizeText(text, a.cfg.StripURLs)
+	passed := a.passesPrefilter(msg, clean)
+	if a.sampler != nil {
+		a.sampler.observe(clean, passed)
+		return nil
+	}
+	if !passed {
+		if a.cfg.IgnoreForwarded && isForwarded(msg) {
+			a.lg.Info("Skipped forwarded message",
+				zap.Int64("chat_id", getChatID(msg.GetPeerID())),
+				zap.Int("msg_id", msg.ID),
+			)
+		}
+		a.emitSkipped(msg, skippedFilter)
+		return nil
+	}
+
+	var image []byte
+	if a.cfg.Vision && utf8.RuneCountInString(clean) < visionCaptionMax {
+		img, err := a.downloadPhoto(ctx, msg)
+		if err != nil {
+			fmt.Fprintf(a.out, "vision: %v\n", err)
+		}
+		image = img
+	}
+	if clean == "" && image == nil {
+		a.emitSkipped(msg, skippedEmpty)
+		return nil
+	}
+
+	p, err := storage.FindPeer(ctx, a.peerDB, msg.GetPeerID())
+	if err != nil && !errors.Is(err, storage.ErrPeerNotFound) {
+		a.stats.IncErrors()
+		a.lg.Error("Find chat peer",
+			zap.Int64("chat_id", getChatID(msg.GetPeerID())),
+			zap.Int("msg_id", msg.ID),
+			zap.Error(err),
+		)
+		if a.cfg.SkipOnPeerError {
+			a.emitSkipped(msg, skippedPeerError)
+			return nil
+		}
+	}
+	if err != nil {
+		p = storage.Peer{
+			Version: storage.LatestVersion,
+			Key: dialogs.DialogKey{
+				ID:   getChatID(msg.GetPeerID()),
+				Kind: getPeerKind(msg.GetPeerID()),
+			},
+			CreatedAt: time.Now(),
+		}
+	}
+
+	topic := a.forumTopic(ctx, p, msg)
+	if topic != "" && !a.cfg.MonitorTopics.Allows(topic) {
+		a.lg.Debug("Skipped forum topic", zap.Int64("chat_id", p.Key.ID), zap.String("topic", topic))
+		a.emitSkipped(msg, skippedTopic)
+		return nil
+	}
+
+	fromID := int64(0)
+	if fu, ok := msg.FromID.(*tg.PeerUser); ok {
+		fromID = fu.UserID
+	}
+
+	// In groups the chat peer is not the author, so look the sender up
+	// separately; in private chats they are the same.
+	sender := p.User
+	if fromID != 0 && (sender == nil || sender.ID != fromID) {
+		sender = nil
+		sp, err := storage.FindPeer(ctx, a.peerDB, msg.FromID)
+		switch {
+		case err == nil:
+			sender = sp.User
+		case !errors.Is(err, storage.ErrPeerNotFound):
+			a.stats.IncErrors()
+			a.lg.Error("Find sender peer", zap.Int64("from_id", fromID), zap.Int("msg_id", msg.ID), zap.Error(err))
+			if a.cfg.SkipOnPeerError {
+				a.emitSkipped(msg, skippedPeerError)
+				return nil
+			}
+		}
+	}
+	if sender == nil && !msg.Out && !msg.Post {
+		// Peer collection may not have reached this sender yet.
+		uid := fromID
+		if pu, ok := msg.PeerID.(*tg.PeerUser); ok && uid == 0 {
+			uid = pu.UserID
+		}
+		if uid != 0 {
+			sender = a.lookupSender(ctx, p.AsInputPeer(), msg.ID, uid)
+		}
+	}
+	if msg.Out {
+		fromID, sender = a.self.ID, a.self
+	}
+	if fromID == 0 && sender != nil {
+		fromID = sender.ID
+	}
+
+	username := "unknown"
+	if sender != nil && sender.Username != "" {
+		username = "@" + sender.Username
+	}
+	fromKind := ""
+	if msg.Post {
+		// Channel posts have no user author; attribute them to the channel.
+		fromID, fromKind = p.Key.ID, fromChannel
+		username = channelName(p)
+	} else if id, name, ok := a.channelAuthor(ctx, msg); ok {
+		// Sent as a channel: a comment posted as the commenter's channel
+		// or the discussion group's copy of a post.
+		fromID, fromKind, username = id, fromChannel, name
+	}
+	var recentChats int
+	if !msg.Post {
+		recentChats = a.spread.Record(fromID, p.Key.ID)
+	}
+	score := scoreLead(sender, text)
+	input, truncated := a.classifierInput(clean)
+	if topic != "" && a.cfg.Classifier == ClassifierOpenAI {
+		// The topic is strong context in forums: "Вакансии" vs "Флуд".
+		input = "[Тема форума: " + topic + "]\n" + input
+	}
+
+	urgent := a.isUrgent(clean)
+	matched, err := a.matchCampaigns(ctx, fromID, input, image)
+	if errors.Is(err, errCircuitOpen) || errors.Is(err, errBudgetExhausted) {
+		a.holdMessage(msg)
+		a.emitSkipped(msg, skippedHeld)
+		return nil
+	}
+	if urgent && len(matched) == 0 {
+		// A negative verdict must not suppress an urgent keyword match.
+		matched = []campaignMatch{{Campaign: a.live().Campaigns[0]}}
+	}
+	if len(matched) > 0 {
+		if replaced, err := a.awaitEdits(ctx, msg); replaced {
+			return err
+		}
+	}
+	var surrounding []string
+	if a.cfg.ContextMessages > 0 && len(matched) > 0 {
+		surrounding, err = a.surroundingMessages(ctx, p.Key.ID, p.AsInputPeer(), msg.ID, a.cfg.ContextMessages)
+		if err != nil {
+			a.lg.Info("Context messages unavailable", zap.Int64("chat_id", p.Key.ID), zap.Error(err))
+		}
+	}
+
+	// Messages much older than now come from updates recovery after
+	// downtime rather than live traffic.
+	sentAt := time.Unix(int64(msg.Date), 0)
+	recovered := a.cfg.RecoveredAfter > 0 && time.Since(sentAt) > a.cfg.RecoveredAfter
+
+	chatID, msgID, link, replyTo := p.Key.ID, msg.ID, "", ""
+	if len(matched) > 0 {
+		chatID, msgID, link = a.leadOrigin(ctx, p, msg)
+		replyTo = a.replyTo(ctx, p, msg)
+	}
+
+	result := messageResult{
+		Time:     time.Now(),
+		ChatID:   p.Key.ID,
+		MsgID:    msg.ID,
+		FromID:   fromID,
+		Username: username,
+		Relevant: len(matched) > 0,
+	}
+	defer func() { a.results.Emit(result) }()
+
+	for _, c := range matched {
+		result.Campaigns = append(result.Campaigns, c.Name)
+		lead := Lead{
+			Campaign:      c.Name,
+			Confidence:    c.Confidence,
+			ShadowVerdict: c.Shadow,
+			ChatID:        chatID,
+			MsgID:         msgID,
+			FromID:        fromID,
+			FromKind:      fromKind,
+			Username:      username,
+			Text:          text,
+			FromImage:     image != nil,
+			Truncated:     truncated,
+			Score:         score,
+			Urgent:        urgent,
+			Context:       surrounding,
+			Link:          link,
+			Topic:         topic,
+			ReplyTo:       replyTo,
+			Contact:       contactLink(sender, fromID, msg.Post),
+			Budget:        parseBudget(text),
+			RecentChats:   recentChats,
+			SentAt:        sentAt,
+			Recovered:     recovered,
+			CreatedAt:     time.Now(),
+		}
+		lead.Weighted = a.live().ScoreFormula.Score(lead)
+		r := a.routeLead(ctx, c.Campaign, lead)
+		if r.Saved {
+			result.LeadIDs = append(result.LeadIDs, r.Lead.ID)
+		}
+		result.Forwarded = result.Forwarded || r.Forwarded
+	}
+	return nil
+}
+
+// routed is the outcome of routeLead. Held is the hook error that kept
+// the lead from being forwarded (or stored, for ErrDropLead), if any.
+type routed struct {
+	Lead      Lead
+	Saved     bool
+	Forwarded bool
+	Held      error
+}
+
+// routeLead runs the hooks on a matched lead, stores it and delivers it
+// to the campaign's recipients, queueing outside active hours.
+func (a *App) routeLead(ctx context.Context, c Campaign, lead Lead) routed {
+	lead, err := runHooks(ctx, a.live().hooks, lead)
+	r := routed{Lead: lead, Held: err}
+	switch {
+	case errors.Is(err, ErrDropLead):
+		return r
+	case errors.Is(err, ErrSkipLead):
+	case err != nil:
+		a.lg.Error("Lead hook", zap.Uint64("lead_id", lead.ID), zap.Error(err))
+	}
+	if saveErr := a.leads.Save(ctx, &lead); saveErr != nil {
+		a.stats.IncErrors()
+		a.lg.Error("Save lead", zap.Error(saveErr))
+	} else {
+		a.stats.IncLeads()
+		r.Saved = true
+	}
+	r.Lead = lead
+	if err != nil {
+		a.lg.Info("Lead not forwarded",
+			zap.Uint64("lead_id", lead.ID),
+			zap.String("campaign", c.Name),
+			zap.Strings("tags", lead.Tags),
+			zap.Int("score", lead.Score),
+			zap.Error(err),
+		)
+		return r
+	}
+	for _, rcpt := range a.leadRecipients(c, lead) {
+		if a.deliveredBefore(ctx, lead, rcpt) {
+			continue
+		}
+		if a.dryRun {
+			fmt.Fprintf(a.out, "Dry run, not forwarding to %s: %s\n", rcpt, formatSummary(lead, a.cfg.SummaryStyle, a.cfg.Location))
+			continue
+		}
+		if now := time.Now(); a.inGrace(now) || (!lead.Urgent && !a.canDeliver(now)) {
+			if err := a.queue.Push(queuedDelivery{LeadID: lead.ID, Recipient: rcpt}); err != nil {
+				a.lg.Error("Queue lead", zap.Uint64("lead_id", lead.ID), zap.Error(err))
+			}
+			continue
+		}
+		if err := a.forward(ctx, lead, rcpt); err == nil {
+			r.Forwarded = true
+		}
+	}
+	return r
+}
+
+// forward sends the lead summary to a recipient resolved at startup, or
+// queues it with the mailer for mailto: recipients (mailSent marks the
+// lead forwarded once the email is sent). Leads for a recipient that
+// became unreachable go to FALLBACK_RECIPIENT, if set.
+func (a *App) forward(ctx context.Context, lead Lead, recipient string) error {
+	if a.isUnreachable(recipient) {
+		return a.forwardFallback(ctx, lead, recipient)
+	}
+	if isEmailRecipient(recipient) {
+		if a.mailer == nil {
+			return errors.Errorf("no SMTP configured for %s", recipient)
+		}
+		err := a.mailer.Enqueue(mailJob{
+			to:      strings.TrimPrefix(recipient, mailtoPrefix),
+			subject: fmt.Sprintf("Lead #%d: %s", lead.ID, lead.Campaign),
+			body:    formatSummary(lead, a.cfg.SummaryStyle, a.cfg.Location),
+			leadID:  lead.ID,
+		})
+		if err != nil {
+			a.stats.IncErrors()
+			a.lg.Error("Queue email", zap.Uint64("lead_id", lead.ID), zap.String("recipient", recipient), zap.Error(err))
+			return err
+		}
+		return nil
+	}
+
+	peer, ok := a.recipients[recipient]
+	if !ok {
+		err := errors.Errorf("recipient %s is not resolved", recipient)
+		fmt.Fprintln(a.out, err)
+		return err
+	}
+	summary := formatSummary(lead, a.cfg.SummaryStyle, a.cfg.Location)
+	ctx = withDelivery(ctx, queuedDelivery{LeadID: lead.ID, Recipient: recipient})
+	if _, err := a.sender.To(peer).StyledText(ctx, styledSummary(lead, a.cfg.SummaryStyle, a.cfg.Location)...); err != nil {
+		if ctx.Err() != nil && errors.Is(err, context.Canceled) {
+			return a.deferOnShutdown(lead, recipient)
+		}
+		if isTerminalSendError(err) {
+			a.stats.IncErrors()
+			a.markUnreachable(recipient, err)
+			return a.forwardFallback(ctx, lead, recipient)
+		}
+		a.stats.IncErrors()
+		fmt.Fprintf(a.out, "send to %s: %v\n", recipient, err)
+		return err
+	}
+	a.stats.IncForwarded()
+	if err := a.leads.MarkForwarded(ctx, lead.ID, recipient); err != nil {
+		a.lg.Warn("Mark lead forwarded", zap.Uint64("lead_id", lead.ID), zap.Error(err))
+	}
+	a.lg.Info("Lead forwarded",
+		zap.Uint64("lead_id", lead.ID),
+		zap.String("campaign", lead.Campaign),
+		zap.String("recipient", recipient),
+		zap.Int64("chat_id", lead.ChatID),
+		zap.Int("msg_id", lead.MsgID),
+		zap.Bool("from_image", lead.FromImage),
+		zap.Int("score", lead.Score),
+	)
+	fmt.Fprintf(a.out, "Forwarded to %s: %s\n", recipient, summary)
+	a.sheet.Append(lead, recipient, summary)
+	return nil
+}
+
+// deliveredBefore reports, with DEDUP_SCOPE=per-recipient, whether the
+// lead's message was already handed to recipient for this campaign.
+func (a *App) deliveredBefore(ctx context.Context, lead Lead, recipient string) bool {
+	if a.cfg.DedupScope != DedupPerRecipient {
+		return false
+	}
+	seen, err := a.leads.Seen(ctx, lead.ChatID, lead.MsgID, lead.Campaign+"/"+recipient)
+	if err != nil {
+		a.lg.Error("Dedup lookup", zap.Uint64("lead_id", lead.ID), zap.Error(err))
+		return false
+	}
+	if seen {
+		a.lg.Info("Duplicate delivery skipped", zap.Uint64("lead_id", lead.ID), zap.String("recipient", recipient))
+	}
+	return seen
+}
+
+// campaignMatch is a campaign the message matched, with the model's
+// confidence in that verdict.
+type campaignMatch struct {
+	Campaign
+	Confidence float64
+	// Shadow is the shadow classifier's verdict, if one ran.
+	Shadow *bool
+}
+
+// matchCampaigns returns the campaigns the message is relevant to, in
+// configuration order. A non-nil image is classified with the vision model.
+// Text close to the sender's recent relevant message inherits its verdict
+// (SENDER_VERDICT_TTL). Once the daily spend cap is reached text goes to
+// the regex fallback, if configured. Other errors are logged per campaign;
+// only errCircuitOpen and errBudgetExhausted are returned, so the message
+// can be held for replay.
+func (a *App) matchCampaigns(ctx context.Context, fromID int64, text string, image []byte) ([]campaignMatch, error) {
+	live := a.live()
+	var matched []campaignMatch
+	for _, c := range live.Campaigns {
+		var (
+			v         verdict
+			err       error
+			inherited bool
+		)
+		if image != nil {
+			v, err = a.classifyRetry(ctx, func() (verdict, error) {
+				return classifyImage(ctx, a.classifier, a.cfg.VisionModel, c.Prompt, text, image)
+			})
+		} else if prev, hit := a.senders.Get(fromID, c.Name, text); hit {
+			v, inherited = prev, true
+			a.lg.Debug("Inherited sender verdict", zap.Int64("from_id", fromID), zap.String("campaign", c.Name))
+		} else if cached, hit := a.cache.Get(c, text); hit && a.cfg.Classifier == ClassifierOpenAI {
+			v = cached
+		} else {
+			v, err = a.classifyRetry(ctx, func() (verdict, error) {
+				return a.texts.Classify(ctx, c, text)
+			})
+			fellBack := false
+			if errors.Is(err, errBudgetExhausted) && a.fallback != nil {
+				v, err = a.fallback.Classify(ctx, c, text)
+				fellBack = true
+			}
+			if err == nil && a.cfg.Classifier == ClassifierOpenAI && !fellBack {
+				if err := a.cache.Put(c, text, v); err != nil {
+					a.lg.Warn("Cache verdict", zap.Error(err))
+				}
+			}
+		}
+		if errors.Is(err, errCircuitOpen) || errors.Is(err, errBudgetExhausted) {
+			return nil, err
+		}
+		a.trackClassifyAuth(ctx, err)
+		v.Relevant, err = a.ambiguousAs(c.Name, v.Relevant, err)
+		if err != nil {
+			a.stats.IncErrors()
+			a.lg.Error("Classify", zap.String("campaign", c.Name), zap.Error(err))
+			fmt.Fprintf(a.out, "OpenAI error (%s): %v\n", c.Name, err)
+			continue
+		}
+		var shadow *bool
+		if image == nil {
+			shadow = a.shadowVerdict(ctx, c, text, v.Relevant)
+		}
+		if !v.Relevant {
+			continue
+		}
+		if image == nil && !inherited {
+			a.senders.Put(fromID, c.Name, text, v)
+		}
+		matched = append(matched, campaignMatch{Campaign: c, Confidence: v.Confidence, Shadow: shadow})
+		if live.MatchFirst {
+			break
+		}
+	}
+	return matched, nil
+}
+
+// ambiguousAs replaces an ambiguous model answer with the configured
+// AMBIGUOUS_AS verdict, logging it so prompt drift is visible. Empty
+// answers are handled per EMPTY_RESPONSE.
+func (a *App) ambiguousAs(campaign string, ok bool, err error) (bool, error) {
+	if errors.Is(err, ErrClassifyEmpty) {
+		return a.emptyAs(campaign, err)
+	}
+	var amb *AmbiguousVerdictError
+	if !errors.As(err, &amb) {
+		return ok, err
+	}
+	a.lg.Warn("Ambiguous verdict",
+		zap.String("campaign", campaign),
+		zap.String("raw", amb.Raw),
+		zap.Bool("treated_as", a.cfg.AmbiguousAs),
+	)
+	return a.cfg.AmbiguousAs, nil
+}
+
+// ---- Run with auth & updates recovery ----
+func (a *App) Run(ctx context.Context) error {
+	flow := auth.NewFlow(examples.Terminal{PhoneNumber: a.cfg.Phone}, auth.SendCodeOptions{})
+	if a.cfg.Test {
+		fmt.Fprintln(a.out, "Using Telegram test servers; test numbers 99966XYYYY accept the code XXXXX (DC digit X repeated)")
+	}
+
+	// An existing session that is no longer authorized was revoked; don't
+	// fall into the interactive login under a supervisor.
+	_, statErr := os.Stat(filepath.Join(a.sessionDir, "session.json"))
+	hadSession := statErr == nil
+
+	err := a.waiter.Run(ctx, func(ctx context.Context) error {
+		return a.client.Run(ctx, func(ctx context.Context) error {
+			if hadSession {
+				status, err := a.client.Auth().Status(ctx)
+				if err != nil {
+					return errors.Wrap(err, "auth status")
+				}
+				if !status.Authorized {
+					return errSessionRevoked
+				}
+			}
+			if err := a.client.Auth().IfNecessary(ctx, flow); err != nil {
+				return errors.Wrap(err, "auth")
+			}
+
+			self, err := a.client.Self(ctx)
+			if err != nil {
+				return errors.Wrap(err, "self")
+			}
+			a.selfID.Store(self.ID)
+			a.self = self
+			a.runCtx = ctx
+			fmt.Fprintf(a.out, "Logged in as %s (id=%d, @%s)\n", self.FirstName, self.ID, self.Username)
+			if err := a.startupJitter(ctx); err != nil {
+				return err
+			}
+			a.startGrace(ctx)
+
+			recipients, err := resolveRecipients(ctx, a.api, a.cfg, a.out)
+			if err != nil {
+				if !a.cfg.AdminResolveDegraded {
+					return errors.Wrap(err, "resolve recipients")
+				}
+				a.lg.Error("Resolve recipients, starting in dry-run", zap.Error(err))
+				fmt.Fprintf(a.out, "%v: starting in dry-run, leads will be stored but not forwarded\n", err)
+				a.dryRun = true
+			}
+			a.recipients = recipients
+
+			if a.watched, err = resolveWatchedSenders(ctx, a.api, a.cfg, a.out); err != nil {
+				return errors.Wrap(err, "resolve WATCH_SENDERS")
+			}
+
+			if _, err := a.collectPeers(ctx); err != nil {
+				fmt.Fprintf(a.out, "collect peers: %v\n", err)
+			}
+			if a.work != nil {
+				a.runWorkers(ctx)
+			}
+			a.releaseEarly(ctx)
+
+			if a.mailer != nil {
+				go a.mailer.Run(ctx)
+			}
+			if a.sheet != nil {
+				go a.sheet.Run(ctx)
+			}
+			if a.cfg.ConfigReload > 0 && a.sampler == nil {
+				go a.watchConfig(ctx)
+			}
+			a.touch()
+			if a.cfg.KeepAliveInterval > 0 {
+				go a.keepAlive(ctx)
+			}
+			if !a.dryRun && a.sampler == nil {
+				go a.flushQueue(ctx)
+			}
+			if a.albums != nil {
+				go a.runAlbums(ctx)
+			}
+			go a.sweepExpired(ctx)
+			if (a.breaker != nil || a.spend != nil) && a.sampler == nil {
+				go a.replayHeld(ctx)
+			}
+			if a.spend != nil && a.sampler == nil {
+				go a.replayAtMidnight(ctx)
+			}
+
+			if a.cfg.StartupSelfTest && !a.dryRun && a.sampler == nil {
+				if err := a.selfTest(ctx); err != nil {
+					a.stats.IncErrors()
+					a.lg.Error("Self-test failed", zap.Error(err))
+					fmt.Fprintf(a.out, "SELF-TEST FAILED: %v\n", err)
+				}
+			}
+
+			if a.paused(time.Now()) {
+				fmt.Fprintln(a.out, "Forwarding is paused, send /resume to deliver queued leads")
+			}
+			fmt.Fprintln(a.out, "Listening for updates...")
+			return a.updates.Run(ctx, a.api, self.ID, updates.AuthOptions{
+				IsBot: self.Bot,
+				OnStart: func(ctx context.Context) {
+					fmt.Fprintln(a.out, "Update recovery started")
+				},
+			})
+		})
+	})
+	if isSessionRevoked(err) {
+		return a.sessionRevoked(err)
+	}
+	return err
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	pebbledb "github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/gotd/contrib/pebble"
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+// testConfig is a minimal configuration with one campaign delivering to
+// the admin.
+func testConfig() Config {
+	return Config{
+		AdminUsername: "admin",
+		Campaigns:     []Campaign{{Name: "development", Prompt: defaultPrompt, Recipients: []string{"admin"}}},
+		Classifier:    ClassifierOpenAI,
+		SummaryStyle:  StyleEmoji,
+		DedupScope:    DedupCampaign,
+		SpamWindow:    time.Hour,
+		Location:      time.UTC,
+	}
+}
+
+// newTestApp builds an App without Telegram: an in-memory pebble
+// database and lead store, texts classified by cls, and dry-run delivery
+// so nothing is sent. Status output is discarded.
+func newTestApp(tb testing.TB, cfg Config, cls Classifier) *App {
+	tb.Helper()
+	db, err := pebbledb.Open("", &pebbledb.Options{FS: vfs.NewMem()})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { _ = db.Close() })
+
+	a := &App{
+		cfg:       cfg,
+		lg:        zap.NewNop(),
+		out:       io.Discard,
+		db:        db,
+		peerDB:    pebble.NewPeerStorage(db),
+		leads:     NewMemoryLeadStore(),
+		cache:     NewClassifyCache(db, textModel, cfg.ClassifyCacheTTL),
+		shadow:    NewShadowStats(db),
+		queue:     NewDeliveryQueue(db),
+		chatLimit: newChatLimiter(cfg.PerChatInterval),
+		senders:   newSenderVerdicts(cfg.SenderVerdictTTL),
+		spread:    newSenderSpread(cfg.SpamWindow),
+		flushNow:  make(chan struct{}, 1),
+		replayNow: make(chan struct{}, 1),
+		texts:     cls,
+		// No API client: never look unknown senders up.
+		senderLookups: rate.NewLimiter(0, 0),
+		unreachable:   map[string]bool{},
+		replies:       pendingReplies{byAdmin: map[int64]pendingReply{}},
+		recipients:    map[string]tg.InputPeerClass{},
+		dryRun:        true,
+	}
+	a.cooldown = cooldownHook(cfg.SenderCooldown)
+	a.liveCfg.Store(a.newLiveConfig(cfg))
+	return a
+}
+
+// groupMessage is a message from a user in a supergroup.
+func groupMessage(chatID, fromID int64, id int, text string) *tg.Message {
+	return &tg.Message{
+		ID:      id,
+		PeerID:  &tg.PeerChannel{ChannelID: chatID},
+		FromID:  &tg.PeerUser{UserID: fromID},
+		Message: text,
+		Date:    int(time.Now().Unix()),
+	}
+}
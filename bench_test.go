@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"testing"
+	"time"
+)
+
+// benchText is a typical request-shaped message with some noise for the
+// normalizer.
+const benchText = "Всем привет!  Ищем Go-разработчика на проект 🚀\n" +
+	"Нужен бот для Telegram с интеграцией OpenAI, бюджет 150 000 ₽. " +
+	"Подробности в ЛС или https://example.com/job?id=42"
+
+func BenchmarkNormalizeText(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		normalizeText(benchText, true)
+	}
+}
+
+func BenchmarkPrefilter(b *testing.B) {
+	cfg := testConfig()
+	cfg.RequireRequestShape = true
+	langs, err := parseLanguages("ru,en")
+	if err != nil {
+		b.Fatal(err)
+	}
+	cfg.Languages = langs
+	a := newTestApp(b, cfg, RegexClassifier{})
+	msg := groupMessage(100, 200, 1, benchText)
+	clean := normalizeText(benchText, true)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		a.passesPrefilter(msg, clean)
+	}
+}
+
+// BenchmarkClassify compares the classifier backends on the same text:
+// regex rules, and the OpenAI path against a fake completer, so only the
+// request building and answer parsing are measured.
+func BenchmarkClassify(b *testing.B) {
+	c := Campaign{Name: "development", Prompt: defaultPrompt}
+	clean := normalizeText(benchText, true)
+	for _, bb := range []struct {
+		name string
+		cls  Classifier
+	}{
+		{name: "Regex", cls: RegexClassifier{all: regexRules{
+			include: []*regexp.Regexp{regexp.MustCompile(`(?i)ищ[уе]м|нуж[енна]`), regexp.MustCompile(`(?i)разработчик|бот`)},
+			exclude: []*regexp.Regexp{regexp.MustCompile(`(?i)резюме|ищу работу`)},
+		}}},
+		{name: "OpenAI", cls: OpenAIClassifier{client: &fakeCompleter{resp: answer("true")}, model: textModel}},
+		{name: "OpenAIChunked", cls: ChunkingClassifier{
+			next: OpenAIClassifier{client: &fakeCompleter{resp: answer("false")}, model: textModel},
+			size: 40,
+		}},
+	} {
+		b.Run(bb.name, func(b *testing.B) {
+			ctx := context.Background()
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := bb.cls.Classify(ctx, c, clean); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkClassifyCached measures matchCampaigns when every verdict
+// comes from the classification cache.
+func BenchmarkClassifyCached(b *testing.B) {
+	cfg := testConfig()
+	cfg.ClassifyCacheTTL = time.Hour
+	f := &fakeCompleter{resp: answer("true")}
+	a := newTestApp(b, cfg, OpenAIClassifier{client: f, model: textModel})
+	ctx := context.Background()
+	clean := normalizeText(benchText, true)
+	if _, err := a.matchCampaigns(ctx, 200, clean, nil); err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := a.matchCampaigns(ctx, 200, clean, nil); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.StopTimer()
+	if n := f.Calls(); n != 1 {
+		b.Fatalf("classifier called %d times, want 1", n)
+	}
+}
+
+// BenchmarkHandleMessage runs whole messages through the pipeline with
+// the in-memory store and a fake classifier: an irrelevant one, and a
+// lead that is stored and (dry-run) routed.
+func BenchmarkHandleMessage(b *testing.B) {
+	for _, bb := range []struct {
+		name   string
+		answer string
+	}{
+		{name: "Irrelevant", answer: "false"},
+		{name: "Lead", answer: "true"},
+	} {
+		b.Run(bb.name, func(b *testing.B) {
+			a := newTestApp(b, testConfig(), OpenAIClassifier{client: &fakeCompleter{resp: answer(bb.answer)}, model: textModel})
+			ctx := context.Background()
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if err := a.handleMessage(ctx, groupMessage(100, 200, i+1, benchText)); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+			if want := bb.answer == "true"; (a.stats.Snapshot().Leads > 0) != want {
+				b.Fatalf("leads = %d, want some: %v", a.stats.Snapshot().Leads, want)
+			}
+		})
+	}
+}
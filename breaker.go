@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	pebbledb "github.com/cockroachdb/pebble"
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/tg"
+	openai "github.com/sashabaranov/go-openai"
+	"go.uber.org/zap"
+)
+
+// errCircuitOpen is returned instead of calling OpenAI while the circuit
+// breaker is open.
+var errCircuitOpen = errors.New("openai circuit breaker open")
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// circuitBreaker fails completions fast after threshold consecutive
+// failures. Once cooldown has passed it lets a single trial request
+// through (half-open): success closes it again, failure reopens it.
+type circuitBreaker struct {
+	next      ChatCompleter
+	threshold int
+	cooldown  time.Duration
+	lg        *zap.Logger
+	out       io.Writer
+	// onClose is called when the circuit closes after being open.
+	onClose func()
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+	trial    bool // a half-open trial request is in flight
+}
+
+func newCircuitBreaker(next ChatCompleter, threshold int, cooldown time.Duration, lg *zap.Logger, out io.Writer, onClose func()) *circuitBreaker {
+	return &circuitBreaker{next: next, threshold: threshold, cooldown: cooldown, lg: lg, out: out, onClose: onClose}
+}
+
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case breakerOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state, b.trial = breakerHalfOpen, true
+		return true
+	case breakerHalfOpen:
+		if b.trial {
+			return false
+		}
+		b.trial = true
+		return true
+	default:
+		return true
+	}
+}
+
+func (b *circuitBreaker) record(err error) {
+	b.mu.Lock()
+	wasOpen := b.state != breakerClosed
+	b.trial = false
+	switch {
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		// Our own cancellation says nothing about OpenAI.
+		b.mu.Unlock()
+		return
+	case err == nil:
+		b.state, b.failures = breakerClosed, 0
+		b.mu.Unlock()
+		if wasOpen {
+			b.lg.Info("OpenAI circuit closed")
+			fmt.Fprintln(b.out, "OpenAI is back, circuit breaker closed")
+			if b.onClose != nil {
+				b.onClose()
+			}
+		}
+		return
+	}
+	b.failures++
+	opened := b.state == breakerHalfOpen || (b.state == breakerClosed && b.failures >= b.threshold)
+	if opened {
+		b.state, b.openedAt = breakerOpen, time.Now()
+	}
+	failures := b.failures
+	b.mu.Unlock()
+	if opened {
+		b.lg.Warn("OpenAI circuit opened", zap.Int("failures", failures), zap.Duration("cooldown", b.cooldown), zap.Error(err))
+		fmt.Fprintf(b.out, "OpenAI keeps failing (%v), circuit breaker open for %s; messages are stored for replay\n", err, b.cooldown)
+	}
+}
+
+func (b *circuitBreaker) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	if !b.allow() {
+		return openai.ChatCompletionResponse{}, errCircuitOpen
+	}
+	resp, err := b.next.CreateChatCompletion(ctx, req)
+	b.record(err)
+	return resp, err
+}
+
+// State returns the breaker state and the consecutive failure count.
+func (b *circuitBreaker) State() (breakerState, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == breakerOpen && time.Since(b.openedAt) >= b.cooldown {
+		return breakerHalfOpen, b.failures
+	}
+	return b.state, b.failures
+}
+
+var heldPrefix = []byte("held/")
+
+func heldKey(msg *tg.Message) []byte {
+	return []byte(fmt.Sprintf("%s%d/%d", heldPrefix, getChatID(msg.GetPeerID()), msg.ID))
+}
+
+// holdMessage stores a message that couldn't be classified while the
+// circuit was open or the daily spend cap reached, for replayHeld.
+func (a *App) holdMessage(msg *tg.Message) {
+	var buf bin.Buffer
+	if err := msg.Encode(&buf); err != nil {
+		a.lg.Error("Encode held message", zap.Int("msg_id", msg.ID), zap.Error(err))
+		return
+	}
+	if err := a.db.Set(heldKey(msg), buf.Buf, pebbledb.Sync); err != nil {
+		a.lg.Error("Hold message", zap.Int("msg_id", msg.ID), zap.Error(err))
+		return
+	}
+	a.lg.Info("Message held until OpenAI is available",
+		zap.Int64("chat_id", getChatID(msg.GetPeerID())),
+		zap.Int("msg_id", msg.ID),
+	)
+}
+
+// replayHeld processes held messages whenever the circuit closes or the
+// spend cap resets, and once at startup for messages held before a
+// restart.
+func (a *App) replayHeld(ctx context.Context) {
+	for {
+		a.replayHeldOnce(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-a.replayNow:
+		}
+	}
+}
+
+func (a *App) replayHeldOnce(ctx context.Context) {
+	iter, err := a.db.NewIter(&pebbledb.IterOptions{
+		LowerBound: heldPrefix,
+		UpperBound: []byte("held0"), // '0' follows '/'
+	})
+	if err != nil {
+		a.lg.Error("Held messages iter", zap.Error(err))
+		return
+	}
+	var held []*tg.Message
+	for iter.First(); iter.Valid(); iter.Next() {
+		var msg tg.Message
+		if err := msg.Decode(&bin.Buffer{Buf: append([]byte(nil), iter.Value()...)}); err != nil {
+			a.lg.Error("Decode held message", zap.ByteString("key", iter.Key()), zap.Error(err))
+			continue
+		}
+		held = append(held, &msg)
+	}
+	if err := iter.Close(); err != nil {
+		a.lg.Error("Held messages iter", zap.Error(err))
+	}
+	if len(held) == 0 {
+		return
+	}
+
+	fmt.Fprintf(a.out, "Replaying %d message(s) held while OpenAI was unavailable\n", len(held))
+	for _, msg := range held {
+		// Removed first: a message the breaker holds again is re-stored.
+		if err := a.db.Delete(heldKey(msg), pebbledb.Sync); err != nil {
+			a.lg.Error("Remove held message", zap.Int("msg_id", msg.ID), zap.Error(err))
+			continue
+		}
+		if err := a.dispatchMessage(ctx, msg); err != nil {
+			a.lg.Error("Replay held message", zap.Int("msg_id", msg.ID), zap.Error(err))
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+}
+
+// heldCount returns how many messages wait for replay.
+func (a *App) heldCount() int {
+	iter, err := a.db.NewIter(&pebbledb.IterOptions{
+		LowerBound: heldPrefix,
+		UpperBound: []byte("held0"),
+	})
+	if err != nil {
+		return 0
+	}
+	defer iter.Close()
+	n := 0
+	for iter.First(); iter.Valid(); iter.Next() {
+		n++
+	}
+	return n
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/go-faster/errors"
+)
+
+// Budget is a money amount mentioned in a lead. Currency is an ISO code,
+// empty when the text names none.
+type Budget struct {
+	Amount   float64 `json:"amount"`
+	Currency string  `json:"currency,omitempty"`
+}
+
+// String renders the amount with grouped thousands, e.g. "50 000 RUB".
+func (b Budget) String() string {
+	s := strconv.FormatFloat(b.Amount, 'f', -1, 64)
+	whole, frac, _ := strings.Cut(s, ".")
+	var g strings.Builder
+	for i, r := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			g.WriteByte(' ')
+		}
+		g.WriteRune(r)
+	}
+	if frac != "" {
+		g.WriteString("." + frac)
+	}
+	if b.Currency != "" {
+		g.WriteString(" " + b.Currency)
+	}
+	return g.String()
+}
+
+const budgetNum = `\d{1,3}(?:[ \x{00a0}.,]\d{3})+|\d+(?:[.,]\d+)?`
+
+// budgetRe matches an amount or a range ("30-50к") with an optional
+// currency sign before and multiplier or currency after.
+var budgetRe = regexp.MustCompile(`(?i)([$€₽])?\s*(` + budgetNum + `)(?:\s*(?:-|–|—|до)\s*[$€₽]?\s*(` + budgetNum + `))?\s*(k|к|тыс\.?|тысяч[аи]?|m|млн\.?)?\s*([$€₽]|руб\.?|рублей|рубля|р\.|usd|eur|евро|долл\.?|долларов|dollars?)?`)
+
+// budgetKeywords make a bare number count as an amount when one of them
+// shortly precedes it.
+var budgetKeywords = []string{"бюджет", "budget", "оплата", "гонорар", "стоимость", "цена", "плачу", "заплачу", "pay"}
+
+// parseBudget returns the largest amount mentioned in text, or nil. A
+// number counts when it has a currency or a thousands suffix ("30к"), or
+// follows a word like "бюджет"; "m" and "млн" only scale such a number,
+// since "10 m" alone is as likely metres. For a range the upper bound is
+// taken.
+func parseBudget(text string) *Budget {
+	var best *Budget
+	for _, m := range budgetRe.FindAllStringSubmatchIndex(text, -1) {
+		sub := func(i int) string {
+			if m[2*i] < 0 {
+				return ""
+			}
+			return text[m[2*i]:m[2*i+1]]
+		}
+		// A suffix or currency word glued to more letters ("50 kg",
+		// "2000 рублевых") is something else.
+		if r, _ := utf8.DecodeRuneInString(text[m[1]:]); unicode.IsLetter(r) && (sub(4) != "" || sub(5) != "") {
+			continue
+		}
+		amount, ok := parseAmount(sub(3))
+		if !ok {
+			if amount, ok = parseAmount(sub(2)); !ok {
+				continue
+			}
+		}
+		currency := currencyCode(sub(1))
+		if currency == "" {
+			currency = currencyCode(sub(5))
+		}
+		suffix := strings.ToLower(strings.TrimSuffix(sub(4), "."))
+		millions := suffix == "m" || suffix == "млн"
+		if currency == "" && (suffix == "" || millions) && !nearBudgetKeyword(text[:m[0]]) {
+			continue
+		}
+		switch {
+		case millions:
+			amount *= 1e6
+		case suffix != "":
+			amount *= 1e3
+		}
+		if best == nil || amount > best.Amount {
+			best = &Budget{Amount: amount, Currency: currency}
+		}
+	}
+	return best
+}
+
+// parseAmount reads "50 000", "1,500", "2.000.000" (thousands) or "1,5"
+// (decimal).
+func parseAmount(s string) (float64, bool) {
+	if s == "" {
+		return 0, false
+	}
+	s = strings.NewReplacer(" ", "", "\u00a0", "").Replace(s)
+	if parts := strings.FieldsFunc(s, func(r rune) bool { return r == '.' || r == ',' }); len(parts) > 1 {
+		grouped := true
+		for _, p := range parts[1:] {
+			grouped = grouped && len(p) == 3
+		}
+		if grouped {
+			s = strings.Join(parts, "")
+		} else {
+			s = parts[0] + "." + parts[1]
+		}
+	}
+	v, err := strconv.ParseFloat(s, 64)
+	return v, err == nil && v > 0
+}
+
+func currencyCode(s string) string {
+	s = strings.ToLower(s)
+	switch {
+	case s == "":
+		return ""
+	case s == "₽" || strings.HasPrefix(s, "руб") || s == "р.":
+		return "RUB"
+	case s == "$" || s == "usd" || strings.HasPrefix(s, "долл") || strings.HasPrefix(s, "dollar"):
+		return "USD"
+	case s == "€" || s == "eur" || s == "евро":
+		return "EUR"
+	}
+	return ""
+}
+
+// nearBudgetKeyword reports whether before ends with a budget keyword
+// and at most a few characters of punctuation or filler.
+func nearBudgetKeyword(before string) bool {
+	if len(before) > 40 {
+		before = before[len(before)-40:]
+	}
+	before = strings.ToLower(before)
+	for _, k := range budgetKeywords {
+		if i := strings.LastIndex(before, k); i >= 0 && utf8.RuneCountInString(before[i+len(k):]) <= 12 {
+			return true
+		}
+	}
+	return false
+}
+
+// MinBudget is the MIN_BUDGET threshold per currency; the "" entry
+// applies to amounts without a currency or in one not listed.
+type MinBudget map[string]float64
+
+// parseMinBudget reads a comma-separated list of amounts, each with an
+// optional currency, e.g. "50000" or "50000₽, 500$".
+func parseMinBudget(s string) (MinBudget, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	mb := MinBudget{}
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		b := parseBudget("бюджет " + f)
+		if b == nil {
+			return nil, errors.Errorf("MIN_BUDGET: %q is not an amount", f)
+		}
+		mb[b.Currency] = b.Amount
+	}
+	return mb, nil
+}
+
+func (m MinBudget) String() string {
+	var parts []string
+	for currency, v := range m {
+		parts = append(parts, Budget{Amount: v, Currency: currency}.String())
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ", ")
+}
+
+// For returns the threshold for a budget, and false when there is none.
+func (m MinBudget) For(b Budget) (float64, bool) {
+	if v, ok := m[b.Currency]; ok {
+		return v, true
+	}
+	v, ok := m[""]
+	return v, ok
+}
+
+// budgetHook stores leads whose budget is below MIN_BUDGET without
+// forwarding them. Leads that name no amount pass.
+func budgetHook(minBudget MinBudget) LeadHook {
+	return func(_ context.Context, l Lead) (Lead, error) {
+		if l.Urgent || l.Budget == nil {
+			return l, nil
+		}
+		if threshold, ok := minBudget.For(*l.Budget); ok && l.Budget.Amount < threshold {
+			l.Tags = append(l.Tags, "low-budget")
+			return l, ErrSkipLead
+		}
+		return l, nil
+	}
+}
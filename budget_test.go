@@ -0,0 +1,58 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseBudget(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		text string
+		want *Budget
+	}{
+		{name: "Keyword", text: "Бюджет 50000", want: &Budget{Amount: 50000}},
+		{name: "Dollar", text: "Нужен бот, $2000", want: &Budget{Amount: 2000, Currency: "USD"}},
+		{name: "Rouble", text: "нужен сайт за 50 000 ₽", want: &Budget{Amount: 50000, Currency: "RUB"}},
+		{name: "Range", text: "готов заплатить 30-50к", want: &Budget{Amount: 50000}},
+		{name: "DotThousands", text: "бот за 2.000.000 руб", want: &Budget{Amount: 2e6, Currency: "RUB"}},
+		{name: "CommaThousands", text: "оплата 1,500,000", want: &Budget{Amount: 1.5e6}},
+		{name: "SingleThousands", text: "1.500 $", want: &Budget{Amount: 1500, Currency: "USD"}},
+		{name: "Decimal", text: "1,5 млн руб", want: &Budget{Amount: 1.5e6, Currency: "RUB"}},
+		{name: "KiloSuffix", text: "сделаю за 30k", want: &Budget{Amount: 30000}},
+		{name: "MillionsWithCurrency", text: "2 m $", want: &Budget{Amount: 2e6, Currency: "USD"}},
+		{name: "MillionsAfterKeyword", text: "бюджет 2 млн", want: &Budget{Amount: 2e6}},
+		{name: "BareMillions", text: "забор 10 m"},
+		{name: "BareMillionsRussian", text: "10 млн просмотров"},
+		{name: "Largest", text: "бюджет 500$, может 800$", want: &Budget{Amount: 800, Currency: "USD"}},
+		{name: "SuffixGluedToWord", text: "мешок 50 kg"},
+		{name: "PlainNumber", text: "нужен бот на 3 языках"},
+		{name: "KelvinBeforeAmount", text: strings.Repeat("\u212a", 10) + " 5"},
+		{name: "KelvinBeforeKeyword", text: strings.Repeat("\u212a", 10) + " бюджет 5", want: &Budget{Amount: 5}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseBudget(tt.text)
+			switch {
+			case got == nil && tt.want == nil:
+			case got == nil || tt.want == nil || *got != *tt.want:
+				t.Errorf("parseBudget(%q) = %v, want %v", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMinBudget(t *testing.T) {
+	mb, err := parseMinBudget("50000₽, 500$, 1 млн")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mb["RUB"] != 50000 || mb["USD"] != 500 || mb[""] != 1e6 {
+		t.Errorf("parseMinBudget = %v", mb)
+	}
+	if v, ok := mb.For(Budget{Amount: 1, Currency: "EUR"}); !ok || v != 1e6 {
+		t.Errorf("For(EUR) = %v, %v; want the currency-less threshold", v, ok)
+	}
+	if _, err := parseMinBudget("много"); err == nil {
+		t.Error("parseMinBudget accepted a value without an amount")
+	}
+}
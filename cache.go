@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"time"
+
+	pebbledb "github.com/cockroachdb/pebble"
+	"github.com/go-faster/errors"
+	"go.uber.org/zap"
+)
+
+// ClassifyCache remembers verdicts for identical message text so replays
+// and copies of the same message are not paid for twice. Entries are keyed
+// by the model and campaign prompt as well, so editing a prompt (or
+// switching models) starts afresh instead of serving stale verdicts.
+type ClassifyCache struct {
+	db    *pebbledb.DB
+	model string
+	ttl   time.Duration
+}
+
+type cachedVerdict struct {
+	Relevant   bool      `json:"relevant"`
+	Confidence float64   `json:"confidence,omitempty"`
+	At         time.Time `json:"at"`
+}
+
+var cachePrefix = []byte("classify/")
+
+// cacheSweepInterval is how often expired entries are deleted.
+const cacheSweepInterval = time.Hour
+
+func NewClassifyCache(db *pebbledb.DB, model string, ttl time.Duration) *ClassifyCache {
+	return &ClassifyCache{db: db, model: model, ttl: ttl}
+}
+
+// normalizeForHash lowercases text and collapses whitespace so trivially
+// different copies share a cache entry.
+func normalizeForHash(text string) string {
+	return strings.Join(strings.Fields(strings.ToLower(text)), " ")
+}
+
+func (c *ClassifyCache) key(campaign Campaign, text string) []byte {
+	h := sha256.New()
+	for _, part := range []string{c.model, campaign.Prompt, normalizeForHash(text)} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return []byte(string(cachePrefix) + campaign.Name + "/" + hex.EncodeToString(h.Sum(nil)))
+}
+
+func (c *ClassifyCache) Get(campaign Campaign, text string) (verdict, bool) {
+	if c.ttl <= 0 {
+		return verdict{}, false
+	}
+	data, closer, err := c.db.Get(c.key(campaign, text))
+	if err != nil {
+		return verdict{}, false
+	}
+	defer closer.Close()
+
+	var v cachedVerdict
+	if err := json.Unmarshal(data, &v); err != nil {
+		return verdict{}, false
+	}
+	if time.Since(v.At) > c.ttl {
+		return verdict{}, false
+	}
+	if v.Confidence == 0 {
+		v.Confidence = 1 // cached before confidence was recorded
+	}
+	return verdict{Relevant: v.Relevant, Confidence: v.Confidence}, true
+}
+
+func (c *ClassifyCache) Put(campaign Campaign, text string, v verdict) error {
+	if c.ttl <= 0 {
+		return nil
+	}
+	data, err := json.Marshal(cachedVerdict{Relevant: v.Relevant, Confidence: v.Confidence, At: time.Now()})
+	if err != nil {
+		return errors.Wrap(err, "marshal verdict")
+	}
+	if err := c.db.Set(c.key(campaign, text), data, pebbledb.NoSync); err != nil {
+		return errors.Wrap(err, "save verdict")
+	}
+	return nil
+}
+
+// Sweep deletes entries older than the TTL, along with any it cannot
+// read, and returns how many it deleted.
+func (c *ClassifyCache) Sweep(now time.Time) (int, error) {
+	iter, err := c.db.NewIter(&pebbledb.IterOptions{
+		LowerBound: cachePrefix,
+		UpperBound: []byte("classify0"), // '0' follows '/'
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "cache iter")
+	}
+	b := c.db.NewBatch()
+	defer b.Close()
+	n := 0
+	for iter.First(); iter.Valid(); iter.Next() {
+		var v cachedVerdict
+		if err := json.Unmarshal(iter.Value(), &v); err == nil && now.Sub(v.At) <= c.ttl {
+			continue
+		}
+		if err := b.Delete(iter.Key(), nil); err != nil {
+			_ = iter.Close()
+			return 0, errors.Wrap(err, "cache delete")
+		}
+		n++
+	}
+	if err := iter.Close(); err != nil {
+		return 0, errors.Wrap(err, "cache iter")
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	if err := b.Commit(pebbledb.NoSync); err != nil {
+		return 0, errors.Wrap(err, "cache sweep")
+	}
+	return n, nil
+}
+
+// sweepExpired deletes expired classification verdicts and the
+// SPAM_CONTENT_WINDOW records of texts not seen within the window every
+// cacheSweepInterval, so the database does not grow with every message
+// ever classified.
+func (a *App) sweepExpired(ctx context.Context) {
+	ticker := time.NewTicker(cacheSweepInterval)
+	defer ticker.Stop()
+	for {
+		if a.cfg.ClassifyCacheTTL > 0 {
+			if n, err := a.cache.Sweep(time.Now()); err != nil {
+				a.lg.Warn("Sweep classification cache", zap.Error(err))
+			} else if n > 0 {
+				a.lg.Info("Swept classification cache", zap.Int("deleted", n))
+			}
+		}
+		// With the window off (or shortened by a reload) this also drops
+		// the records kept for the old one.
+		if n, err := a.leads.PruneTexts(ctx, a.live().SpamContentWindow); err != nil {
+			a.lg.Warn("Prune seen texts", zap.Error(err))
+		} else if n > 0 {
+			a.lg.Info("Pruned seen texts", zap.Int("deleted", n))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
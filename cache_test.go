@@ -0,0 +1,87 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	pebbledb "github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/vfs"
+)
+
+func newTestCache(t *testing.T, model string) *ClassifyCache {
+	t.Helper()
+	db, err := pebbledb.Open("", &pebbledb.Options{FS: vfs.NewMem()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return NewClassifyCache(db, model, time.Hour)
+}
+
+func TestClassifyCacheKey(t *testing.T) {
+	c := newTestCache(t, textModel)
+	dev := Campaign{Name: "development", Prompt: defaultPrompt}
+	if err := c.Put(dev, "Нужен  бот", verdict{Relevant: true, Confidence: 0.9}); err != nil {
+		t.Fatal(err)
+	}
+	edited := dev
+	edited.Prompt += "\nЗаказы на дизайн не считаются."
+	other := dev
+	other.Name = "design"
+
+	for _, tt := range []struct {
+		name     string
+		cache    *ClassifyCache
+		campaign Campaign
+		text     string
+		hit      bool
+	}{
+		{name: "Same", cache: c, campaign: dev, text: "Нужен  бот", hit: true},
+		{name: "Normalized", cache: c, campaign: dev, text: "нужен бот", hit: true},
+		{name: "OtherText", cache: c, campaign: dev, text: "Нужен сайт"},
+		{name: "EditedPrompt", cache: c, campaign: edited, text: "Нужен  бот"},
+		{name: "OtherCampaign", cache: c, campaign: other, text: "Нужен  бот"},
+		{name: "OtherModel", cache: &ClassifyCache{db: c.db, model: "gpt-4o", ttl: c.ttl}, campaign: dev, text: "Нужен  бот"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			v, hit := tt.cache.Get(tt.campaign, tt.text)
+			if hit != tt.hit {
+				t.Fatalf("hit = %v, want %v", hit, tt.hit)
+			}
+			if hit && (!v.Relevant || v.Confidence != 0.9) {
+				t.Errorf("verdict = %+v", v)
+			}
+		})
+	}
+}
+
+func TestClassifyCacheSweep(t *testing.T) {
+	c := newTestCache(t, textModel)
+	dev := Campaign{Name: "development", Prompt: defaultPrompt}
+	for _, text := range []string{"первый", "второй", "третий"} {
+		if err := c.Put(dev, text, verdict{Relevant: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := c.db.Set([]byte("classify/development/garbled"), []byte("{"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.db.Set([]byte("lead/00000000000000000001"), []byte("{"), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := c.Sweep(time.Now()); err != nil || n != 1 {
+		t.Fatalf("Sweep = %d, %v; want only the unreadable entry", n, err)
+	}
+	if _, hit := c.Get(dev, "первый"); !hit {
+		t.Error("fresh entry swept")
+	}
+	if n, err := c.Sweep(time.Now().Add(2 * time.Hour)); err != nil || n != 3 {
+		t.Fatalf("Sweep after the TTL = %d, %v; want 3", n, err)
+	}
+	if _, closer, err := c.db.Get([]byte("lead/00000000000000000001")); err != nil {
+		t.Error("sweep deleted a key outside the cache")
+	} else {
+		closer.Close()
+	}
+}
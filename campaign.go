@@ -0,0 +1,83 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	"github.com/go-faster/errors"
+)
+
+// defaultInstruction is the built-in prompt without its examples, used
+// when EXAMPLES_FILE replaces them.
+const defaultInstruction = `Определи, указывает ли следующее сообщение на потребность в разработке Telegram-бота или сайта. Верни только "true" или "false".`
+
+const defaultPrompt = defaultInstruction + `
+Примеры релевантных:
+- "Ищу разработчика для создания Telegram-бота для группы"
+- "Нужен сайт для бизнеса, есть разработчики?"
+- "Кто может сделать бота для автоматизации в Telegram?"
+Нерелевантные:
+- "Привет, как дела?"
+- "Кто хочет встретиться за кофе?"`
+
+type Campaign struct {
+	Name   string
+	Prompt string
+	// PromptFile is where Prompt was read from, empty for the default.
+	PromptFile string
+	// Recipients are Telegram usernames or mailto: addresses.
+	Recipients []string
+}
+
+// parseCampaigns parses CAMPAIGNS entries of the form
+// "name:promptFile[:recipient,...]" separated by ";". An empty recipient
+// list falls back to the admin.
+func parseCampaigns(s, admin string) ([]Campaign, error) {
+	if strings.TrimSpace(s) == "" {
+		return []Campaign{{Name: "development", Prompt: defaultPrompt, Recipients: []string{admin}}}, nil
+	}
+
+	var out []Campaign
+	seen := map[string]bool{}
+	for _, entry := range strings.Split(s, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		parts := strings.SplitN(entry, ":", 3)
+		if len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+			return nil, errors.Errorf("campaign %q: expected name:promptFile[:recipient,...]", entry)
+		}
+		name := strings.TrimSpace(parts[0])
+		if seen[name] {
+			return nil, errors.Errorf("campaign %q: duplicate name", name)
+		}
+		seen[name] = true
+
+		file := strings.TrimSpace(parts[1])
+		prompt, err := os.ReadFile(file)
+		if err != nil {
+			return nil, errors.Wrapf(err, "campaign %q: read prompt", name)
+		}
+		c := Campaign{
+			Name:       name,
+			Prompt:     strings.TrimSpace(string(prompt)),
+			PromptFile: file,
+		}
+		if len(parts) == 3 {
+			for _, r := range strings.Split(parts[2], ",") {
+				if r = strings.TrimSpace(r); r != "" {
+					c.Recipients = append(c.Recipients, r)
+				}
+			}
+		}
+		if len(c.Recipients) == 0 {
+			c.Recipients = []string{admin}
+		}
+		out = append(out, c)
+	}
+	if len(out) == 0 {
+		return nil, errors.New("CAMPAIGNS has no entries")
+	}
+	return out, nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// chatLimiter spaces out per-chat read requests (e.g. history fetches),
+// so one busy chat can't use up the global budget or trip slow mode.
+// A zero interval disables it.
+type chatLimiter struct {
+	interval time.Duration
+
+	mu    sync.Mutex
+	chats map[int64]*rate.Limiter
+}
+
+func newChatLimiter(interval time.Duration) *chatLimiter {
+	return &chatLimiter{interval: interval, chats: map[int64]*rate.Limiter{}}
+}
+
+// Wait blocks until a read from chatID is allowed.
+func (l *chatLimiter) Wait(ctx context.Context, chatID int64) error {
+	if l.interval <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	lim, ok := l.chats[chatID]
+	if !ok {
+		lim = rate.NewLimiter(rate.Every(l.interval), 1)
+		l.chats[chatID] = lim
+	}
+	l.mu.Unlock()
+	return lim.Wait(ctx)
+}
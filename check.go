@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/go-faster/errors"
+)
+
+const checkSample = "Ищу разработчика для создания Telegram-бота для группы"
+
+// Check is a pre-flight for deployments: configuration has already been
+// validated by loadConfig, so it verifies OpenAI with a fixed sample per
+// campaign and, if a session already exists, that recipients resolve. It
+// never starts the auth flow or processes messages.
+func (a *App) Check(ctx context.Context) error {
+	var failed bool
+	report := func(ok bool, format string, args ...any) {
+		mark := "✔"
+		if !ok {
+			mark, failed = "✘", true
+		}
+		fmt.Fprintf(a.out, "%s %s\n", mark, fmt.Sprintf(format, args...))
+	}
+
+	report(true, "config: %d campaign(s)", len(a.cfg.Campaigns))
+
+	for _, c := range a.cfg.Campaigns {
+		v, err := a.texts.Classify(ctx, c, checkSample)
+		if err != nil {
+			report(false, "%s (%s): %v", a.cfg.Classifier, c.Name, err)
+		} else {
+			report(true, "%s (%s): sample classified as %v", a.cfg.Classifier, c.Name, v.Relevant)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(a.sessionDir, "session.json")); err != nil {
+		report(true, "telegram: no session yet, skipping recipient resolution")
+	} else if err := a.checkTelegram(ctx, report); err != nil {
+		report(false, "telegram: %v", err)
+	}
+
+	if failed {
+		return errors.New("check failed")
+	}
+	return nil
+}
+
+func (a *App) checkTelegram(ctx context.Context, report func(bool, string, ...any)) error {
+	return a.waiter.Run(ctx, func(ctx context.Context) error {
+		return a.client.Run(ctx, func(ctx context.Context) error {
+			status, err := a.client.Auth().Status(ctx)
+			if err != nil {
+				return errors.Wrap(err, "auth status")
+			}
+			if !status.Authorized {
+				report(false, "telegram: session is not authorized")
+				return nil
+			}
+			report(true, "telegram: authorized as @%s", status.User.Username)
+
+			for _, r := range a.cfg.recipients() {
+				if isEmailRecipient(r) {
+					continue
+				}
+				if _, err := resolveAdminPeer(ctx, a.api, r); err != nil {
+					report(false, "resolve %s: %v", r, a.cfg.withRecipientRole(err, r))
+				} else {
+					report(true, "resolve %s", r)
+				}
+			}
+			for _, name := range a.cfg.WatchSenderNames {
+				if _, err := resolveAdminPeer(ctx, a.api, name); err != nil {
+					report(false, "resolve WATCH_SENDERS %s: %v", name, err)
+				} else {
+					report(true, "resolve WATCH_SENDERS %s", name)
+				}
+			}
+			return nil
+		})
+	})
+}
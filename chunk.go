@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+)
+
+// chunkOverlap is the share of a chunk repeated at the start of the next,
+// so a sentence cut at a boundary is still seen whole once.
+const chunkOverlap = 0.1
+
+// splitChunks cuts text into chunks of at most size runes, each starting
+// with the last chunkOverlap of the previous one.
+func splitChunks(text string, size int) []string {
+	r := []rune(text)
+	if size <= 0 || len(r) <= size {
+		return []string{text}
+	}
+	step := size - int(float64(size)*chunkOverlap)
+	if step <= 0 {
+		step = size
+	}
+	var chunks []string
+	for start := 0; ; start += step {
+		end := min(start+size, len(r))
+		chunks = append(chunks, string(r[start:end]))
+		if end == len(r) {
+			return chunks
+		}
+	}
+}
+
+// classifierInput is the text classifiers get for normalized message
+// text: all of it with CHUNK_LONG_MESSAGES, truncated otherwise.
+func (a *App) classifierInput(clean string) (string, bool) {
+	if a.cfg.ChunkLongMessages && a.cfg.Classifier == ClassifierOpenAI {
+		return clean, false
+	}
+	return truncateInput(clean, a.cfg.MaxInputChars, a.cfg.InputTailChars)
+}
+
+// ChunkingClassifier classifies text longer than size in overlapping
+// chunks (CHUNK_LONG_MESSAGES) instead of truncating it. The text is
+// relevant if any chunk is, with the highest confidence among the chunks
+// that agree with the verdict. Each chunk is a separate request.
+type ChunkingClassifier struct {
+	next Classifier
+	size int
+}
+
+func (c ChunkingClassifier) Classify(ctx context.Context, camp Campaign, text string) (verdict, error) {
+	chunks := splitChunks(text, c.size)
+	if len(chunks) == 1 {
+		return c.next.Classify(ctx, camp, text)
+	}
+	var out verdict
+	for _, chunk := range chunks {
+		v, err := c.next.Classify(ctx, camp, chunk)
+		if err != nil {
+			return verdict{}, err
+		}
+		switch {
+		case v.Relevant && !out.Relevant:
+			out = v
+		case v.Relevant == out.Relevant && v.Confidence > out.Confidence:
+			out.Confidence = v.Confidence
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/go-faster/errors"
+)
+
+// Classifier decides whether message text is relevant to a campaign. The
+// message handler only depends on this interface; images and the shadow
+// comparison still go to OpenAI directly.
+type Classifier interface {
+	Classify(ctx context.Context, c Campaign, text string) (verdict, error)
+}
+
+// ClassifierBackend selects the Classifier implementation.
+type ClassifierBackend string
+
+const (
+	// ClassifierOpenAI asks the chat model with the campaign prompt.
+	ClassifierOpenAI ClassifierBackend = "openai"
+	// ClassifierRegex matches the patterns from REGEX_RULES_FILE, without
+	// any API calls.
+	ClassifierRegex ClassifierBackend = "regex"
+)
+
+func parseClassifierBackend(s string) (ClassifierBackend, error) {
+	switch b := ClassifierBackend(s); b {
+	case "":
+		return ClassifierOpenAI, nil
+	case ClassifierOpenAI, ClassifierRegex:
+		return b, nil
+	default:
+		return "", errors.Errorf("CLASSIFIER must be openai or regex, got %q", s)
+	}
+}
+
+// OpenAIClassifier classifies with a chat model and the campaign prompt.
+type OpenAIClassifier struct {
+	client ChatCompleter
+	model  string
+}
+
+func (o OpenAIClassifier) Classify(ctx context.Context, c Campaign, text string) (verdict, error) {
+	return classifyTextWith(ctx, o.client, o.model, c.Prompt, text)
+}
+
+// RegexClassifier marks text relevant when it matches an include pattern
+// and no exclude pattern of the campaign (or of every campaign). Its
+// verdicts have confidence 1.
+type RegexClassifier struct {
+	// all apply to every campaign, byCampaign only to the named one.
+	all        regexRules
+	byCampaign map[string]regexRules
+}
+
+type regexRules struct {
+	include, exclude []*regexp.Regexp
+}
+
+func (r RegexClassifier) Classify(_ context.Context, c Campaign, text string) (verdict, error) {
+	own := r.byCampaign[c.Name]
+	match := func(res []*regexp.Regexp) bool {
+		for _, re := range res {
+			if re.MatchString(text) {
+				return true
+			}
+		}
+		return false
+	}
+	relevant := (match(r.all.include) || match(own.include)) &&
+		!match(r.all.exclude) && !match(own.exclude)
+	return verdict{Relevant: relevant, Confidence: 1}, nil
+}
+
+// Count returns the number of patterns loaded.
+func (r RegexClassifier) Count() int {
+	n := len(r.all.include) + len(r.all.exclude)
+	for _, s := range r.byCampaign {
+		n += len(s.include) + len(s.exclude)
+	}
+	return n
+}
+
+// loadRegexRules reads a rules file: one regular expression per line,
+// matched case-insensitively; a leading "!" makes it an exclude pattern.
+// "[name]" starts a section for one campaign, and lines before any
+// section apply to all. Blank lines and lines starting with "#" are
+// ignored.
+func loadRegexRules(path string, campaigns []Campaign) (RegexClassifier, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return RegexClassifier{}, errors.Wrap(err, "REGEX_RULES_FILE")
+	}
+	defer f.Close()
+
+	known := map[string]bool{}
+	for _, c := range campaigns {
+		known[c.Name] = true
+	}
+	r := RegexClassifier{byCampaign: map[string]regexRules{}}
+	section := ""
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if name, ok := strings.CutPrefix(line, "["); ok && strings.HasSuffix(name, "]") {
+			section = strings.TrimSpace(strings.TrimSuffix(name, "]"))
+			if !known[section] {
+				return r, errors.Errorf("REGEX_RULES_FILE line %d: unknown campaign %q", n, section)
+			}
+			continue
+		}
+		pattern, exclude := strings.CutPrefix(line, "!")
+		re, err := regexp.Compile("(?i)" + strings.TrimSpace(pattern))
+		if err != nil {
+			return r, errors.Wrapf(err, "REGEX_RULES_FILE line %d", n)
+		}
+		s := r.all
+		if section != "" {
+			s = r.byCampaign[section]
+		}
+		if exclude {
+			s.exclude = append(s.exclude, re)
+		} else {
+			s.include = append(s.include, re)
+		}
+		if section != "" {
+			r.byCampaign[section] = s
+		} else {
+			r.all = s
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return r, errors.Wrap(err, "REGEX_RULES_FILE")
+	}
+	if len(r.all.include) == 0 {
+		for _, c := range campaigns {
+			if len(r.byCampaign[c.Name].include) == 0 {
+				return r, errors.Errorf("REGEX_RULES_FILE has no include pattern for campaign %q", c.Name)
+			}
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"unicode"
+
+	"github.com/go-faster/errors"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+type ChatCompleter interface {
+	CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error)
+}
+
+// verdict is a classification result. Confidence is the model's
+// probability for its answer token, or 1 when it isn't reported.
+type verdict struct {
+	Relevant   bool
+	Confidence float64
+}
+
+// Classification failures are reported as a *ClassifyError matching one
+// of these kinds with errors.Is; other failures (network, context) are
+// returned as they are.
+var (
+	ErrClassifyRateLimited = errors.New("classify: rate limited")
+	ErrClassifyAuth        = errors.New("classify: authentication failed")
+	ErrClassifyParse       = errors.New("classify: unparseable answer")
+	ErrClassifyEmpty       = errors.New("classify: empty response")
+)
+
+// ClassifyError is a classification failure of a known kind. It unwraps
+// to the underlying error, e.g. an *openai.APIError or
+// *AmbiguousVerdictError.
+type ClassifyError struct {
+	Kind error
+	Err  error
+}
+
+func (e *ClassifyError) Error() string { return fmt.Sprintf("%v: %v", e.Kind, e.Err) }
+func (e *ClassifyError) Unwrap() error { return e.Err }
+func (e *ClassifyError) Is(target error) bool {
+	return target == e.Kind
+}
+
+// classifyErr tags an OpenAI error with its kind, if it has one.
+func classifyErr(err error) error {
+	var kind error
+	switch {
+	case err == nil:
+		return nil
+	case isRateLimited(err):
+		kind = ErrClassifyRateLimited
+	case httpStatus(err) == http.StatusUnauthorized || httpStatus(err) == http.StatusForbidden:
+		kind = ErrClassifyAuth
+	default:
+		return err
+	}
+	return &ClassifyError{Kind: kind, Err: err}
+}
+
+// AmbiguousVerdictError is returned when the model answers with something
+// that is neither a yes nor a no.
+type AmbiguousVerdictError struct {
+	Raw string
+}
+
+func (e *AmbiguousVerdictError) Error() string {
+	return fmt.Sprintf("ambiguous verdict %q", e.Raw)
+}
+
+var (
+	affirmatives = map[string]bool{"true": true, "yes": true, "да": true, "1": true, "relevant": true}
+	negatives    = map[string]bool{"false": true, "no": true, "нет": true, "0": true, "irrelevant": true}
+)
+
+// parseVerdict tolerates formatting drift such as "True.", " да" or
+// "false — unrelated" by looking at the first word only.
+func parseVerdict(content string) (bool, error) {
+	word := strings.ToLower(strings.TrimSpace(content))
+	if i := strings.IndexFunc(word, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }); i >= 0 {
+		word = word[:i]
+	}
+	switch {
+	case affirmatives[word]:
+		return true, nil
+	case negatives[word]:
+		return false, nil
+	default:
+		return false, &AmbiguousVerdictError{Raw: content}
+	}
+}
+
+// truncateInput keeps at most max runes of text: the beginning, plus the
+// last tail runes when tail > 0, joined by an ellipsis.
+func truncateInput(text string, max, tail int) (string, bool) {
+	if max <= 0 {
+		return text, false
+	}
+	r := []rune(text)
+	if len(r) <= max {
+		return text, false
+	}
+	if tail <= 0 || tail >= max {
+		return string(r[:max]), true
+	}
+	return string(r[:max-tail]) + "…" + string(r[len(r)-tail:]), true
+}
+
+// textModel classifies message text.
+const textModel = "gpt-4o-mini"
+
+func classifyTextWith(ctx context.Context, client ChatCompleter, model, prompt, text string) (verdict, error) {
+	resp, err := client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model: model,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: fmt.Sprintf("%s\n\nСообщение: %s", prompt, text)},
+		},
+		MaxTokens:   5,
+		Temperature: 0,
+		LogProbs:    true,
+	})
+	if err != nil {
+		return verdict{}, classifyErr(err)
+	}
+	return verdictFrom(resp)
+}
+
+func classifyImage(ctx context.Context, client ChatCompleter, model, prompt, caption string, image []byte) (verdict, error) {
+	var parts []openai.ChatMessagePart
+	if caption != "" {
+		parts = append(parts, openai.ChatMessagePart{Type: openai.ChatMessagePartTypeText, Text: caption})
+	}
+	parts = append(parts, openai.ChatMessagePart{
+		Type: openai.ChatMessagePartTypeImageURL,
+		ImageURL: &openai.ChatMessageImageURL{
+			URL:    "data:image/jpeg;base64," + base64.StdEncoding.EncodeToString(image),
+			Detail: openai.ImageURLDetailLow,
+		},
+	})
+
+	resp, err := client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model: model,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: prompt + "\n\nСообщение прикреплено в виде изображения."},
+			{Role: openai.ChatMessageRoleUser, MultiContent: parts},
+		},
+		MaxTokens:   5,
+		Temperature: 0,
+		LogProbs:    true,
+	})
+	if err != nil {
+		return verdict{}, classifyErr(err)
+	}
+	return verdictFrom(resp)
+}
+
+// verdictFrom parses the answer and takes the confidence from the
+// probability of its first token.
+func verdictFrom(resp openai.ChatCompletionResponse) (verdict, error) {
+	if len(resp.Choices) == 0 {
+		return verdict{}, &ClassifyError{Kind: ErrClassifyEmpty, Err: errors.New("openai: no choices")}
+	}
+	choice := resp.Choices[0]
+	if strings.TrimSpace(choice.Message.Content) == "" {
+		return verdict{}, &ClassifyError{Kind: ErrClassifyEmpty, Err: errors.Errorf("openai: empty answer (finish reason %q)", choice.FinishReason)}
+	}
+	v := verdict{Confidence: 1}
+	if choice.LogProbs != nil && len(choice.LogProbs.Content) > 0 {
+		v.Confidence = math.Exp(choice.LogProbs.Content[0].LogProb)
+	}
+	var err error
+	if v.Relevant, err = parseVerdict(choice.Message.Content); err != nil {
+		return v, &ClassifyError{Kind: ErrClassifyParse, Err: err}
+	}
+	return v, nil
+}
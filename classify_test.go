@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/go-faster/errors"
+	"github.com/sashabaranov/go-openai"
+)
+
+// fakeCompleter is a ChatCompleter that returns a canned response or
+// error, counting calls and keeping the last request. It is safe for
+// concurrent use.
+type fakeCompleter struct {
+	resp openai.ChatCompletionResponse
+	err  error
+
+	mu    sync.Mutex
+	calls int
+	last  openai.ChatCompletionRequest
+}
+
+func (f *fakeCompleter) CreateChatCompletion(_ context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	f.last = req
+	return f.resp, f.err
+}
+
+func (f *fakeCompleter) Calls() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+// answer is a completion with a single choice.
+func answer(content string) openai.ChatCompletionResponse {
+	return openai.ChatCompletionResponse{Choices: []openai.ChatCompletionChoice{
+		{Message: openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: content}},
+	}}
+}
+
+func TestClassifyTextWith(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		resp     openai.ChatCompletionResponse
+		err      error
+		relevant bool
+		wantErr  error
+	}{
+		{name: "Positive", resp: answer("true"), relevant: true},
+		{name: "PositiveRussian", resp: answer("Да."), relevant: true},
+		{name: "Negative", resp: answer("false")},
+		{name: "NegativeRussian", resp: answer("нет")},
+		{name: "EmptyChoices", resp: openai.ChatCompletionResponse{}, wantErr: ErrClassifyEmpty},
+		{name: "EmptyAnswer", resp: answer("  "), wantErr: ErrClassifyEmpty},
+		{name: "Ambiguous", resp: answer("maybe"), wantErr: ErrClassifyParse},
+		{
+			name:    "RateLimited",
+			err:     &openai.APIError{HTTPStatusCode: http.StatusTooManyRequests, Message: "slow down"},
+			wantErr: ErrClassifyRateLimited,
+		},
+		{
+			name:    "Unauthorized",
+			err:     &openai.APIError{HTTPStatusCode: http.StatusUnauthorized, Message: "bad key"},
+			wantErr: ErrClassifyAuth,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			f := &fakeCompleter{resp: tt.resp, err: tt.err}
+			v, err := classifyTextWith(context.Background(), f, textModel, "prompt", "нужен сайт на Go")
+			if n := f.Calls(); n != 1 {
+				t.Fatalf("got %d requests, want 1", n)
+			}
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if v.Relevant != tt.relevant {
+				t.Errorf("Relevant = %v, want %v", v.Relevant, tt.relevant)
+			}
+			if v.Confidence != 1 {
+				t.Errorf("Confidence = %v, want 1 without logprobs", v.Confidence)
+			}
+		})
+	}
+}
+
+func TestClassifyTextWithTransportError(t *testing.T) {
+	want := errors.New("connection reset")
+	_, err := classifyTextWith(context.Background(), &fakeCompleter{err: want}, textModel, "prompt", "text")
+	if !errors.Is(err, want) {
+		t.Fatalf("err = %v, want %v", err, want)
+	}
+	var ce *ClassifyError
+	if errors.As(err, &ce) {
+		t.Errorf("untyped error was tagged as %v", ce.Kind)
+	}
+}
+
+func TestClassifyTextWithRequest(t *testing.T) {
+	f := &fakeCompleter{resp: answer("true")}
+	if _, err := classifyTextWith(context.Background(), f, "model-x", "Ищем разработчиков", "нужен бот"); err != nil {
+		t.Fatal(err)
+	}
+	req := f.last
+	if req.Model != "model-x" {
+		t.Errorf("Model = %q, want model-x", req.Model)
+	}
+	if len(req.Messages) != 1 || req.Messages[0].Content != "Ищем разработчиков\n\nСообщение: нужен бот" {
+		t.Errorf("Messages = %+v", req.Messages)
+	}
+}
+
+// TestEmptyResponseCounted checks that a message whose answer stays empty
+// is counted once in /stats, also when its retry is cut short.
+func TestEmptyResponseCounted(t *testing.T) {
+	for _, mode := range []EmptyResponse{EmptySkip, EmptyRetry} {
+		t.Run(string(mode), func(t *testing.T) {
+			cfg := testConfig()
+			cfg.EmptyResponse = mode
+			f := &fakeCompleter{resp: answer("")}
+			a := newTestApp(t, cfg, OpenAIClassifier{client: f, model: textModel})
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel() // ends the retry pause at once
+
+			matched, err := a.matchCampaigns(ctx, 200, "нужен бот", nil)
+			if err != nil || len(matched) != 0 {
+				t.Fatalf("matchCampaigns = %v, %v; want no match", matched, err)
+			}
+			if n := a.stats.Snapshot().EmptyResponses; n != 1 {
+				t.Errorf("EmptyResponses = %d, want 1", n)
+			}
+		})
+	}
+}
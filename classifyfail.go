@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-faster/errors"
+	"go.uber.org/zap"
+)
+
+// rateLimitRetry is how long a rate-limited classification waits before
+// its single retry.
+const rateLimitRetry = 5 * time.Second
+
+// emptyResponseRetry is how long a classification that got an empty
+// answer waits before its single retry with EMPTY_RESPONSE=retry.
+const emptyResponseRetry = 2 * time.Second
+
+// EmptyResponse is what happens to a message when OpenAI answers with
+// nothing at all.
+type EmptyResponse string
+
+const (
+	EmptyRetry     EmptyResponse = "retry"
+	EmptyAmbiguous EmptyResponse = "ambiguous"
+	EmptySkip      EmptyResponse = "skip"
+)
+
+func parseEmptyResponse(s string) (EmptyResponse, error) {
+	switch m := EmptyResponse(s); m {
+	case "":
+		return EmptySkip, nil
+	case EmptyRetry, EmptyAmbiguous, EmptySkip:
+		return m, nil
+	default:
+		return "", errors.Errorf("EMPTY_RESPONSE must be retry, ambiguous or skip, got %q", s)
+	}
+}
+
+// authAlertAfter is how many classifications in a row must fail
+// authentication before the admin is alerted.
+const authAlertAfter = 3
+
+// classifyRetry runs a classification, retrying it once after a pause if
+// OpenAI rate-limited it or, with EMPTY_RESPONSE=retry, answered nothing.
+func (a *App) classifyRetry(ctx context.Context, classify func() (verdict, error)) (verdict, error) {
+	v, err := classify()
+	var pause time.Duration
+	switch {
+	case errors.Is(err, ErrClassifyRateLimited):
+		pause = rateLimitRetry
+		a.lg.Warn("Classification rate-limited, retrying", zap.Duration("after", pause))
+	case errors.Is(err, ErrClassifyEmpty) && a.cfg.EmptyResponse == EmptyRetry:
+		pause = emptyResponseRetry
+		a.lg.Warn("Empty OpenAI response, retrying", zap.Error(err), zap.Duration("after", pause))
+	default:
+		return v, err
+	}
+	select {
+	case <-time.After(pause):
+	case <-ctx.Done():
+		return v, err
+	}
+	return classify()
+}
+
+// emptyAs settles an empty answer that is left after any retry: with
+// EMPTY_RESPONSE=ambiguous it gets the AMBIGUOUS_AS verdict, otherwise the
+// message is skipped. Either way it is logged and counted, so a model that
+// keeps answering nothing shows up in the log and /stats. It is the only
+// place they are counted, so a retried message counts once.
+func (a *App) emptyAs(campaign string, err error) (bool, error) {
+	a.stats.IncEmptyResponses()
+	relevant := a.cfg.EmptyResponse == EmptyAmbiguous && a.cfg.AmbiguousAs
+	a.lg.Warn("Empty OpenAI response",
+		zap.String("campaign", campaign),
+		zap.Error(err),
+		zap.String("mode", string(a.cfg.EmptyResponse)),
+		zap.Bool("treated_as", relevant),
+	)
+	return relevant, nil
+}
+
+// trackClassifyAuth counts consecutive authentication failures and
+// alerts the admin once they persist; any other outcome resets the count.
+func (a *App) trackClassifyAuth(ctx context.Context, err error) {
+	if !errors.Is(err, ErrClassifyAuth) {
+		a.authFailures.Store(0)
+		return
+	}
+	if a.authFailures.Add(1) != authAlertAfter {
+		return
+	}
+
+	text := fmt.Sprintf("OpenAI rejects the API key (%v): messages are not being classified. Check OPENAI_API_KEY.", err)
+	a.lg.Error("OpenAI authentication keeps failing", zap.Error(err))
+	fmt.Fprintf(a.out, "WARNING: %s\n", text)
+	if a.cfg.AlertWebhook != "" {
+		if err := postAlert(a.cfg.AlertWebhook, "openai_auth", text); err != nil {
+			a.lg.Error("OpenAI auth alert webhook", zap.Error(err))
+		}
+	}
+	if peer, ok := a.recipients[a.cfg.AdminUsername]; ok && !a.dryRun {
+		if _, err := a.sender.To(peer).Text(ctx, text); err != nil {
+			a.lg.Error("OpenAI auth alert", zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	pebbledb "github.com/cockroachdb/pebble"
+	"github.com/go-faster/errors"
+	"github.com/gotd/contrib/storage"
+	"github.com/gotd/td/telegram/query"
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+)
+
+const collectProgressEvery = 500
+
+var collectCursorKey = []byte("meta/peer_collect_cursor")
+
+// collectCursor is the position after the last stored dialog, so an
+// interrupted scan resumes there on the next start.
+type collectCursor struct {
+	OffsetID   int    `json:"offset_id"`
+	OffsetDate int    `json:"offset_date"`
+	PeerKind   string `json:"peer_kind"`
+	PeerID     int64  `json:"peer_id"`
+	AccessHash int64  `json:"access_hash"`
+	Collected  int    `json:"collected"`
+}
+
+func (c collectCursor) peer() tg.InputPeerClass {
+	switch c.PeerKind {
+	case "user":
+		return &tg.InputPeerUser{UserID: c.PeerID, AccessHash: c.AccessHash}
+	case "chat":
+		return &tg.InputPeerChat{ChatID: c.PeerID}
+	case "channel":
+		return &tg.InputPeerChannel{ChannelID: c.PeerID, AccessHash: c.AccessHash}
+	default:
+		return &tg.InputPeerEmpty{}
+	}
+}
+
+func (c *collectCursor) setPeer(p tg.InputPeerClass) bool {
+	switch p := p.(type) {
+	case *tg.InputPeerUser:
+		c.PeerKind, c.PeerID, c.AccessHash = "user", p.UserID, p.AccessHash
+	case *tg.InputPeerChat:
+		c.PeerKind, c.PeerID, c.AccessHash = "chat", p.ChatID, 0
+	case *tg.InputPeerChannel:
+		c.PeerKind, c.PeerID, c.AccessHash = "channel", p.ChannelID, p.AccessHash
+	default:
+		return false
+	}
+	return true
+}
+
+func (a *App) loadCollectCursor() (collectCursor, bool) {
+	data, closer, err := a.db.Get(collectCursorKey)
+	if err != nil {
+		return collectCursor{}, false
+	}
+	defer closer.Close()
+	var c collectCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return collectCursor{}, false
+	}
+	return c, true
+}
+
+func (a *App) saveCollectCursor(c collectCursor) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return errors.Wrap(err, "marshal cursor")
+	}
+	return a.db.Set(collectCursorKey, data, pebbledb.NoSync)
+}
+
+// collectPeers stores peers from the dialog list, stopping after
+// PEER_COLLECT_LIMIT dialogs or PEER_COLLECT_TIMEOUT, whichever comes
+// first. The position is persisted, so an unfinished scan resumes on the
+// next start; a finished one starts over from the top. Peers that are
+// missed here are resolved lazily later. It returns how many peers were
+// stored.
+func (a *App) collectPeers(ctx context.Context) (int, error) {
+	if a.cfg.PeerCollectTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.cfg.PeerCollectTimeout)
+		defer cancel()
+	}
+
+	iter := query.GetDialogs(a.api).Iter()
+	cursor, resumed := a.loadCollectCursor()
+	if resumed {
+		iter.OffsetID(cursor.OffsetID).OffsetDate(cursor.OffsetDate).OffsetPeer(cursor.peer())
+		fmt.Fprintf(a.out, "Resuming peer collection after %d peers\n", cursor.Collected)
+	}
+
+	seen, collected := 0, 0
+	for (a.cfg.PeerCollectLimit <= 0 || seen < a.cfg.PeerCollectLimit) && iter.Next(ctx) {
+		seen++
+		var (
+			p     storage.Peer
+			value = iter.Value()
+		)
+		switch dlg := value.Dialog.GetPeer().(type) {
+		case *tg.PeerUser:
+			user, ok := value.Entities.User(dlg.UserID)
+			if !ok || !p.FromUser(user) {
+				continue
+			}
+		case *tg.PeerChat:
+			chat, ok := value.Entities.Chat(dlg.ChatID)
+			if !ok || !p.FromChat(chat) {
+				continue
+			}
+		case *tg.PeerChannel:
+			channel, ok := value.Entities.Channel(dlg.ChannelID)
+			if !ok || !p.FromChat(channel) {
+				continue
+			}
+		default:
+			continue
+		}
+
+		if err := a.peerDB.Add(ctx, p); err != nil {
+			return collected, errors.Wrap(err, "add peer")
+		}
+		collected++
+
+		if value.Last != nil && cursor.setPeer(value.Peer) {
+			cursor.OffsetID, cursor.OffsetDate = value.Last.GetID(), value.Last.GetDate()
+			cursor.Collected++
+			if err := a.saveCollectCursor(cursor); err != nil {
+				a.lg.Warn("Save collect cursor", zap.Error(err))
+			}
+		}
+		if collected%collectProgressEvery == 0 {
+			total, _ := iter.Total(ctx)
+			fmt.Fprintf(a.out, "Collecting peers: %d of ~%d\n", cursor.Collected, total)
+		}
+	}
+
+	// Total is usually known after the first page; if it is not, the
+	// lookup may fail on an expired context and the estimate stays zero.
+	total, _ := iter.Total(ctx)
+	a.lg.Info("Peers collected",
+		zap.Int("collected", collected),
+		zap.Int("collected_total", cursor.Collected),
+		zap.Int("total", total),
+		zap.Bool("resumed", resumed),
+	)
+	fmt.Fprintf(a.out, "Collected %d peers (%d so far) of ~%d\n", collected, cursor.Collected, total)
+
+	err := iter.Err()
+	if err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		return collected, err
+	}
+	stopped := err != nil || (a.cfg.PeerCollectLimit > 0 && seen >= a.cfg.PeerCollectLimit)
+	if !stopped {
+		if err := a.db.Delete(collectCursorKey, pebbledb.Sync); err != nil {
+			a.lg.Warn("Reset collect cursor", zap.Error(err))
+		}
+	}
+	return collected, nil
+}
+
+// refreshCommand handles "/refresh": a peer scan from the top of the
+// dialog list, so chats joined since startup are attributed correctly. A
+// full scan can outlast HANDLER_TIMEOUT, so it runs in the background on
+// the run context and replies to the command when it finishes.
+func (a *App) refreshCommand(peer tg.InputPeerClass, msgID int) string {
+	if !a.refreshing.CompareAndSwap(false, true) {
+		return "Обновление уже идёт"
+	}
+	ctx := a.runCtx
+	go func() {
+		defer a.refreshing.Store(false)
+		n, err := a.refreshPeers(ctx)
+		reply := fmt.Sprintf("Обновлено пиров: %d", n)
+		if err != nil {
+			a.stats.IncErrors()
+			a.lg.Error("Refresh peers", zap.Int("collected", n), zap.Error(err))
+			reply = fmt.Sprintf("Обновление прервано после %d пиров: %v", n, err)
+		}
+		if _, err := a.sender.To(peer).Reply(msgID).Text(ctx, reply); err != nil {
+			a.lg.Error("Reply to /refresh", zap.Error(err))
+		}
+	}()
+	return "Обновление запущено, сообщу, когда закончится"
+}
+
+// refreshPeers collects peers from the top of the dialog list and drops
+// the cached discussion threads, forum topic titles and reply previews,
+// so renamed chats and authors show their current names.
+func (a *App) refreshPeers(ctx context.Context) (int, error) {
+	if err := a.db.Delete(collectCursorKey, pebbledb.Sync); err != nil {
+		return 0, errors.Wrap(err, "reset collect cursor")
+	}
+	n, err := a.collectPeers(ctx)
+	if err != nil {
+		return n, errors.Wrap(err, "collect peers")
+	}
+	a.threads.reset()
+	a.topics.reset()
+	a.parents.reset()
+	return n, nil
+}
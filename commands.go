@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+)
+
+var leadRefRe = regexp.MustCompile(`#(\d+)`)
+
+// adminPeer returns the peer of a resolved Telegram recipient by user ID.
+func (a *App) adminPeer(userID int64) (tg.InputPeerClass, bool) {
+	for _, p := range a.recipients {
+		switch u := p.(type) {
+		case *tg.InputPeerUser:
+			if u.UserID == userID {
+				return p, true
+			}
+		case *tg.InputPeerSelf:
+			if userID == a.selfID.Load() {
+				return p, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// isSavedMessages reports whether peer is the account's Saved Messages
+// and a recipient is "me", so the admin's commands there are outgoing.
+func (a *App) isSavedMessages(peer tg.PeerClass) bool {
+	pu, ok := peer.(*tg.PeerUser)
+	if !ok || pu.UserID != a.selfID.Load() {
+		return false
+	}
+	_, ok = a.adminPeer(pu.UserID)
+	return ok
+}
+
+// isRecipientChat reports whether peer is the private chat with a
+// resolved recipient.
+func (a *App) isRecipientChat(peer tg.PeerClass) bool {
+	pu, ok := peer.(*tg.PeerUser)
+	if !ok {
+		return false
+	}
+	_, ok = a.adminPeer(pu.UserID)
+	return ok
+}
+
+// handleCommand processes messages from recipients in their private chat
+// with the bot. It reports whether msg was a command.
+func (a *App) handleCommand(ctx context.Context, msg *tg.Message) (bool, error) {
+	pu, ok := msg.PeerID.(*tg.PeerUser)
+	if !ok {
+		return false, nil
+	}
+	peer, ok := a.adminPeer(pu.UserID)
+	if !ok {
+		return false, nil
+	}
+
+	text := strings.TrimSpace(msg.Message)
+	cmd, args, _ := strings.Cut(text, " ")
+	args = strings.TrimSpace(args)
+
+	var reply string
+	switch cmd {
+	case "/good", "/bad", "👍", "👎":
+		good := cmd == "/good" || cmd == "👍"
+		id, err := a.feedbackTarget(ctx, msg, args)
+		if err != nil {
+			reply = err.Error()
+			break
+		}
+		reply, err = a.labelLead(ctx, id, good)
+		if err != nil {
+			return true, err
+		}
+	case "/pause":
+		r, err := a.pauseCommand(args)
+		if err != nil {
+			return true, err
+		}
+		reply = r
+	case "/resume":
+		r, err := a.resumeCommand()
+		if err != nil {
+			return true, err
+		}
+		reply = r
+	case "/reply":
+		r, err := a.replyCommand(ctx, pu.UserID, args)
+		if err != nil {
+			return true, err
+		}
+		reply = r
+	case "/confirm":
+		r, err := a.confirmCommand(ctx, pu.UserID)
+		if err != nil {
+			return true, err
+		}
+		reply = r
+	case "/topchats":
+		r, err := a.topChatsCommand(ctx, args)
+		if err != nil {
+			return true, err
+		}
+		reply = r
+	case "/contacts":
+		r, err := a.contactsCommand(ctx, args)
+		if err != nil {
+			return true, err
+		}
+		reply = r
+	case "/shadow-stats":
+		r, err := a.shadowStatsCommand()
+		if err != nil {
+			return true, err
+		}
+		reply = r
+	case "/lead":
+		r, err := a.leadCommand(ctx, args)
+		if err != nil {
+			return true, err
+		}
+		reply = r
+	case "/refresh":
+		reply = a.refreshCommand(peer, msg.ID)
+	case "/config":
+		reply = a.configCommand()
+	case "/stats":
+		reply = a.statsCommand()
+	case "/accuracy":
+		r, err := a.accuracyReport(ctx)
+		if err != nil {
+			return true, err
+		}
+		reply = r
+	default:
+		return false, nil
+	}
+
+	if _, err := a.sender.To(peer).Reply(msg.ID).Text(ctx, reply); err != nil {
+		return true, errors.Wrap(err, "reply")
+	}
+	return true, nil
+}
+
+// feedbackTarget finds the lead ID from the command argument, or from the
+// "#<id>" in the forwarded summary the admin replied to.
+func (a *App) feedbackTarget(ctx context.Context, msg *tg.Message, args string) (uint64, error) {
+	if args != "" {
+		id, err := strconv.ParseUint(strings.TrimPrefix(args, "#"), 10, 64)
+		if err != nil {
+			return 0, errors.Errorf("invalid lead ID %q", args)
+		}
+		return id, nil
+	}
+
+	hdr, ok := msg.ReplyTo.(*tg.MessageReplyHeader)
+	if !ok || hdr.ReplyToMsgID == 0 {
+		return 0, errors.New("reply to a lead or pass its ID, e.g. /good 42")
+	}
+	res, err := a.api.MessagesGetMessages(ctx, []tg.InputMessageClass{&tg.InputMessageID{ID: hdr.ReplyToMsgID}})
+	if err != nil {
+		return 0, errors.Wrap(err, "get replied message")
+	}
+	msgs, ok := res.(tg.ModifiedMessagesMessages)
+	if !ok {
+		return 0, errors.New("replied message not found")
+	}
+	for _, m := range msgs.GetMessages() {
+		if m, ok := m.(*tg.Message); ok {
+			if sub := leadRefRe.FindStringSubmatch(m.Message); sub != nil {
+				return strconv.ParseUint(sub[1], 10, 64)
+			}
+		}
+	}
+	return 0, errors.New("replied message has no lead ID")
+}
+
+func (a *App) labelLead(ctx context.Context, id uint64, good bool) (string, error) {
+	err := a.leads.Update(ctx, id, func(l *Lead) error {
+		l.Label = &good
+		return nil
+	})
+	if errors.Is(err, ErrLeadNotFound) {
+		return fmt.Sprintf("lead #%d not found", id), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	a.lg.Info("Lead labeled", zap.Uint64("lead_id", id), zap.Bool("good", good))
+	if good {
+		return fmt.Sprintf("#%d отмечен как релевантный", id), nil
+	}
+	return fmt.Sprintf("#%d отмечен как нерелевантный", id), nil
+}
+
+// accuracyReport computes precision over admin-labeled leads. Every stored
+// lead was a positive prediction, so precision is good / labeled.
+func (a *App) accuracyReport(ctx context.Context) (string, error) {
+	leads, err := a.leads.List(ctx)
+	if err != nil {
+		return "", err
+	}
+	type counts struct{ good, bad int }
+	total := counts{}
+	byCampaign := map[string]*counts{}
+	var names []string
+	for _, l := range leads {
+		if l.Label == nil {
+			continue
+		}
+		c, ok := byCampaign[l.Campaign]
+		if !ok {
+			c = &counts{}
+			byCampaign[l.Campaign] = c
+			names = append(names, l.Campaign)
+		}
+		if *l.Label {
+			c.good++
+			total.good++
+		} else {
+			c.bad++
+			total.bad++
+		}
+	}
+	if total.good+total.bad == 0 {
+		return "Нет размеченных лидов", nil
+	}
+
+	precision := func(c counts) string {
+		return fmt.Sprintf("%.0f%% (%d/%d)", 100*float64(c.good)/float64(c.good+c.bad), c.good, c.good+c.bad)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Точность: %s", precision(total))
+	for _, n := range names {
+		fmt.Fprintf(&b, "\n%s: %s", n, precision(*byCampaign[n]))
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-faster/errors"
+)
+
+// ChatConfidence holds the minimum verdict confidence required to forward
+// a lead, per chat. The zero value forwards everything.
+type ChatConfidence struct {
+	byChat map[int64]float64
+	def    float64
+}
+
+// For returns the threshold for a chat, keyed by its bare ID as stored
+// on leads.
+func (c ChatConfidence) For(chatID int64) float64 {
+	if t, ok := c.byChat[chatID]; ok {
+		return t
+	}
+	return c.def
+}
+
+// String renders the thresholds in CHAT_CONFIDENCE form, or "" when
+// none are set.
+func (c ChatConfidence) String() string {
+	var parts []string
+	for id, t := range c.byChat {
+		parts = append(parts, fmt.Sprintf("%d=%g", id, t))
+	}
+	sort.Strings(parts)
+	if c.def > 0 {
+		parts = append(parts, fmt.Sprintf("default=%g", c.def))
+	}
+	return strings.Join(parts, ";")
+}
+
+// bareChatID accepts both bare IDs and Bot API style ones (-100… for
+// channels, -… for basic groups).
+func bareChatID(s string) (int64, error) {
+	if rest, ok := strings.CutPrefix(s, "-100"); ok && len(rest) > 0 {
+		s = rest
+	}
+	id, err := strconv.ParseInt(strings.TrimPrefix(s, "-"), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// parseChatConfidence parses "chat=threshold;…;default=threshold".
+func parseChatConfidence(s string) (ChatConfidence, error) {
+	var c ChatConfidence
+	for _, entry := range strings.Split(s, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		chat, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return c, errors.Errorf("CHAT_CONFIDENCE entry %q: want chat=threshold", entry)
+		}
+		t, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || t < 0 || t > 1 {
+			return c, errors.Errorf("CHAT_CONFIDENCE entry %q: threshold must be between 0 and 1", entry)
+		}
+		chat = strings.TrimSpace(chat)
+		if chat == "default" {
+			c.def = t
+			continue
+		}
+		id, err := bareChatID(chat)
+		if err != nil {
+			return c, errors.Errorf("CHAT_CONFIDENCE entry %q: invalid chat ID", entry)
+		}
+		if c.byChat == nil {
+			c.byChat = map[int64]float64{}
+		}
+		c.byChat[id] = t
+	}
+	return c, nil
+}
@@ -0,0 +1,982 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/telegram"
+)
+
+type Config struct {
+	Phone         string
+	AppID         int
+	AppHash       string
+	AdminUsername string
+	// TestMode sends every lead and alert to TestAdminUsername instead of
+	// the admin and campaign recipients; ProdAdminUsername keeps
+	// ADMIN_USERNAME for display.
+	TestMode          bool
+	TestAdminUsername string
+	ProdAdminUsername string
+
+	// OpenAIKeys are used round-robin; a rate-limited key is benched
+	// briefly.
+	OpenAIKeys []string
+	// OpenAIBaseURL replaces the official API endpoint, e.g. for a
+	// compatible proxy. OpenAIOrg and OpenAIProject scope usage for
+	// billing and only apply to the official endpoint.
+	OpenAIBaseURL string
+	OpenAIOrg     string
+	OpenAIProject string
+	// DailyTokenBudget and DailySpendCapUSD stop OpenAI calls for the
+	// rest of the day once reached; zero disables each.
+	DailyTokenBudget int64
+	DailySpendCapUSD float64
+	// BreakerThreshold consecutive OpenAI failures open the circuit
+	// breaker for BreakerCooldown; zero disables it.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+
+	// Test connects to Telegram's test DCs, with a separate session.
+	Test bool
+
+	// Device is reported to Telegram and shown in the account's active
+	// sessions; empty fields get gotd defaults.
+	Device telegram.DeviceConfig
+
+	// SessionDir is the base directory for per-account session folders.
+	SessionDir string
+	// SessionKey, when set, encrypts the session file at rest.
+	SessionKey string
+
+	// Log rotation for log.jsonl in the session folder.
+	LogMaxSizeMB  int
+	LogMaxBackups int
+	LogMaxAgeDays int
+	LogCompress   bool
+
+	Campaigns []Campaign
+	// ExamplesFile holds few-shot examples added to the campaign prompts;
+	// Examples is what was loaded from it.
+	ExamplesFile string
+	Examples     FewShotExamples
+	// MatchFirst stops evaluating campaigns after the first match.
+	MatchFirst bool
+
+	SummaryStyle SummaryStyle
+
+	// OutputNDJSON prints one JSON line per classified message to stdout
+	// and moves status output to stderr.
+	OutputNDJSON bool
+
+	// AmbiguousAs is the verdict used when the model answers neither
+	// true nor false.
+	AmbiguousAs bool
+
+	// EmptyResponse decides what an empty OpenAI answer means: retry
+	// once, the AmbiguousAs verdict, or skipping the message.
+	EmptyResponse EmptyResponse
+
+	// SMTP is used for mailto: recipients; Host empty disables email.
+	SMTP SMTPConfig
+
+	// AlertWebhook and AlertEmail receive a final alert when the Telegram
+	// session is revoked, since Telegram itself can't be used then. The
+	// webhook also hears about unreachable recipients.
+	AlertWebhook string
+	AlertEmail   string
+
+	// ConfigReload is how often .env and the prompt files are checked for
+	// changes to reload; zero disables.
+	ConfigReload time.Duration
+
+	// SheetSink gets a row per forwarded lead: appended to a CSV file, or
+	// posted to a webhook when it is an http(s) URL. Empty disables.
+	SheetSink string
+
+	// Classifier is the text classification backend; RegexRules are
+	// loaded from RegexRulesFile for ClassifierRegex.
+	Classifier     ClassifierBackend
+	RegexRulesFile string
+	RegexRules     RegexClassifier
+
+	Vision         bool
+	VisionModel    string
+	VisionMaxBytes int64
+
+	// ShadowModel and ShadowPrompt configure a shadow classifier that
+	// runs next to the primary one for comparison only; either may be
+	// empty to reuse the primary's.
+	ShadowModel  string
+	ShadowPrompt string
+
+	// ClassifyCacheTTL is how long verdicts for identical text are reused;
+	// zero disables the cache.
+	ClassifyCacheTTL time.Duration
+
+	// PriceInputPer1M and PriceOutputPer1M are USD per million tokens,
+	// used for -sample cost estimates.
+	PriceInputPer1M  float64
+	PriceOutputPer1M float64
+
+	// StripURLs removes links from the classifier input.
+	StripURLs bool
+
+	// MaxInputChars caps the runes of message text sent to OpenAI, keeping
+	// the beginning and InputTailChars runes from the end.
+	MaxInputChars  int
+	InputTailChars int
+	// ChunkLongMessages classifies text over MaxInputChars in overlapping
+	// chunks instead of truncating it.
+	ChunkLongMessages bool
+
+	// ProcessOutgoing classifies the account's own messages too, for
+	// testing; they are attributed to self.
+	ProcessOutgoing bool
+
+	// IncludeChannelPosts classifies broadcast channel posts, which are
+	// attributed to the channel rather than a user.
+	IncludeChannelPosts bool
+
+	// IgnoreMediaTypes drops messages with these media (see mediaTypes)
+	// before classification; KeepCaptionedMedia keeps them when they
+	// have a caption.
+	IgnoreMediaTypes   map[string]bool
+	KeepCaptionedMedia bool
+
+	// IncludePolls classifies poll and quiz messages by their question
+	// and options.
+	IncludePolls bool
+
+	// Languages restricts classification to texts detected in these
+	// languages (see detectLanguage); nil allows all.
+	Languages map[string]bool
+
+	// RequireRequestShape only classifies texts that look like a question
+	// or request (see looksLikeRequest).
+	RequireRequestShape bool
+
+	// WatchSenderIDs and WatchSenderNames restrict classification to
+	// messages from these senders, in any chat; usernames are resolved
+	// at startup. Both empty means every sender.
+	WatchSenderIDs   []int64
+	WatchSenderNames []string
+
+	// IgnoreForwarded skips forwarded messages, which are usually
+	// reposts rather than live requests.
+	IgnoreForwarded bool
+
+	// SkipOnPeerError drops a message when peer storage fails with
+	// anything other than not-found, instead of using partial metadata.
+	SkipOnPeerError bool
+
+	// PeerCollectLimit and PeerCollectTimeout bound the startup dialog
+	// scan; zero means unlimited.
+	PeerCollectLimit   int
+	PeerCollectTimeout time.Duration
+	// EarlyMessages is how messages arriving during peer collection are
+	// handled.
+	EarlyMessages EarlyMessages
+
+	// MonitorTopics limits which forum topics are classified.
+	MonitorTopics MonitorTopics
+
+	// DedupScope decides which repeats of a message are dropped.
+	DedupScope DedupScope
+
+	// MinScore is the lowest lead score that is forwarded; leads below it
+	// are still stored.
+	MinScore int
+
+	// ScoreFormula weighs confidence, keywords, budget and sender score
+	// into one score; leads not above its threshold are stored only.
+	ScoreFormula ScoreFormula
+
+	// MinBudget stores leads whose mentioned budget is below it without
+	// forwarding them; nil disables.
+	MinBudget MinBudget
+
+	// ChatConfidence is the minimum verdict confidence to forward a lead
+	// from each chat; leads below it are stored only.
+	ChatConfidence ChatConfidence
+
+	// SenderCooldown suppresses forwarding repeated leads from the same
+	// sender and campaign; zero disables it.
+	SenderCooldown time.Duration
+
+	// SpamWindow is the window for counting the chats a sender posted in;
+	// leads from senders at SpamChatThreshold chats or more are stored
+	// without forwarding (zero disables the threshold).
+	SpamWindow        time.Duration
+	SpamChatThreshold int
+
+	// SpamContentWindow stores leads whose text another message had
+	// within it without forwarding them; zero disables.
+	SpamContentWindow time.Duration
+
+	// SenderVerdictTTL is how long a sender's relevant verdict is reused
+	// for their near-identical follow-ups without calling OpenAI; zero
+	// disables.
+	SenderVerdictTTL time.Duration
+
+	// AdminResolveRetries is how many times recipient resolution is
+	// retried at startup. If it still fails the bot exits, unless
+	// AdminResolveDegraded is set, in which case it runs in dry-run.
+	AdminResolveRetries  int
+	AdminResolveDegraded bool
+
+	// RecoveredAfter marks leads from messages older than this as
+	// recovered from the backlog; zero disables.
+	RecoveredAfter time.Duration
+	// StartupGrace queues forwards for this long after start; leads are
+	// still classified and stored. Zero disables.
+	StartupGrace time.Duration
+	// StartupJitter is the longest random wait after login before the
+	// startup work; zero disables.
+	StartupJitter time.Duration
+
+	// StartupSelfTest delivers a synthetic test lead to the admin after
+	// login.
+	StartupSelfTest bool
+
+	// Ordered handles messages one at a time in arrival order, so
+	// forwards keep the source order at the cost of throughput. It
+	// implies a single worker.
+	Ordered bool
+
+	// Workers is how many messages are processed at once, fed through a
+	// queue of QueueSize; zero handles each update in its own handler.
+	// QueueFull decides what a full queue does.
+	Workers   int
+	QueueSize int
+	QueueFull QueueFull
+
+	// AlbumWait is how long after its latest part an album is merged and
+	// processed as one message; zero processes parts separately.
+	AlbumWait time.Duration
+
+	// ForwardDebounce delays forwarding a lead so an edit made within it
+	// replaces the first version; zero disables.
+	ForwardDebounce time.Duration
+
+	// LateEdits classifies messages again when they are edited within
+	// this long of posting and outside any debounce window; zero
+	// disables.
+	LateEdits time.Duration
+
+	// HandlerTimeout bounds the processing of one message, from context
+	// fetches to forwarding; zero disables.
+	HandlerTimeout time.Duration
+
+	// RateInterval and RateBurst limit Telegram API calls.
+	RateInterval time.Duration
+	RateBurst    int
+
+	// KeepAliveInterval enables a periodic cheap API call; zero disables.
+	KeepAliveInterval time.Duration
+
+	// ContextMessages is how many messages before and after a lead are
+	// fetched and included in its summary; zero disables.
+	ContextMessages int
+
+	// PerChatInterval is the minimum time between read requests (e.g.
+	// CONTEXT_MESSAGES history fetches) to the same chat; zero disables.
+	PerChatInterval time.Duration
+
+	// UrgentKeywords are lowercase phrases that make a lead urgent: it is
+	// forwarded right away even if the model rejects it, bypassing the
+	// built-in filters, ACTIVE_HOURS and /pause. UrgentRecipient, if set,
+	// gets urgent leads instead of the campaign recipients.
+	UrgentKeywords  []string
+	UrgentRecipient string
+
+	// FallbackRecipient gets the leads of recipients that blocked the
+	// account or deleted the chat.
+	FallbackRecipient string
+
+	// ActiveHours limits when forwards are sent; leads found outside it
+	// are queued until it opens.
+	ActiveHours ActiveHours
+	// Location is TIMEZONE, for ACTIVE_HOURS and the daily spend cap.
+	Location *time.Location
+}
+
+// configErrors is every problem found while loading the configuration.
+type configErrors []error
+
+func (e configErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "invalid configuration (%d problems):", len(e))
+	for _, err := range e {
+		b.WriteString("\n  - ")
+		b.WriteString(err.Error())
+	}
+	return b.String()
+}
+
+// loadConfig reads the configuration from the environment and reports
+// every problem at once rather than stopping at the first.
+func loadConfig() (Config, error) {
+	var (
+		cfg      Config
+		problems configErrors
+	)
+	bad := func(err error) { problems = append(problems, err) }
+
+	cfg.Phone = os.Getenv("TG_PHONE")
+	if cfg.Phone == "" {
+		bad(errors.New("TG_PHONE is required (e.g. +123456789)"))
+	}
+	appID, err := strconv.Atoi(os.Getenv("APP_ID"))
+	if err != nil || appID == 0 {
+		bad(errors.New("APP_ID is required (int)"))
+	}
+	cfg.AppID = appID
+	cfg.AppHash = os.Getenv("APP_HASH")
+	if cfg.AppHash == "" {
+		bad(errors.New("APP_HASH is required"))
+	}
+	for _, k := range strings.Split(os.Getenv("OPENAI_API_KEYS"), ",") {
+		if k = strings.TrimSpace(k); k != "" {
+			cfg.OpenAIKeys = append(cfg.OpenAIKeys, k)
+		}
+	}
+	if len(cfg.OpenAIKeys) == 0 {
+		if k := os.Getenv("OPENAI_API_KEY"); k != "" {
+			cfg.OpenAIKeys = []string{k}
+		}
+	}
+	cfg.OpenAIBaseURL = strings.TrimRight(os.Getenv("OPENAI_BASE_URL"), "/")
+	cfg.OpenAIOrg = os.Getenv("OPENAI_ORG_ID")
+	cfg.OpenAIProject = os.Getenv("OPENAI_PROJECT_ID")
+	if v := os.Getenv("DAILY_TOKEN_BUDGET"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 {
+			bad(errors.New("DAILY_TOKEN_BUDGET must be a non-negative int (0 disables)"))
+		}
+		cfg.DailyTokenBudget = n
+	}
+	if v := os.Getenv("DAILY_SPEND_CAP_USD"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 {
+			bad(errors.New("DAILY_SPEND_CAP_USD must be a non-negative number (0 disables)"))
+		}
+		cfg.DailySpendCapUSD = f
+	}
+	cfg.BreakerThreshold = 5
+	if v := os.Getenv("CB_FAILURE_THRESHOLD"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			bad(errors.New("CB_FAILURE_THRESHOLD must be a non-negative integer (0 disables)"))
+		}
+		cfg.BreakerThreshold = n
+	}
+	cfg.BreakerCooldown = time.Minute
+	if v := os.Getenv("CB_COOLDOWN"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			bad(errors.New("CB_COOLDOWN must be a positive duration (e.g. 1m)"))
+		}
+		cfg.BreakerCooldown = d
+	}
+	cfg.AdminUsername = os.Getenv("ADMIN_USERNAME")
+	if cfg.AdminUsername == "" {
+		bad(errors.New("ADMIN_USERNAME is required (e.g. @ew2df)"))
+	}
+
+	cfg.Test = os.Getenv("TG_TEST") == "true"
+	cfg.Device = telegram.DeviceConfig{DeviceModel: "tg-parser", AppVersion: "1.0", SystemLangCode: "en"}
+	for _, f := range []struct {
+		env string
+		to  *string
+	}{
+		{"TG_DEVICE_MODEL", &cfg.Device.DeviceModel},
+		{"TG_APP_VERSION", &cfg.Device.AppVersion},
+		{"TG_SYSTEM_LANG", &cfg.Device.SystemLangCode},
+	} {
+		v, ok := os.LookupEnv(f.env)
+		if !ok {
+			continue
+		}
+		if v = strings.TrimSpace(v); v == "" {
+			bad(errors.Errorf("%s must not be empty (unset it for the default)", f.env))
+			continue
+		}
+		*f.to = v
+	}
+	cfg.Device.LangCode = cfg.Device.SystemLangCode
+	cfg.SessionDir = os.Getenv("SESSION_DIR")
+	cfg.SessionKey = os.Getenv("SESSION_ENCRYPTION_KEY")
+
+	cfg.LogMaxSizeMB, cfg.LogMaxBackups, cfg.LogMaxAgeDays = 2, 3, 7
+	for _, f := range []struct {
+		env string
+		to  *int
+		min int
+	}{
+		{"LOG_MAX_SIZE_MB", &cfg.LogMaxSizeMB, 1},
+		{"LOG_MAX_BACKUPS", &cfg.LogMaxBackups, 0},
+		{"LOG_MAX_AGE_DAYS", &cfg.LogMaxAgeDays, 0},
+	} {
+		v := os.Getenv(f.env)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < f.min {
+			bad(errors.Errorf("%s must be an int of at least %d", f.env, f.min))
+			continue
+		}
+		*f.to = n
+	}
+	cfg.LogCompress = os.Getenv("LOG_COMPRESS") == "true"
+
+	cfg.Campaigns, err = parseCampaigns(os.Getenv("CAMPAIGNS"), cfg.AdminUsername)
+	if err != nil {
+		bad(err)
+	}
+	if cfg.ExamplesFile = os.Getenv("EXAMPLES_FILE"); cfg.ExamplesFile != "" {
+		cfg.Examples, err = loadExamples(cfg.ExamplesFile, cfg.Campaigns)
+		if err != nil {
+			bad(err)
+		}
+		for i, c := range cfg.Campaigns {
+			cfg.Campaigns[i] = cfg.Examples.Apply(c)
+		}
+	}
+	cfg.Classifier, err = parseClassifierBackend(os.Getenv("CLASSIFIER"))
+	if err != nil {
+		bad(err)
+	}
+	cfg.RegexRulesFile = os.Getenv("REGEX_RULES_FILE")
+	if cfg.RegexRulesFile != "" {
+		if cfg.RegexRules, err = loadRegexRules(cfg.RegexRulesFile, cfg.Campaigns); err != nil {
+			bad(err)
+		}
+	} else if cfg.Classifier == ClassifierRegex {
+		bad(errors.New("CLASSIFIER=regex needs REGEX_RULES_FILE"))
+	}
+	cfg.SMTP = SMTPConfig{
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     587,
+		User:     os.Getenv("SMTP_USER"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("SMTP_FROM"),
+	}
+	if v := os.Getenv("SMTP_PORT"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			bad(errors.New("SMTP_PORT must be a positive int"))
+		}
+		cfg.SMTP.Port = n
+	}
+	if cfg.SMTP.From == "" {
+		cfg.SMTP.From = cfg.SMTP.User
+	}
+	for _, c := range cfg.Campaigns {
+		for _, r := range c.Recipients {
+			if isEmailRecipient(r) && cfg.SMTP.Host == "" {
+				bad(errors.Errorf("campaign %q: %s needs SMTP_HOST", c.Name, r))
+			}
+		}
+	}
+	if cfg.SMTP.Host != "" && cfg.SMTP.From == "" {
+		bad(errors.New("SMTP_FROM (or SMTP_USER) is required with SMTP_HOST"))
+	}
+
+	cfg.AlertWebhook = os.Getenv("ALERT_WEBHOOK_URL")
+	cfg.AlertEmail = os.Getenv("ALERT_EMAIL")
+	if cfg.AlertEmail != "" && cfg.SMTP.Host == "" {
+		bad(errors.New("ALERT_EMAIL needs SMTP_HOST"))
+	}
+	cfg.SheetSink = os.Getenv("SHEET_SINK")
+	if v := os.Getenv("CONFIG_RELOAD"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			bad(errors.New("CONFIG_RELOAD must be a duration (e.g. 10s, 0 to disable)"))
+		}
+		cfg.ConfigReload = d
+	}
+
+	switch mode := os.Getenv("CAMPAIGN_MATCH"); mode {
+	case "", "all":
+	case "first":
+		cfg.MatchFirst = true
+	default:
+		bad(errors.Errorf("CAMPAIGN_MATCH must be all or first, got %q", mode))
+	}
+
+	cfg.OutputNDJSON = os.Getenv("OUTPUT_NDJSON") == "true"
+
+	cfg.SummaryStyle, err = parseSummaryStyle(os.Getenv("SUMMARY_STYLE"))
+	if err != nil {
+		bad(err)
+	}
+
+	switch v := os.Getenv("AMBIGUOUS_AS"); v {
+	case "", "false":
+	case "true":
+		cfg.AmbiguousAs = true
+	default:
+		bad(errors.Errorf("AMBIGUOUS_AS must be true or false, got %q", v))
+	}
+
+	cfg.EmptyResponse, err = parseEmptyResponse(os.Getenv("EMPTY_RESPONSE"))
+	if err != nil {
+		bad(err)
+	}
+
+	cfg.Vision = os.Getenv("VISION") == "true"
+	cfg.VisionModel = os.Getenv("OPENAI_VISION_MODEL")
+	if cfg.VisionModel == "" {
+		cfg.VisionModel = "gpt-4o-mini"
+	}
+	cfg.VisionMaxBytes = 5 << 20
+	if v := os.Getenv("VISION_MAX_BYTES"); v != "" {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n <= 0 {
+			bad(errors.New("VISION_MAX_BYTES must be a positive int"))
+		}
+		cfg.VisionMaxBytes = n
+	}
+
+	cfg.ShadowModel = os.Getenv("SHADOW_MODEL")
+	if v := os.Getenv("SHADOW_PROMPT"); v != "" {
+		prompt, err := os.ReadFile(v)
+		if err != nil {
+			bad(errors.Wrap(err, "SHADOW_PROMPT"))
+		}
+		cfg.ShadowPrompt = strings.TrimSpace(string(prompt))
+	}
+	// The regex classifier needs no key unless images or the shadow
+	// comparison still go to OpenAI.
+	if len(cfg.OpenAIKeys) == 0 &&
+		(cfg.Classifier == ClassifierOpenAI || cfg.Vision || cfg.ShadowModel != "" || cfg.ShadowPrompt != "") {
+		bad(errors.New("OPENAI_API_KEY (or OPENAI_API_KEYS) is required"))
+	}
+
+	cfg.ClassifyCacheTTL = 24 * time.Hour
+	if v := os.Getenv("CLASSIFY_CACHE_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			bad(errors.New("CLASSIFY_CACHE_TTL must be a duration (e.g. 24h, 0 to disable)"))
+		}
+		cfg.ClassifyCacheTTL = d
+	}
+
+	cfg.PriceInputPer1M, cfg.PriceOutputPer1M = 0.15, 0.60 // gpt-4o-mini
+	if v := os.Getenv("OPENAI_PRICE_INPUT_PER_1M"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 {
+			bad(errors.New("OPENAI_PRICE_INPUT_PER_1M must be a non-negative number"))
+		}
+		cfg.PriceInputPer1M = f
+	}
+	if v := os.Getenv("OPENAI_PRICE_OUTPUT_PER_1M"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 {
+			bad(errors.New("OPENAI_PRICE_OUTPUT_PER_1M must be a non-negative number"))
+		}
+		cfg.PriceOutputPer1M = f
+	}
+
+	cfg.StripURLs = os.Getenv("OPENAI_STRIP_URLS") == "true"
+
+	cfg.MaxInputChars = 2000
+	if v := os.Getenv("OPENAI_MAX_INPUT_CHARS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			bad(errors.New("OPENAI_MAX_INPUT_CHARS must be a non-negative int (0 disables)"))
+		}
+		cfg.MaxInputChars = n
+	}
+	if v := os.Getenv("OPENAI_INPUT_TAIL_CHARS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			bad(errors.New("OPENAI_INPUT_TAIL_CHARS must be a non-negative int"))
+		}
+		cfg.InputTailChars = n
+	}
+	cfg.ChunkLongMessages = os.Getenv("CHUNK_LONG_MESSAGES") == "true"
+	if cfg.ChunkLongMessages && cfg.MaxInputChars == 0 {
+		bad(errors.New("CHUNK_LONG_MESSAGES needs OPENAI_MAX_INPUT_CHARS > 0"))
+	}
+
+	cfg.ProcessOutgoing = os.Getenv("PROCESS_OUTGOING") == "true"
+	cfg.IncludeChannelPosts = os.Getenv("INCLUDE_CHANNEL_POSTS") != "false"
+	cfg.IgnoreForwarded = os.Getenv("IGNORE_FORWARDED") == "true"
+	cfg.WatchSenderIDs, cfg.WatchSenderNames, err = parseWatchSenders(os.Getenv("WATCH_SENDERS"))
+	if err != nil {
+		bad(err)
+	}
+	cfg.IgnoreMediaTypes, err = parseMediaTypes(os.Getenv("IGNORE_MEDIA_TYPES"))
+	if err != nil {
+		bad(err)
+	}
+	cfg.KeepCaptionedMedia = os.Getenv("IGNORE_MEDIA_KEEP_CAPTIONED") == "true"
+	cfg.IncludePolls = os.Getenv("INCLUDE_POLLS") == "true"
+	cfg.RequireRequestShape = os.Getenv("REQUIRE_REQUEST_SHAPE") == "true"
+	cfg.Languages, err = parseLanguages(os.Getenv("LANGUAGES"))
+	if err != nil {
+		bad(err)
+	}
+	cfg.SkipOnPeerError = os.Getenv("SKIP_ON_PEER_ERROR") == "true"
+
+	if v := os.Getenv("PEER_COLLECT_LIMIT"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			bad(errors.New("PEER_COLLECT_LIMIT must be a non-negative int"))
+		}
+		cfg.PeerCollectLimit = n
+	}
+	if v := os.Getenv("PEER_COLLECT_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			bad(errors.New("PEER_COLLECT_TIMEOUT must be a duration (e.g. 2m)"))
+		}
+		cfg.PeerCollectTimeout = d
+	}
+	switch v := EarlyMessages(os.Getenv("EARLY_MESSAGES")); v {
+	case "", EarlyEnrich:
+		cfg.EarlyMessages = EarlyEnrich
+	case EarlyBuffer:
+		cfg.EarlyMessages = v
+	default:
+		bad(errors.Errorf("EARLY_MESSAGES must be enrich or buffer, got %q", v))
+	}
+
+	cfg.MonitorTopics = parseMonitorTopics(os.Getenv("MONITOR_TOPICS"))
+
+	cfg.DedupScope, err = parseDedupScope(os.Getenv("DEDUP_SCOPE"))
+	if err != nil {
+		bad(err)
+	}
+
+	if v := os.Getenv("MIN_SCORE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			bad(errors.New("MIN_SCORE must be an int"))
+		}
+		cfg.MinScore = n
+	}
+
+	cfg.ScoreFormula, err = parseScoreFormula(os.Getenv("SCORE_THRESHOLD"), os.Getenv("SCORE_WEIGHTS"), os.Getenv("SCORE_KEYWORDS"))
+	if err != nil {
+		bad(err)
+	}
+
+	cfg.MinBudget, err = parseMinBudget(os.Getenv("MIN_BUDGET"))
+	if err != nil {
+		bad(err)
+	}
+
+	cfg.ChatConfidence, err = parseChatConfidence(os.Getenv("CHAT_CONFIDENCE"))
+	if err != nil {
+		bad(err)
+	}
+
+	cfg.SpamWindow = time.Hour
+	if v := os.Getenv("SPAM_WINDOW"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			bad(errors.New("SPAM_WINDOW must be a positive duration (e.g. 1h)"))
+		}
+		cfg.SpamWindow = d
+	}
+	if v := os.Getenv("SPAM_CHAT_THRESHOLD"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n == 1 {
+			bad(errors.New("SPAM_CHAT_THRESHOLD must be an int of at least 2 (0 disables)"))
+		}
+		cfg.SpamChatThreshold = n
+	}
+	if v := os.Getenv("SPAM_CONTENT_WINDOW"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			bad(errors.New("SPAM_CONTENT_WINDOW must be a duration (e.g. 24h)"))
+		}
+		cfg.SpamContentWindow = d
+	}
+
+	if v := os.Getenv("SENDER_COOLDOWN"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			bad(errors.New("SENDER_COOLDOWN must be a duration (e.g. 1h)"))
+		}
+		cfg.SenderCooldown = d
+	}
+
+	if v := os.Getenv("SENDER_VERDICT_TTL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			bad(errors.New("SENDER_VERDICT_TTL must be a duration (e.g. 10m)"))
+		}
+		cfg.SenderVerdictTTL = d
+	}
+
+	cfg.AdminResolveRetries = 5
+	if v := os.Getenv("ADMIN_RESOLVE_RETRIES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			bad(errors.New("ADMIN_RESOLVE_RETRIES must be a non-negative int"))
+		}
+		cfg.AdminResolveRetries = n
+	}
+	cfg.AdminResolveDegraded = os.Getenv("ADMIN_RESOLVE_DEGRADED") == "true"
+
+	cfg.RecoveredAfter = 5 * time.Minute
+	if v := os.Getenv("RECOVERED_AFTER"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			bad(errors.New("RECOVERED_AFTER must be a duration (e.g. 5m, 0 to disable)"))
+		}
+		cfg.RecoveredAfter = d
+	}
+	if v := os.Getenv("STARTUP_GRACE"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			bad(errors.New("STARTUP_GRACE must be a duration (e.g. 30s)"))
+		}
+		cfg.StartupGrace = d
+	}
+	if v := os.Getenv("STARTUP_JITTER"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			bad(errors.New("STARTUP_JITTER must be a duration (e.g. 30s)"))
+		}
+		cfg.StartupJitter = d
+	}
+
+	cfg.StartupSelfTest = os.Getenv("STARTUP_SELFTEST") == "true"
+	cfg.Ordered = os.Getenv("ORDERED") == "true"
+	if v := os.Getenv("WORKERS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			bad(errors.New("WORKERS must be a non-negative int (0 for no pool)"))
+		}
+		cfg.Workers = n
+	}
+	if cfg.Ordered {
+		if cfg.Workers > 1 {
+			bad(errors.New("ORDERED needs a single worker, unset WORKERS"))
+		}
+		cfg.Workers = 1
+	}
+	cfg.QueueSize = 256
+	if v := os.Getenv("QUEUE_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			bad(errors.New("QUEUE_SIZE must be a positive int"))
+		}
+		cfg.QueueSize = n
+	}
+	switch v := QueueFull(os.Getenv("QUEUE_FULL")); v {
+	case "", QueueFullBlock:
+		cfg.QueueFull = QueueFullBlock
+	case QueueFullDropOldest:
+		if cfg.Ordered {
+			bad(errors.New("QUEUE_FULL=drop-oldest can't be combined with ORDERED"))
+		}
+		cfg.QueueFull = v
+	default:
+		bad(errors.Errorf("QUEUE_FULL must be block or drop-oldest, got %q", v))
+	}
+
+	cfg.AlbumWait = time.Second
+	if v := os.Getenv("ALBUM_WAIT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			bad(errors.New("ALBUM_WAIT must be a duration (e.g. 1s, 0 to disable)"))
+		}
+		cfg.AlbumWait = d
+	}
+
+	if v := os.Getenv("FORWARD_DEBOUNCE"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			bad(errors.New("FORWARD_DEBOUNCE must be a duration (e.g. 5s, 0 to disable)"))
+		}
+		cfg.ForwardDebounce = d
+	}
+	if v := os.Getenv("LATE_EDITS"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			bad(errors.New("LATE_EDITS must be a duration (e.g. 24h, 0 to disable)"))
+		}
+		cfg.LateEdits = d
+	}
+
+	cfg.HandlerTimeout = 30 * time.Second
+	if v := os.Getenv("HANDLER_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			bad(errors.New("HANDLER_TIMEOUT must be a duration (e.g. 30s, 0 to disable)"))
+		}
+		cfg.HandlerTimeout = d
+	}
+	if cfg.ForwardDebounce > 0 && cfg.HandlerTimeout > 0 && cfg.ForwardDebounce >= cfg.HandlerTimeout {
+		// The window runs inside the handler, so every held lead would
+		// be abandoned before it is forwarded.
+		bad(errors.Errorf("FORWARD_DEBOUNCE (%s) must be shorter than HANDLER_TIMEOUT (%s)", cfg.ForwardDebounce, cfg.HandlerTimeout))
+	}
+
+	cfg.RateInterval, cfg.RateBurst = 100*time.Millisecond, 5
+	if v := os.Getenv("RATE_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			bad(errors.New("RATE_INTERVAL must be a positive duration (e.g. 100ms)"))
+		}
+		cfg.RateInterval = d
+	}
+	if v := os.Getenv("RATE_BURST"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			bad(errors.New("RATE_BURST must be a positive int"))
+		}
+		cfg.RateBurst = n
+	}
+
+	if v := os.Getenv("KEEPALIVE_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			bad(errors.New("KEEPALIVE_INTERVAL must be a duration (e.g. 5m)"))
+		}
+		cfg.KeepAliveInterval = d
+	}
+
+	if v := os.Getenv("CONTEXT_MESSAGES"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > 10 {
+			bad(errors.New("CONTEXT_MESSAGES must be an int from 0 to 10"))
+		}
+		cfg.ContextMessages = n
+	}
+
+	if v := os.Getenv("PER_CHAT_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d < 0 {
+			bad(errors.New("PER_CHAT_INTERVAL must be a duration (e.g. 10s)"))
+		}
+		cfg.PerChatInterval = d
+	}
+
+	for _, k := range strings.Split(os.Getenv("URGENT_KEYWORDS"), ",") {
+		if k = strings.ToLower(strings.TrimSpace(k)); k != "" {
+			cfg.UrgentKeywords = append(cfg.UrgentKeywords, k)
+		}
+	}
+	cfg.UrgentRecipient = os.Getenv("URGENT_RECIPIENT")
+	if isEmailRecipient(cfg.UrgentRecipient) && cfg.SMTP.Host == "" {
+		bad(errors.Errorf("URGENT_RECIPIENT %s needs SMTP_HOST", cfg.UrgentRecipient))
+	}
+
+	cfg.FallbackRecipient = os.Getenv("FALLBACK_RECIPIENT")
+	if isEmailRecipient(cfg.FallbackRecipient) && cfg.SMTP.Host == "" {
+		bad(errors.Errorf("FALLBACK_RECIPIENT %s needs SMTP_HOST", cfg.FallbackRecipient))
+	}
+
+	cfg.Location = time.Local
+	if tz := os.Getenv("TIMEZONE"); tz != "" {
+		if cfg.Location, err = time.LoadLocation(tz); err != nil {
+			bad(errors.Wrap(err, "TIMEZONE"))
+			cfg.Location = time.Local
+		}
+	}
+	cfg.ActiveHours, err = parseActiveHours(os.Getenv("ACTIVE_HOURS"), cfg.Location)
+	if err != nil {
+		bad(err)
+	}
+
+	cfg.TestMode = os.Getenv("TEST_MODE") == "true"
+	cfg.TestAdminUsername = os.Getenv("TEST_ADMIN_USERNAME")
+	switch {
+	case cfg.TestMode && cfg.TestAdminUsername == "":
+		bad(errors.New("TEST_MODE needs TEST_ADMIN_USERNAME"))
+	case cfg.TestMode && isEmailRecipient(cfg.TestAdminUsername):
+		bad(errors.New("TEST_ADMIN_USERNAME must be a Telegram username"))
+	case cfg.TestMode:
+		cfg.routeToTestAdmin()
+	}
+
+	if len(problems) > 0 {
+		return cfg, problems
+	}
+	return cfg, nil
+}
+
+// routeToTestAdmin points every recipient at TEST_ADMIN_USERNAME and
+// turns off the external sinks (SHEET_SINK, ALERT_WEBHOOK_URL and
+// ALERT_EMAIL), so classification runs for real but nothing reaches
+// production. Alerts still go to the test admin in Telegram.
+func (cfg *Config) routeToTestAdmin() {
+	cfg.ProdAdminUsername = cfg.AdminUsername
+	cfg.AdminUsername = cfg.TestAdminUsername
+	for i := range cfg.Campaigns {
+		cfg.Campaigns[i].Recipients = []string{cfg.TestAdminUsername}
+	}
+	cfg.UrgentRecipient = ""
+	cfg.FallbackRecipient = ""
+	cfg.SheetSink = ""
+	cfg.AlertWebhook = ""
+	cfg.AlertEmail = ""
+}
+
+// withRecipientRole fills in where recipient is configured on an
+// UnknownUsernameError.
+func (cfg Config) withRecipientRole(err error, recipient string) error {
+	var unknown *UnknownUsernameError
+	if !errors.As(err, &unknown) {
+		return err
+	}
+	var roles []string
+	if recipient == cfg.AdminUsername && cfg.TestMode {
+		roles = append(roles, "TEST_ADMIN_USERNAME")
+	} else if recipient == cfg.AdminUsername {
+		roles = append(roles, "ADMIN_USERNAME")
+	}
+	for _, c := range cfg.Campaigns {
+		for _, r := range c.Recipients {
+			if r == recipient && r != cfg.AdminUsername {
+				roles = append(roles, fmt.Sprintf("recipient of campaign %q", c.Name))
+			}
+		}
+	}
+	if recipient == cfg.UrgentRecipient {
+		roles = append(roles, "URGENT_RECIPIENT")
+	}
+	if recipient == cfg.FallbackRecipient {
+		roles = append(roles, "FALLBACK_RECIPIENT")
+	}
+	unknown.Role = strings.Join(roles, ", ")
+	return err
+}
+
+// recipients returns every configured recipient once, in order, starting
+// with the admin (the test admin in TEST_MODE): alerts, the self-test and
+// admin commands need it resolved even when no campaign delivers to it.
+func (cfg Config) recipients() []string {
+	var out []string
+	seen := map[string]bool{}
+	add := func(r string) {
+		if r != "" && !seen[r] {
+			seen[r] = true
+			out = append(out, r)
+		}
+	}
+	add(cfg.AdminUsername)
+	for _, c := range cfg.Campaigns {
+		for _, r := range c.Recipients {
+			add(r)
+		}
+	}
+	add(cfg.UrgentRecipient)
+	add(cfg.FallbackRecipient)
+	return out
+}
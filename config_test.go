@@ -0,0 +1,107 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestRecipients(t *testing.T) {
+	withCampaigns := func(cfg Config) Config {
+		cfg.Campaigns = []Campaign{
+			{Name: "development", Recipients: []string{"sales", "mailto:leads@example.com"}},
+			{Name: "design", Recipients: []string{"designer", "sales"}},
+		}
+		return cfg
+	}
+	testMode := withCampaigns(Config{AdminUsername: "admin", TestMode: true, TestAdminUsername: "tester", UrgentRecipient: "oncall"})
+	testMode.routeToTestAdmin()
+
+	for _, tt := range []struct {
+		name string
+		cfg  Config
+		want []string
+	}{
+		{name: "AdminOnly", cfg: testConfig(), want: []string{"admin"}},
+		{
+			name: "ExplicitRecipients",
+			cfg:  withCampaigns(Config{AdminUsername: "admin", UrgentRecipient: "oncall", FallbackRecipient: "sales"}),
+			want: []string{"admin", "sales", "mailto:leads@example.com", "designer", "oncall"},
+		},
+		{name: "TestMode", cfg: testMode, want: []string{"tester"}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cfg.recipients(); !slices.Equal(got, tt.want) {
+				t.Errorf("recipients = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// setRequiredEnv sets the variables loadConfig cannot do without.
+func setRequiredEnv(t *testing.T) {
+	t.Helper()
+	for k, v := range map[string]string{
+		"TG_PHONE":       "+10000000000",
+		"APP_ID":         "1",
+		"APP_HASH":       "hash",
+		"OPENAI_API_KEY": "sk-test",
+		"ADMIN_USERNAME": "@admin",
+	} {
+		t.Setenv(k, v)
+	}
+}
+
+func TestLoadConfigDebounceTimeout(t *testing.T) {
+	for _, tt := range []struct {
+		debounce, timeout string
+		ok                bool
+	}{
+		{debounce: "5s", ok: true},
+		{debounce: "30s"}, // the default HANDLER_TIMEOUT
+		{debounce: "45s", timeout: "1m", ok: true},
+		{debounce: "1m", timeout: "1m"},
+		{debounce: "1m", timeout: "0", ok: true},
+		{debounce: "0", timeout: "1s", ok: true},
+	} {
+		t.Run(tt.debounce+"/"+tt.timeout, func(t *testing.T) {
+			setRequiredEnv(t)
+			t.Setenv("FORWARD_DEBOUNCE", tt.debounce)
+			t.Setenv("HANDLER_TIMEOUT", tt.timeout)
+			_, err := loadConfig()
+			if tt.ok && err != nil {
+				t.Fatalf("loadConfig: %v", err)
+			}
+			if !tt.ok && (err == nil || !strings.Contains(err.Error(), "FORWARD_DEBOUNCE")) {
+				t.Fatalf("loadConfig = %v, want a FORWARD_DEBOUNCE error", err)
+			}
+		})
+	}
+}
+
+// TestLoadConfigTestMode checks that TEST_MODE keeps leads and alerts
+// away from the production sheet, webhook and mailbox.
+func TestLoadConfigTestMode(t *testing.T) {
+	setRequiredEnv(t)
+	for k, v := range map[string]string{
+		"TEST_MODE":           "true",
+		"TEST_ADMIN_USERNAME": "@tester",
+		"SMTP_HOST":           "smtp.example.com",
+		"SMTP_FROM":           "bot@example.com",
+		"SHEET_SINK":          "https://script.example.com/exec",
+		"ALERT_WEBHOOK_URL":   "https://hooks.example.com/alert",
+		"ALERT_EMAIL":         "oncall@example.com",
+	} {
+		t.Setenv(k, v)
+	}
+	cfg, err := loadConfig()
+	if err != nil {
+		t.Fatalf("loadConfig: %v", err)
+	}
+	if cfg.SheetSink != "" || cfg.AlertWebhook != "" || cfg.AlertEmail != "" {
+		t.Errorf("TEST_MODE keeps sinks: sheet %q, webhook %q, email %q", cfg.SheetSink, cfg.AlertWebhook, cfg.AlertEmail)
+	}
+	if got := cfg.recipients(); !slices.Equal(got, []string{cfg.TestAdminUsername}) {
+		t.Errorf("recipients = %v, want only the test admin", got)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// redacted shows whether a secret is set without revealing it.
+func redacted(s string) string {
+	if s == "" {
+		return "—"
+	}
+	return "<redacted>"
+}
+
+func orOff[T comparable](v T) string {
+	var zero T
+	if v == zero {
+		return "off"
+	}
+	return fmt.Sprint(v)
+}
+
+// Report renders the effective configuration for /config, one setting
+// per line under its environment name. Secrets are redacted.
+func (cfg Config) Report() string {
+	var b strings.Builder
+	line := func(name string, v any) { fmt.Fprintf(&b, "\n%s: %v", name, v) }
+
+	b.WriteString("Конфигурация:")
+	line("TG_PHONE", cfg.Phone)
+	line("APP_ID", cfg.AppID)
+	line("APP_HASH", redacted(cfg.AppHash))
+	line("OPENAI_API_KEYS", fmt.Sprintf("%d <redacted>", len(cfg.OpenAIKeys)))
+	line("TG_TEST", cfg.Test)
+	if cfg.TestMode {
+		line("TEST_MODE", fmt.Sprintf("true, all deliveries to %s instead of %s", cfg.TestAdminUsername, cfg.ProdAdminUsername))
+	} else {
+		line("TEST_MODE", false)
+	}
+	line("TG_DEVICE", fmt.Sprintf("%s %s (%s)", cfg.Device.DeviceModel, cfg.Device.AppVersion, cfg.Device.SystemLangCode))
+	line("SESSION_ENCRYPTION_KEY", redacted(cfg.SessionKey))
+	line("LOG_MAX_SIZE_MB", cfg.LogMaxSizeMB)
+	line("LOG_MAX_BACKUPS", orOff(cfg.LogMaxBackups))
+	line("LOG_MAX_AGE_DAYS", orOff(cfg.LogMaxAgeDays))
+	line("LOG_COMPRESS", cfg.LogCompress)
+
+	b.WriteString("\n\nКлассификация:")
+	line("model", textModel)
+	line("OPENAI_BASE_URL", orOff(cfg.OpenAIBaseURL))
+	line("OPENAI_ORG_ID", orOff(cfg.OpenAIOrg))
+	line("OPENAI_PROJECT_ID", orOff(cfg.OpenAIProject))
+	line("DAILY_TOKEN_BUDGET", orOff(cfg.DailyTokenBudget))
+	line("DAILY_SPEND_CAP_USD", orOff(cfg.DailySpendCapUSD))
+	if cfg.BreakerThreshold > 0 {
+		line("CB_FAILURE_THRESHOLD", fmt.Sprintf("%d (cooldown %s)", cfg.BreakerThreshold, cfg.BreakerCooldown))
+	} else {
+		line("CB_FAILURE_THRESHOLD", "off")
+	}
+	for _, c := range cfg.Campaigns {
+		line("campaign "+c.Name, strings.Join(c.Recipients, ", "))
+	}
+	match := "all"
+	if cfg.MatchFirst {
+		match = "first"
+	}
+	line("CAMPAIGN_MATCH", match)
+	line("EXAMPLES_FILE", orOff(cfg.ExamplesFile))
+	line("CLASSIFIER", cfg.Classifier)
+	line("REGEX_RULES_FILE", orOff(cfg.RegexRulesFile))
+	line("AMBIGUOUS_AS", cfg.AmbiguousAs)
+	line("EMPTY_RESPONSE", cfg.EmptyResponse)
+	line("VISION", fmt.Sprintf("%v (%s, max %d bytes)", cfg.Vision, cfg.VisionModel, cfg.VisionMaxBytes))
+	line("SHADOW_MODEL", orOff(cfg.ShadowModel))
+	line("SHADOW_PROMPT", cfg.ShadowPrompt != "")
+	line("CLASSIFY_CACHE_TTL", orOff(cfg.ClassifyCacheTTL))
+	line("SENDER_VERDICT_TTL", orOff(cfg.SenderVerdictTTL))
+	line("OPENAI_STRIP_URLS", cfg.StripURLs)
+	line("OPENAI_MAX_INPUT_CHARS", fmt.Sprintf("%d (tail %d)", cfg.MaxInputChars, cfg.InputTailChars))
+	line("CHUNK_LONG_MESSAGES", cfg.ChunkLongMessages)
+
+	b.WriteString("\n\nФильтры:")
+	line("PROCESS_OUTGOING", cfg.ProcessOutgoing)
+	line("INCLUDE_CHANNEL_POSTS", cfg.IncludeChannelPosts)
+	var ignored []string
+	for t := range cfg.IgnoreMediaTypes {
+		ignored = append(ignored, t)
+	}
+	sort.Strings(ignored)
+	line("IGNORE_MEDIA_TYPES", orOff(strings.Join(ignored, ",")))
+	line("IGNORE_MEDIA_KEEP_CAPTIONED", cfg.KeepCaptionedMedia)
+	line("INCLUDE_POLLS", cfg.IncludePolls)
+	line("IGNORE_FORWARDED", cfg.IgnoreForwarded)
+	watch := append([]string(nil), cfg.WatchSenderNames...)
+	for _, id := range cfg.WatchSenderIDs {
+		watch = append(watch, strconv.FormatInt(id, 10))
+	}
+	line("WATCH_SENDERS", orOff(strings.Join(watch, ", ")))
+	line("REQUIRE_REQUEST_SHAPE", cfg.RequireRequestShape)
+	var langs []string
+	for l := range cfg.Languages {
+		langs = append(langs, l)
+	}
+	sort.Strings(langs)
+	line("LANGUAGES", orOff(strings.Join(langs, ",")))
+	line("SKIP_ON_PEER_ERROR", cfg.SkipOnPeerError)
+	line("MONITOR_TOPICS", orOff(cfg.MonitorTopics.String()))
+	line("DEDUP_SCOPE", cfg.DedupScope)
+	line("MIN_SCORE", cfg.MinScore)
+	line("SCORE_THRESHOLD", cfg.ScoreFormula)
+	line("MIN_BUDGET", orOff(cfg.MinBudget.String()))
+	line("CHAT_CONFIDENCE", orOff(cfg.ChatConfidence.String()))
+	line("SENDER_COOLDOWN", orOff(cfg.SenderCooldown))
+	line("SPAM_WINDOW", cfg.SpamWindow)
+	line("SPAM_CHAT_THRESHOLD", orOff(cfg.SpamChatThreshold))
+	line("SPAM_CONTENT_WINDOW", orOff(cfg.SpamContentWindow))
+	line("URGENT_KEYWORDS", orOff(strings.Join(cfg.UrgentKeywords, ", ")))
+
+	b.WriteString("\n\nДоставка:")
+	line("SUMMARY_STYLE", cfg.SummaryStyle)
+	line("URGENT_RECIPIENT", orOff(cfg.UrgentRecipient))
+	line("FALLBACK_RECIPIENT", orOff(cfg.FallbackRecipient))
+	line("ACTIVE_HOURS", cfg.ActiveHours)
+	line("SMTP_HOST", orOff(cfg.SMTP.Host))
+	line("SMTP_PASSWORD", redacted(cfg.SMTP.Password))
+	line("ALERT_WEBHOOK_URL", redacted(cfg.AlertWebhook))
+	line("ALERT_EMAIL", orOff(cfg.AlertEmail))
+	line("SHEET_SINK", redactedSink(cfg.SheetSink))
+
+	b.WriteString("\n\nРежимы:")
+	line("STARTUP_SELFTEST", cfg.StartupSelfTest)
+	line("ORDERED", cfg.Ordered)
+	line("WORKERS", fmt.Sprintf("%d (queue %d, %s)", cfg.Workers, cfg.QueueSize, cfg.QueueFull))
+	line("OUTPUT_NDJSON", cfg.OutputNDJSON)
+	line("ALBUM_WAIT", orOff(cfg.AlbumWait))
+	line("FORWARD_DEBOUNCE", orOff(cfg.ForwardDebounce))
+	line("LATE_EDITS", orOff(cfg.LateEdits))
+	line("HANDLER_TIMEOUT", orOff(cfg.HandlerTimeout))
+	line("CONTEXT_MESSAGES", cfg.ContextMessages)
+	line("PER_CHAT_INTERVAL", orOff(cfg.PerChatInterval))
+	line("RATE_INTERVAL", fmt.Sprintf("%s (burst %d)", cfg.RateInterval, cfg.RateBurst))
+	line("KEEPALIVE_INTERVAL", orOff(cfg.KeepAliveInterval))
+	line("RECOVERED_AFTER", orOff(cfg.RecoveredAfter))
+	line("STARTUP_GRACE", orOff(cfg.StartupGrace))
+	line("STARTUP_JITTER", orOff(cfg.StartupJitter))
+	line("EARLY_MESSAGES", cfg.EarlyMessages)
+	line("CONFIG_RELOAD", orOff(cfg.ConfigReload))
+	return b.String()
+}
+
+// configCommand handles "/config": the configuration in effect (as of
+// the last CONFIG_RELOAD) plus the state that changes at runtime.
+func (a *App) configCommand() string {
+	var b strings.Builder
+	b.WriteString(a.live().Report())
+	fmt.Fprintf(&b, "\n\nСостояние:\ndry-run: %v\npaused: %v", a.dryRun, a.paused(time.Now()))
+
+	a.unreachableMu.Lock()
+	var unreachable []string
+	for r := range a.unreachable {
+		unreachable = append(unreachable, r)
+	}
+	a.unreachableMu.Unlock()
+	sort.Strings(unreachable)
+	if len(unreachable) > 0 {
+		fmt.Fprintf(&b, "\nunreachable: %s", strings.Join(unreachable, ", "))
+	}
+	return b.String()
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// contactsShown is how many senders /contacts lists.
+const contactsShown = 20
+
+// contact aggregates the stored leads of one sender.
+type contact struct {
+	FromID    int64
+	Username  string
+	Leads     int
+	FirstSeen time.Time
+	LastSeen  time.Time
+	// Campaign is the sender's best category: the campaign most of their
+	// leads matched, the highest-scoring one on a tie.
+	Campaign string
+
+	campaigns map[string]int
+	scores    map[string]int
+}
+
+// contactLedger groups leads by sender, skipping channel authors (posts
+// and messages sent as a channel) and unknown senders. Usernames are taken from the latest lead that has one.
+func contactLedger(leads []Lead) []*contact {
+	byID := map[int64]*contact{}
+	for _, l := range leads {
+		if l.FromID == 0 || l.FromKind == fromChannel {
+			continue
+		}
+		c, ok := byID[l.FromID]
+		if !ok {
+			c = &contact{
+				FromID:    l.FromID,
+				FirstSeen: l.CreatedAt,
+				campaigns: map[string]int{},
+				scores:    map[string]int{},
+			}
+			byID[l.FromID] = c
+		}
+		c.Leads++
+		if l.CreatedAt.Before(c.FirstSeen) {
+			c.FirstSeen = l.CreatedAt
+		}
+		if !l.CreatedAt.Before(c.LastSeen) {
+			c.LastSeen = l.CreatedAt
+			if l.Username != "" {
+				c.Username = l.Username
+			}
+		} else if c.Username == "" {
+			c.Username = l.Username
+		}
+		c.campaigns[l.Campaign]++
+		c.scores[l.Campaign] = max(c.scores[l.Campaign], l.Score)
+	}
+
+	contacts := make([]*contact, 0, len(byID))
+	for _, c := range byID {
+		for name, n := range c.campaigns {
+			best := c.campaigns[c.Campaign]
+			if c.Campaign == "" || n > best ||
+				n == best && (c.scores[name] > c.scores[c.Campaign] ||
+					c.scores[name] == c.scores[c.Campaign] && name < c.Campaign) {
+				c.Campaign = name
+			}
+		}
+		contacts = append(contacts, c)
+	}
+	return contacts
+}
+
+// sortContacts orders the ledger by the latest lead ("recent") or by the
+// number of leads ("frequent"), the other key breaking ties.
+func sortContacts(contacts []*contact, by string) {
+	sort.Slice(contacts, func(i, j int) bool {
+		a, b := contacts[i], contacts[j]
+		if by == "frequent" && a.Leads != b.Leads {
+			return a.Leads > b.Leads
+		}
+		if !a.LastSeen.Equal(b.LastSeen) {
+			return a.LastSeen.After(b.LastSeen)
+		}
+		if a.Leads != b.Leads {
+			return a.Leads > b.Leads
+		}
+		return a.FromID < b.FromID
+	})
+}
+
+// contactsCommand handles "/contacts [recent|frequent]": the unique
+// senders who produced leads, newest first by default.
+func (a *App) contactsCommand(ctx context.Context, args string) (string, error) {
+	by := "recent"
+	switch args {
+	case "", "recent":
+	case "frequent":
+		by = args
+	default:
+		return fmt.Sprintf("unknown sort %q, e.g. /contacts recent or /contacts frequent", args), nil
+	}
+	leads, err := a.leads.List(ctx)
+	if err != nil {
+		return "", err
+	}
+	contacts := contactLedger(leads)
+	if len(contacts) == 0 {
+		return "Нет лидов с известным автором", nil
+	}
+	sortContacts(contacts, by)
+
+	const layout = "02.01.2006"
+	var b strings.Builder
+	fmt.Fprintf(&b, "Контакты: %d", len(contacts))
+	if len(contacts) > contactsShown {
+		fmt.Fprintf(&b, " (первые %d)", contactsShown)
+		contacts = contacts[:contactsShown]
+	}
+	for i, c := range contacts {
+		name := c.Username
+		if name == "" {
+			name = "unknown"
+		}
+		fmt.Fprintf(&b, "\n%d. %s (ID: %d) — лидов: %d, %s–%s, %s",
+			i+1, name, c.FromID, c.Leads,
+			c.FirstSeen.In(a.cfg.Location).Format(layout),
+			c.LastSeen.In(a.cfg.Location).Format(layout),
+			c.Campaign)
+	}
+	return truncateRunes(b.String(), maxReplyRunes), nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/tg"
+)
+
+const (
+	contextMessageMax = 300  // runes per surrounding message
+	contextTotalMax   = 1500 // runes for all of them together
+)
+
+// surroundingMessages fetches up to n messages before and after msgID in
+// the chat, oldest first, trimmed to contextMessageMax runes each and
+// contextTotalMax overall.
+func (a *App) surroundingMessages(ctx context.Context, chatID int64, peer tg.InputPeerClass, msgID, n int) ([]string, error) {
+	if err := a.chatLimit.Wait(ctx, chatID); err != nil {
+		return nil, err
+	}
+	// offset_id returns messages older than it; a negative add_offset
+	// shifts the window n+1 messages newer, so msgID sits in the middle.
+	res, err := a.api.MessagesGetHistory(ctx, &tg.MessagesGetHistoryRequest{
+		Peer:      peer,
+		OffsetID:  msgID,
+		AddOffset: -(n + 1),
+		Limit:     2*n + 1,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "get history")
+	}
+	msgs, ok := res.(tg.ModifiedMessagesMessages)
+	if !ok {
+		return nil, nil
+	}
+
+	var out []string
+	total := 0
+	for _, m := range msgs.GetMessages() {
+		m, ok := m.(*tg.Message)
+		if !ok || m.ID == msgID || strings.TrimSpace(m.Message) == "" {
+			continue
+		}
+		text, _ := truncateInput(m.Message, contextMessageMax, 0)
+		if total += len([]rune(text)); total > contextTotalMax {
+			break
+		}
+		out = append(out, text)
+	}
+	slices.Reverse(out) // history comes newest first
+	return out, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+)
+
+// debouncer holds positively classified messages for FORWARD_DEBOUNCE so
+// an edit made right after posting is forwarded instead of the first
+// version. Edits of messages it is not holding are ignored, as before.
+type debouncer struct {
+	wait time.Duration
+
+	mu      sync.Mutex
+	pending map[debounceKey]chan *tg.Message
+}
+
+type debounceKey struct {
+	chatID int64
+	msgID  int
+}
+
+func newDebouncer(wait time.Duration) *debouncer {
+	return &debouncer{wait: wait, pending: map[debounceKey]chan *tg.Message{}}
+}
+
+func debounceKeyOf(msg *tg.Message) debounceKey {
+	return debounceKey{chatID: getChatID(msg.GetPeerID()), msgID: msg.ID}
+}
+
+// Await waits out the window for msg and returns its latest edit, if any.
+func (d *debouncer) Await(ctx context.Context, msg *tg.Message) (*tg.Message, bool) {
+	k := debounceKeyOf(msg)
+	edits := make(chan *tg.Message, 1)
+	d.mu.Lock()
+	d.pending[k] = edits
+	d.mu.Unlock()
+	defer func() {
+		d.mu.Lock()
+		delete(d.pending, k)
+		d.mu.Unlock()
+	}()
+
+	timer := time.NewTimer(d.wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+		return nil, false
+	}
+	select {
+	case edited := <-edits:
+		return edited, true
+	default:
+		return nil, false
+	}
+}
+
+// Edited hands an edit to the message's pending window, replacing an
+// earlier edit. It reports whether the message was being held.
+func (d *debouncer) Edited(msg *tg.Message) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	edits, ok := d.pending[debounceKeyOf(msg)]
+	if !ok {
+		return false
+	}
+	select {
+	case <-edits:
+	default:
+	}
+	edits <- msg
+	return true
+}
+
+type debouncedKey struct{}
+
+// handleEdit passes message edits to the debouncer, or rechecks them
+// with LATE_EDITS when no window is holding the message.
+func (a *App) handleEdit(ctx context.Context, msg *tg.Message) error {
+	if a.debounce == nil || !a.debounce.Edited(msg) {
+		return a.recheckEdit(ctx, msg)
+	}
+	a.lg.Info("Lead edited during debounce",
+		zap.Int64("chat_id", getChatID(msg.GetPeerID())),
+		zap.Int("msg_id", msg.ID),
+	)
+	return nil
+}
+
+// awaitEdits holds a positively classified message for FORWARD_DEBOUNCE.
+// If it was edited meanwhile the final version is processed from scratch,
+// without another window, and true is returned so the caller stops.
+func (a *App) awaitEdits(ctx context.Context, msg *tg.Message) (bool, error) {
+	if a.debounce == nil || ctx.Value(debouncedKey{}) != nil {
+		return false, nil
+	}
+	edited, ok := a.debounce.Await(ctx, msg)
+	if ctx.Err() != nil {
+		return true, ctx.Err()
+	}
+	if !ok {
+		return false, nil
+	}
+	return true, a.processMessage(context.WithValue(ctx, debouncedKey{}, true), edited)
+}
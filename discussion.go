@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/contrib/storage"
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+)
+
+// channelPost identifies a post in a broadcast channel.
+type channelPost struct {
+	channelID int64
+	postID    int
+}
+
+// autoForwardedPost reports whether msg is the copy of a channel post
+// that Telegram places in the channel's linked discussion group, and
+// which post it copies.
+func autoForwardedPost(msg *tg.Message) (channelPost, bool) {
+	fwd, ok := msg.GetFwdFrom()
+	if !ok {
+		return channelPost{}, false
+	}
+	from, ok := fwd.GetSavedFromPeer()
+	if !ok {
+		return channelPost{}, false
+	}
+	post, ok := fwd.GetSavedFromMsgID()
+	ch, isChannel := from.(*tg.PeerChannel)
+	if !ok || !isChannel {
+		return channelPost{}, false
+	}
+	if fc, ok := msg.FromID.(*tg.PeerChannel); !ok || fc.ChannelID != ch.ChannelID {
+		return channelPost{}, false
+	}
+	return channelPost{channelID: ch.ChannelID, postID: post}, true
+}
+
+// isDiscussionGroup reports whether p is a supergroup linked to a channel
+// as its comment section.
+func isDiscussionGroup(p storage.Peer) bool {
+	return p.Channel != nil && p.Channel.Megagroup && p.Channel.HasLink
+}
+
+// threadRoots caches which channel post a discussion thread belongs to,
+// zero when the thread root is not a channel post. Cleared when it grows
+// past threadRootsMax.
+type threadRoots struct {
+	mu    sync.Mutex
+	posts map[channelPost]channelPost // {group, root message} → post
+}
+
+const threadRootsMax = 10000
+
+func (t *threadRoots) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.posts = nil
+}
+
+func (t *threadRoots) get(k channelPost) (channelPost, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	v, ok := t.posts[k]
+	return v, ok
+}
+
+func (t *threadRoots) put(k, v channelPost) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.posts == nil || len(t.posts) >= threadRootsMax {
+		t.posts = map[channelPost]channelPost{}
+	}
+	t.posts[k] = v
+}
+
+// leadOrigin returns the chat, message and link a lead is stored under.
+// The discussion group's copy of a channel post counts as the post
+// itself, so it is deduplicated against it; comments link to the comment
+// under the channel post. Everything else keeps its own chat and message.
+func (a *App) leadOrigin(ctx context.Context, p storage.Peer, msg *tg.Message) (int64, int, string) {
+	if post, ok := autoForwardedPost(msg); ok {
+		return post.channelID, post.postID, a.postLink(ctx, post, 0)
+	}
+	if isDiscussionGroup(p) {
+		if post, ok := a.commentedPost(ctx, p, msg); ok {
+			return p.Key.ID, msg.ID, a.postLink(ctx, post, msg.ID)
+		}
+	}
+	return p.Key.ID, msg.ID, messageLink(p, msg.ID)
+}
+
+// commentedPost finds the channel post a discussion group message
+// comments on, from the root of its reply thread.
+func (a *App) commentedPost(ctx context.Context, p storage.Peer, msg *tg.Message) (channelPost, bool) {
+	reply, ok := msg.ReplyTo.(*tg.MessageReplyHeader)
+	if !ok {
+		return channelPost{}, false
+	}
+	root, ok := reply.GetReplyToTopID()
+	if !ok {
+		if root, ok = reply.GetReplyToMsgID(); !ok {
+			return channelPost{}, false
+		}
+	}
+	k := channelPost{channelID: p.Key.ID, postID: root}
+	if post, ok := a.threads.get(k); ok {
+		return post, post.channelID != 0
+	}
+
+	post, err := a.fetchThreadRoot(ctx, p, root)
+	if err != nil {
+		a.lg.Info("Comment thread root unavailable", zap.Int64("chat_id", p.Key.ID), zap.Int("root", root), zap.Error(err))
+		return channelPost{}, false
+	}
+	a.threads.put(k, post)
+	return post, post.channelID != 0
+}
+
+func (a *App) fetchThreadRoot(ctx context.Context, p storage.Peer, root int) (channelPost, error) {
+	m, err := a.getMessage(ctx, p, root)
+	if err != nil || m == nil {
+		return channelPost{}, errors.Wrap(err, "get thread root")
+	}
+	post, _ := autoForwardedPost(m)
+	return post, nil
+}
+
+// postLink links to a channel post, or to a comment under it when
+// comment is non-zero.
+func (a *App) postLink(ctx context.Context, post channelPost, comment int) string {
+	link := fmt.Sprintf("https://t.me/c/%d/%d", post.channelID, post.postID)
+	if cp, err := storage.FindPeer(ctx, a.peerDB, &tg.PeerChannel{ChannelID: post.channelID}); err == nil &&
+		cp.Channel != nil && cp.Channel.Username != "" {
+		link = fmt.Sprintf("https://t.me/%s/%d", cp.Channel.Username, post.postID)
+	}
+	if comment != 0 {
+		link += fmt.Sprintf("?comment=%d", comment)
+	}
+	return link
+}
+
+// channelAuthor attributes a message sent on behalf of a channel other
+// than the chat it is in, e.g. a comment posted as the commenter's
+// channel or the discussion group's copy of a post.
+func (a *App) channelAuthor(ctx context.Context, msg *tg.Message) (int64, string, bool) {
+	fc, ok := msg.FromID.(*tg.PeerChannel)
+	if !ok || fc.ChannelID == getChatID(msg.PeerID) {
+		return 0, "", false
+	}
+	name := "channel"
+	if cp, err := storage.FindPeer(ctx, a.peerDB, fc); err == nil {
+		name = channelName(cp)
+	}
+	return fc.ChannelID, name, true
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gotd/contrib/storage"
+	"github.com/gotd/td/tg"
+)
+
+const (
+	testChannelID    = 10 // public broadcast channel @news
+	testDiscussionID = 20 // its linked comment section
+	testAuthorID     = 40 // a channel users comment as, @blog
+)
+
+// addChannelPeer stores a channel or supergroup in the app's peer storage
+// and returns it.
+func addChannelPeer(t *testing.T, a *App, ch *tg.Channel) storage.Peer {
+	t.Helper()
+	if ch.Photo == nil {
+		ch.Photo = &tg.ChatPhotoEmpty{}
+	}
+	var p storage.Peer
+	if !p.FromChat(ch) {
+		t.Fatalf("channel %d is not storable", ch.ID)
+	}
+	if err := a.peerDB.Add(context.Background(), p); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// discussionApp has @news, its discussion group and the @blog channel in
+// peer storage.
+func discussionApp(t *testing.T, cfg Config, cls Classifier) (a *App, group storage.Peer) {
+	a = newTestApp(t, cfg, cls)
+	addChannelPeer(t, a, &tg.Channel{ID: testChannelID, AccessHash: 1, Username: "news", Title: "News", Broadcast: true})
+	addChannelPeer(t, a, &tg.Channel{ID: testAuthorID, AccessHash: 3, Username: "blog", Title: "Blog", Broadcast: true})
+	group = addChannelPeer(t, a, &tg.Channel{ID: testDiscussionID, AccessHash: 2, Title: "News chat", Megagroup: true, HasLink: true})
+	return a, group
+}
+
+// discussionCopy is the discussion group's automatic copy of a channel
+// post.
+func discussionCopy(id, post int, text string) *tg.Message {
+	msg := &tg.Message{
+		ID:      id,
+		PeerID:  &tg.PeerChannel{ChannelID: testDiscussionID},
+		FromID:  &tg.PeerChannel{ChannelID: testChannelID},
+		Message: text,
+	}
+	fwd := tg.MessageFwdHeader{FromID: &tg.PeerChannel{ChannelID: testChannelID}, ChannelPost: post}
+	fwd.SetSavedFromPeer(&tg.PeerChannel{ChannelID: testChannelID})
+	fwd.SetSavedFromMsgID(post)
+	msg.SetFwdFrom(fwd)
+	return msg
+}
+
+// comment is a user's comment in the discussion group's thread rooted at
+// root.
+func comment(id, root int, from tg.PeerClass) *tg.Message {
+	reply := &tg.MessageReplyHeader{}
+	reply.SetReplyToMsgID(root)
+	reply.SetReplyToTopID(root)
+	return &tg.Message{
+		ID:      id,
+		PeerID:  &tg.PeerChannel{ChannelID: testDiscussionID},
+		FromID:  from,
+		ReplyTo: reply,
+		Message: "нужен разработчик",
+	}
+}
+
+func TestAutoForwardedPost(t *testing.T) {
+	forwardedByUser := discussionCopy(7, 5, "")
+	forwardedByUser.FromID = &tg.PeerUser{UserID: 1}
+	fromUser := &tg.Message{ID: 8, PeerID: &tg.PeerChannel{ChannelID: testDiscussionID}, FromID: &tg.PeerChannel{ChannelID: testChannelID}}
+	fwd := tg.MessageFwdHeader{}
+	fwd.SetSavedFromPeer(&tg.PeerUser{UserID: 1})
+	fwd.SetSavedFromMsgID(5)
+	fromUser.SetFwdFrom(fwd)
+
+	for _, tt := range []struct {
+		name string
+		msg  *tg.Message
+		post channelPost
+		ok   bool
+	}{
+		{name: "Copy", msg: discussionCopy(7, 5, ""), post: channelPost{channelID: testChannelID, postID: 5}, ok: true},
+		{name: "Plain", msg: groupMessage(testDiscussionID, 1, 7, "text")},
+		{name: "Comment", msg: comment(7, 6, &tg.PeerUser{UserID: 1})},
+		{name: "ForwardedByUser", msg: forwardedByUser},
+		{name: "SavedFromUser", msg: fromUser},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			post, ok := autoForwardedPost(tt.msg)
+			if ok != tt.ok || post != tt.post {
+				t.Errorf("autoForwardedPost = %+v, %v; want %+v, %v", post, ok, tt.post, tt.ok)
+			}
+		})
+	}
+}
+
+func TestLeadOrigin(t *testing.T) {
+	a, group := discussionApp(t, testConfig(), RegexClassifier{})
+	// Thread roots are fetched from Telegram; seed the cache instead.
+	a.threads.put(channelPost{channelID: testDiscussionID, postID: 6}, channelPost{channelID: testChannelID, postID: 5})
+	a.threads.put(channelPost{channelID: testDiscussionID, postID: 50}, channelPost{})
+	plain := addChannelPeer(t, a, &tg.Channel{ID: 30, AccessHash: 4, Title: "Freelance", Megagroup: true})
+
+	for _, tt := range []struct {
+		name   string
+		peer   storage.Peer
+		msg    *tg.Message
+		chatID int64
+		msgID  int
+		link   string
+	}{
+		{
+			name: "PostCopy", peer: group, msg: discussionCopy(6, 5, "пост"),
+			chatID: testChannelID, msgID: 5, link: "https://t.me/news/5",
+		},
+		{
+			name: "Comment", peer: group, msg: comment(90, 6, &tg.PeerUser{UserID: 1}),
+			chatID: testDiscussionID, msgID: 90, link: "https://t.me/news/5?comment=90",
+		},
+		{
+			name: "CommentAsChannel", peer: group, msg: comment(91, 6, &tg.PeerChannel{ChannelID: testAuthorID}),
+			chatID: testDiscussionID, msgID: 91, link: "https://t.me/news/5?comment=91",
+		},
+		{
+			name: "ThreadNotOnPost", peer: group, msg: comment(92, 50, &tg.PeerUser{UserID: 1}),
+			chatID: testDiscussionID, msgID: 92, link: "https://t.me/c/20/92",
+		},
+		{
+			name: "TopLevelInGroup", peer: group, msg: groupMessage(testDiscussionID, 1, 93, "text"),
+			chatID: testDiscussionID, msgID: 93, link: "https://t.me/c/20/93",
+		},
+		{
+			name: "OrdinarySupergroup", peer: plain, msg: comment(1, 6, &tg.PeerUser{UserID: 1}),
+			chatID: 30, msgID: 1, link: "https://t.me/c/30/1",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			chatID, msgID, link := a.leadOrigin(context.Background(), tt.peer, tt.msg)
+			if chatID != tt.chatID || msgID != tt.msgID || link != tt.link {
+				t.Errorf("leadOrigin = %d, %d, %q; want %d, %d, %q", chatID, msgID, link, tt.chatID, tt.msgID, tt.link)
+			}
+		})
+	}
+}
+
+func TestChannelAuthor(t *testing.T) {
+	a, _ := discussionApp(t, testConfig(), RegexClassifier{})
+	for _, tt := range []struct {
+		name string
+		msg  *tg.Message
+		id   int64
+		user string
+		ok   bool
+	}{
+		{name: "AsChannel", msg: comment(1, 6, &tg.PeerChannel{ChannelID: testAuthorID}), id: testAuthorID, user: "@blog", ok: true},
+		{name: "PostCopy", msg: discussionCopy(2, 5, ""), id: testChannelID, user: "@news", ok: true},
+		{name: "UnknownChannel", msg: comment(3, 6, &tg.PeerChannel{ChannelID: 99}), id: 99, user: "channel", ok: true},
+		{name: "User", msg: comment(4, 6, &tg.PeerUser{UserID: 1})},
+		{name: "AnonymousAdmin", msg: comment(5, 6, &tg.PeerChannel{ChannelID: testDiscussionID})},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			id, user, ok := a.channelAuthor(context.Background(), tt.msg)
+			if id != tt.id || user != tt.user || ok != tt.ok {
+				t.Errorf("channelAuthor = %d, %q, %v; want %d, %q, %v", id, user, ok, tt.id, tt.user, tt.ok)
+			}
+		})
+	}
+}
+
+// TestDiscussionCopyDeduplicated checks that the discussion group's copy
+// of a channel post is stored under the post and not turned into a
+// second lead.
+func TestDiscussionCopyDeduplicated(t *testing.T) {
+	cfg := testConfig()
+	cfg.IncludeChannelPosts = true
+	a, _ := discussionApp(t, cfg, OpenAIClassifier{client: &fakeCompleter{resp: answer("true")}, model: textModel})
+	ctx := context.Background()
+
+	post := &tg.Message{ID: 5, Post: true, PeerID: &tg.PeerChannel{ChannelID: testChannelID}, Message: "Ищем Go-разработчика"}
+	for _, msg := range []*tg.Message{post, discussionCopy(6, 5, post.Message)} {
+		if err := a.processMessage(ctx, msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	leads, err := a.leads.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leads) != 1 {
+		t.Fatalf("got %d leads, want 1: %+v", len(leads), leads)
+	}
+	l := leads[0]
+	if l.ChatID != testChannelID || l.MsgID != 5 || l.FromID != testChannelID || l.Username != "@news" || l.Link != "https://t.me/news/5" {
+		t.Errorf("lead = chat %d msg %d from %d %q link %q", l.ChatID, l.MsgID, l.FromID, l.Username, l.Link)
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"sync"
+
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+)
+
+// EarlyMessages is how messages that arrive while startup peer
+// collection is still running are handled.
+type EarlyMessages string
+
+const (
+	// EarlyEnrich processes them at once, looking up senders missing from
+	// peer storage on demand (rate-limited, so some may stay unknown).
+	EarlyEnrich EarlyMessages = "enrich"
+	// EarlyBuffer holds them until collection finishes, then processes
+	// them in arrival order.
+	EarlyBuffer EarlyMessages = "buffer"
+)
+
+// earlyBufferMax bounds the messages held during peer collection; the
+// oldest are dropped beyond it.
+const earlyBufferMax = 1000
+
+// earlyBuffer holds messages until Release.
+type earlyBuffer struct {
+	mu       sync.Mutex
+	msgs     []*tg.Message
+	dropped  int
+	released bool
+}
+
+// Hold buffers msg and reports true, or reports false once released.
+func (b *earlyBuffer) Hold(msg *tg.Message) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.released {
+		return false
+	}
+	if len(b.msgs) >= earlyBufferMax {
+		b.msgs = b.msgs[1:]
+		b.dropped++
+	}
+	b.msgs = append(b.msgs, msg)
+	return true
+}
+
+// Release stops buffering and returns the held messages and how many
+// were dropped.
+func (b *earlyBuffer) Release() ([]*tg.Message, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.released = true
+	msgs := b.msgs
+	b.msgs = nil
+	return msgs, b.dropped
+}
+
+// releaseEarly processes the messages buffered during peer collection.
+func (a *App) releaseEarly(ctx context.Context) {
+	if a.early == nil {
+		return
+	}
+	msgs, dropped := a.early.Release()
+	if dropped > 0 {
+		a.lg.Warn("Early message buffer overflowed", zap.Int("dropped", dropped))
+	}
+	if len(msgs) == 0 {
+		return
+	}
+	a.lg.Info("Processing messages buffered during peer collection", zap.Int("count", len(msgs)))
+	for _, msg := range msgs {
+		if err := a.dispatchMessage(ctx, msg); err != nil {
+			a.lg.Error("Buffered message", zap.Int("msg_id", msg.ID), zap.Error(err))
+		}
+	}
+}
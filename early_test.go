@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gotd/contrib/storage"
+	"github.com/gotd/td/tg"
+)
+
+func TestEarlyBuffer(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		held    int
+		kept    int
+		dropped int
+		firstID int
+	}{
+		{name: "Empty"},
+		{name: "Some", held: 3, kept: 3, firstID: 1},
+		{name: "Full", held: earlyBufferMax, kept: earlyBufferMax, firstID: 1},
+		{name: "Overflow", held: earlyBufferMax + 5, kept: earlyBufferMax, dropped: 5, firstID: 6},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var b earlyBuffer
+			for i := 1; i <= tt.held; i++ {
+				if !b.Hold(groupMessage(1, 2, i, "text")) {
+					t.Fatalf("message %d not held before release", i)
+				}
+			}
+			msgs, dropped := b.Release()
+			if len(msgs) != tt.kept || dropped != tt.dropped {
+				t.Fatalf("Release = %d messages, %d dropped; want %d, %d", len(msgs), dropped, tt.kept, tt.dropped)
+			}
+			if len(msgs) > 0 && (msgs[0].ID != tt.firstID || msgs[len(msgs)-1].ID != tt.held) {
+				t.Errorf("held messages %d..%d, want %d..%d", msgs[0].ID, msgs[len(msgs)-1].ID, tt.firstID, tt.held)
+			}
+			if b.Hold(groupMessage(1, 2, tt.held+1, "text")) {
+				t.Error("message held after release")
+			}
+		})
+	}
+}
+
+// TestEarlyMessages sends a lead from a sender peer collection has not
+// stored yet. Buffered, it is processed once the sender is known;
+// enriched, it is processed at once and, with no lookup possible, stays
+// unattributed.
+func TestEarlyMessages(t *testing.T) {
+	for _, tt := range []struct {
+		mode     EarlyMessages
+		username string
+	}{
+		{mode: EarlyBuffer, username: "@alice"},
+		{mode: EarlyEnrich, username: "unknown"},
+	} {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			cfg := testConfig()
+			cfg.EarlyMessages = tt.mode
+			f := &fakeCompleter{resp: answer("true")}
+			a := newTestApp(t, cfg, OpenAIClassifier{client: f, model: textModel})
+			if tt.mode == EarlyBuffer {
+				a.early = &earlyBuffer{}
+			}
+			ctx := context.Background()
+
+			if err := a.dispatchMessage(ctx, groupMessage(100, 200, 1, "Ищем Go-разработчика")); err != nil {
+				t.Fatal(err)
+			}
+			if buffered := f.Calls() == 0; buffered != (tt.mode == EarlyBuffer) {
+				t.Fatalf("classified during collection: %v", !buffered)
+			}
+
+			// Peer collection reaches the sender, then finishes.
+			var p storage.Peer
+			p.FromUser(&tg.User{ID: 200, AccessHash: 1, Username: "alice", Photo: &tg.UserProfilePhotoEmpty{}, Status: &tg.UserStatusEmpty{}})
+			if err := a.peerDB.Add(ctx, p); err != nil {
+				t.Fatal(err)
+			}
+			a.releaseEarly(ctx)
+
+			leads, err := a.leads.List(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(leads) != 1 {
+				t.Fatalf("got %d leads, want 1", len(leads))
+			}
+			if leads[0].Username != tt.username {
+				t.Errorf("Username = %q, want %q", leads[0].Username, tt.username)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	pebbledb "github.com/cockroachdb/pebble"
+	"github.com/go-faster/errors"
+	"go.uber.org/zap"
+)
+
+const mailtoPrefix = "mailto:"
+
+func isEmailRecipient(r string) bool {
+	return strings.HasPrefix(r, mailtoPrefix)
+}
+
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+	From     string
+}
+
+type mailJob struct {
+	to      string
+	subject string
+	body    string
+	leadID  uint64
+}
+
+// storedMail is a mailJob as persisted in pebble.
+type storedMail struct {
+	To      string
+	Subject string
+	Body    string
+	LeadID  uint64
+}
+
+// Mailer delivers lead notifications by email on its own goroutine, so a
+// slow or failing SMTP server never blocks the Telegram path. Jobs wait
+// in pebble until sent, so a restart does not lose them; onSent runs once
+// the SMTP server has accepted one.
+type Mailer struct {
+	cfg    SMTPConfig
+	db     *pebbledb.DB
+	lg     *zap.Logger
+	out    io.Writer
+	onSent func(context.Context, mailJob)
+	// wake tells Run a job was enqueued.
+	wake chan struct{}
+}
+
+const mailAttempts = 3
+
+var mailPrefix = []byte("mail/")
+
+func NewMailer(cfg SMTPConfig, db *pebbledb.DB, lg *zap.Logger, out io.Writer, onSent func(context.Context, mailJob)) *Mailer {
+	return &Mailer{cfg: cfg, db: db, lg: lg, out: out, onSent: onSent, wake: make(chan struct{}, 1)}
+}
+
+func mailKey(j mailJob) []byte {
+	return []byte(fmt.Sprintf("%s%020d/%s", mailPrefix, j.leadID, j.to))
+}
+
+// Enqueue stores an email for delivery.
+func (m *Mailer) Enqueue(j mailJob) error {
+	data, err := json.Marshal(storedMail{To: j.to, Subject: j.subject, Body: j.body, LeadID: j.leadID})
+	if err != nil {
+		return errors.Wrap(err, "encode mail")
+	}
+	if err := m.db.Set(mailKey(j), data, pebbledb.Sync); err != nil {
+		return errors.Wrap(err, "queue mail")
+	}
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Run delivers queued emails, starting with those left from before a
+// restart, until ctx is done.
+func (m *Mailer) Run(ctx context.Context) {
+	for {
+		m.deliverPending(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.wake:
+		}
+	}
+}
+
+// pending returns the queued emails in lead order.
+func (m *Mailer) pending() ([]mailJob, error) {
+	iter, err := m.db.NewIter(&pebbledb.IterOptions{
+		LowerBound: mailPrefix,
+		UpperBound: []byte("mail0"), // '0' follows '/'
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "mail iter")
+	}
+	defer iter.Close()
+
+	var jobs []mailJob
+	for iter.First(); iter.Valid(); iter.Next() {
+		var s storedMail
+		if err := json.Unmarshal(iter.Value(), &s); err != nil {
+			m.lg.Error("Decode queued mail", zap.ByteString("key", iter.Key()), zap.Error(err))
+			continue
+		}
+		jobs = append(jobs, mailJob{to: s.To, subject: s.Subject, body: s.Body, leadID: s.LeadID})
+	}
+	return jobs, iter.Error()
+}
+
+func (m *Mailer) deliverPending(ctx context.Context) {
+	jobs, err := m.pending()
+	if err != nil {
+		m.lg.Error("List queued mail", zap.Error(err))
+		return
+	}
+	for _, j := range jobs {
+		if !m.deliver(ctx, j) {
+			// Shutting down: the job stays queued for the next start.
+			return
+		}
+		if err := m.db.Delete(mailKey(j), pebbledb.Sync); err != nil {
+			m.lg.Error("Remove queued mail", zap.String("to", j.to), zap.Uint64("lead_id", j.leadID), zap.Error(err))
+		}
+	}
+}
+
+// deliver sends j, retrying with backoff, and reports whether it is done
+// with the job: sent, or failed every attempt. It returns false only when
+// ctx ends first.
+func (m *Mailer) deliver(ctx context.Context, j mailJob) bool {
+	delay := 5 * time.Second
+	for attempt := 1; ; attempt++ {
+		err := m.send(j)
+		if err == nil {
+			m.lg.Info("Lead emailed", zap.String("to", j.to), zap.Uint64("lead_id", j.leadID))
+			fmt.Fprintf(m.out, "Emailed lead #%d to %s\n", j.leadID, j.to)
+			if m.onSent != nil {
+				m.onSent(ctx, j)
+			}
+			return true
+		}
+		m.lg.Warn("Send email", zap.String("to", j.to), zap.Uint64("lead_id", j.leadID), zap.Int("attempt", attempt), zap.Error(err))
+		if attempt == mailAttempts {
+			fmt.Fprintf(m.out, "email to %s: %v\n", j.to, err)
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// mailSent records a lead email the SMTP server accepted, as forward does
+// for a Telegram delivery.
+func (a *App) mailSent(ctx context.Context, j mailJob) {
+	recipient := mailtoPrefix + j.to
+	a.stats.IncForwarded()
+	if err := a.leads.MarkForwarded(ctx, j.leadID, recipient); err != nil {
+		a.lg.Warn("Mark lead forwarded", zap.Uint64("lead_id", j.leadID), zap.Error(err))
+	}
+	lead, err := a.leads.Get(ctx, j.leadID)
+	if err != nil {
+		a.lg.Warn("Get emailed lead", zap.Uint64("lead_id", j.leadID), zap.Error(err))
+		return
+	}
+	a.sheet.Append(lead, recipient, j.body)
+}
+
+func (m *Mailer) send(j mailJob) error {
+	addr := net.JoinHostPort(m.cfg.Host, strconv.Itoa(m.cfg.Port))
+	var auth smtp.Auth
+	if m.cfg.User != "" {
+		auth = smtp.PlainAuth("", m.cfg.User, m.cfg.Password, m.cfg.Host)
+	}
+	msg := "From: " + m.cfg.From + "\r\n" +
+		"To: " + j.to + "\r\n" +
+		"Subject: " + mime.QEncoding.Encode("utf-8", j.subject) + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" + strings.ReplaceAll(j.body, "\n", "\r\n")
+	return smtp.SendMail(addr, auth, m.cfg.From, []string{j.to}, []byte(msg))
+}
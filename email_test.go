@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"io"
+	"slices"
+	"testing"
+
+	pebbledb "github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/vfs"
+	"go.uber.org/zap"
+)
+
+// TestMailerQueue checks that queued emails live in the database, so a
+// mailer started after a restart finds them.
+func TestMailerQueue(t *testing.T) {
+	db, err := pebbledb.Open("", &pebbledb.Options{FS: vfs.NewMem()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	m := NewMailer(SMTPConfig{}, db, zap.NewNop(), io.Discard, nil)
+	jobs := []mailJob{
+		{to: "b@example.com", subject: "Lead #2: dev", body: "второй", leadID: 2},
+		{to: "a@example.com", subject: "Lead #1: dev", body: "первый", leadID: 1},
+		{to: "b@example.com", subject: "Lead #1: dev", body: "первый", leadID: 1},
+	}
+	for _, j := range jobs {
+		if err := m.Enqueue(j); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Enqueuing the same email again does not send it twice.
+	if err := m.Enqueue(jobs[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	restarted := NewMailer(SMTPConfig{}, db, zap.NewNop(), io.Discard, nil)
+	got, err := restarted.pending()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []mailJob{jobs[1], jobs[2], jobs[0]}; !slices.Equal(got, want) {
+		t.Errorf("pending = %+v, want %+v", got, want)
+	}
+
+	// A mailer stopping mid-retry keeps the job queued.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	restarted.cfg = SMTPConfig{Host: "127.0.0.1", Port: 1}
+	restarted.deliverPending(ctx)
+	if left, _ := restarted.pending(); len(left) != len(jobs) {
+		t.Errorf("%d emails left after shutdown, want %d", len(left), len(jobs))
+	}
+}
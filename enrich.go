@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/gotd/contrib/storage"
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+	"golang.org/x/time/rate"
+)
+
+// senderLookupRate limits on-demand sender lookups, which mostly happen
+// right after startup before peer collection has caught up.
+var senderLookupRate = rate.Every(time.Second)
+
+// lookupSender fetches a sender missing from peer storage with
+// users.getUsers, addressing them through the message they sent, and
+// stores them so later messages find them. It returns nil when the
+// lookup is rate-limited or fails.
+func (a *App) lookupSender(ctx context.Context, chat tg.InputPeerClass, msgID int, userID int64) *tg.User {
+	if !a.senderLookups.Allow() {
+		return nil
+	}
+	users, err := a.api.UsersGetUsers(ctx, []tg.InputUserClass{
+		&tg.InputUserFromMessage{Peer: chat, MsgID: msgID, UserID: userID},
+	})
+	if err != nil {
+		a.lg.Debug("Sender lookup", zap.Int64("user_id", userID), zap.Error(err))
+		return nil
+	}
+	for _, u := range users {
+		user, ok := u.(*tg.User)
+		if !ok || user.ID != userID {
+			continue
+		}
+		var p storage.Peer
+		if p.FromUser(user) {
+			if err := a.peerDB.Add(ctx, p); err != nil {
+				a.lg.Warn("Store looked-up sender", zap.Int64("user_id", userID), zap.Error(err))
+			}
+		}
+		return user
+	}
+	return nil
+}
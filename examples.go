@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-faster/errors"
+)
+
+// FewShotExamples are labeled example messages injected into campaign
+// prompts from EXAMPLES_FILE.
+type FewShotExamples struct {
+	// all apply to every campaign, byCampaign only to the named one.
+	all        fewShotSet
+	byCampaign map[string]fewShotSet
+}
+
+type fewShotSet struct {
+	relevant, irrelevant []string
+}
+
+func (s fewShotSet) len() int { return len(s.relevant) + len(s.irrelevant) }
+
+// Count returns the number of examples loaded.
+func (e FewShotExamples) Count() int {
+	n := e.all.len()
+	for _, s := range e.byCampaign {
+		n += s.len()
+	}
+	return n
+}
+
+// loadExamples reads an examples file. Each line is "+ text" for a
+// relevant or "- text" for an irrelevant example; "[name]" starts a
+// section for one campaign, and lines before any section apply to all.
+// Blank lines and lines starting with "#" are ignored.
+func loadExamples(path string, campaigns []Campaign) (FewShotExamples, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return FewShotExamples{}, errors.Wrap(err, "EXAMPLES_FILE")
+	}
+	defer f.Close()
+
+	known := map[string]bool{}
+	for _, c := range campaigns {
+		known[c.Name] = true
+	}
+	e := FewShotExamples{byCampaign: map[string]fewShotSet{}}
+	section := ""
+	sc := bufio.NewScanner(f)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if name, ok := strings.CutPrefix(line, "["); ok && strings.HasSuffix(name, "]") {
+			section = strings.TrimSpace(strings.TrimSuffix(name, "]"))
+			if !known[section] {
+				return e, errors.Errorf("EXAMPLES_FILE line %d: unknown campaign %q", n, section)
+			}
+			continue
+		}
+		if len(line) < 2 || (line[0] != '+' && line[0] != '-') || strings.TrimSpace(line[1:]) == "" {
+			return e, errors.Errorf("EXAMPLES_FILE line %d: want \"+ text\", \"- text\" or \"[campaign]\"", n)
+		}
+		text := strings.TrimSpace(line[1:])
+		s := e.all
+		if section != "" {
+			s = e.byCampaign[section]
+		}
+		if line[0] == '+' {
+			s.relevant = append(s.relevant, text)
+		} else {
+			s.irrelevant = append(s.irrelevant, text)
+		}
+		if section != "" {
+			e.byCampaign[section] = s
+		} else {
+			e.all = s
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return e, errors.Wrap(err, "EXAMPLES_FILE")
+	}
+	if e.Count() == 0 {
+		return e, errors.New("EXAMPLES_FILE has no examples")
+	}
+	return e, nil
+}
+
+// Apply appends the examples for c to its prompt. The built-in prompt's
+// own examples are replaced rather than extended.
+func (e FewShotExamples) Apply(c Campaign) Campaign {
+	s := fewShotSet{
+		relevant:   append(append([]string(nil), e.all.relevant...), e.byCampaign[c.Name].relevant...),
+		irrelevant: append(append([]string(nil), e.all.irrelevant...), e.byCampaign[c.Name].irrelevant...),
+	}
+	if s.len() == 0 {
+		return c
+	}
+	if c.Prompt == defaultPrompt {
+		c.Prompt = defaultInstruction
+	}
+	c.Prompt += "\n" + formatExamples(s)
+	return c
+}
+
+// formatExamples renders examples in the layout of the built-in prompt.
+func formatExamples(s fewShotSet) string {
+	var b strings.Builder
+	if len(s.relevant) > 0 {
+		b.WriteString("Примеры релевантных:")
+		for _, t := range s.relevant {
+			fmt.Fprintf(&b, "\n- %q", t)
+		}
+	}
+	if len(s.irrelevant) > 0 {
+		if b.Len() > 0 {
+			b.WriteByte('\n')
+		}
+		b.WriteString("Нерелевантные:")
+		for _, t := range s.irrelevant {
+			fmt.Fprintf(&b, "\n- %q", t)
+		}
+	}
+	return b.String()
+}
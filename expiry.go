@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/tgerr"
+	"go.uber.org/zap"
+)
+
+// exitSessionRevoked is the exit code when Telegram has invalidated the
+// session, so a supervisor can ask for re-authentication instead of
+// restarting in a loop.
+const exitSessionRevoked = 3
+
+var errSessionRevoked = errors.New("telegram session revoked, log in again")
+
+func isSessionRevoked(err error) bool {
+	return errors.Is(err, errSessionRevoked) ||
+		tgerr.Is(err, "SESSION_REVOKED", "AUTH_KEY_UNREGISTERED", "SESSION_EXPIRED", "USER_DEACTIVATED")
+}
+
+// sessionRevoked logs the revocation, sends the final alerts and returns
+// an error that main maps to exitSessionRevoked.
+func (a *App) sessionRevoked(cause error) error {
+	a.lg.Error("Telegram session revoked", zap.Error(cause))
+	fmt.Fprintf(a.out, "FATAL: Telegram session is no longer valid (%v). Delete %s and log in again.\n", cause, a.sessionDir)
+
+	text := fmt.Sprintf("Telegram session for %s was revoked: %v", a.cfg.Phone, cause)
+	if a.cfg.AlertWebhook != "" {
+		if err := postAlert(a.cfg.AlertWebhook, "session_revoked", text); err != nil {
+			a.lg.Error("Session alert webhook", zap.Error(err))
+		}
+	}
+	if a.cfg.AlertEmail != "" && a.mailer != nil {
+		// The mailer goroutine has stopped with the client, so send inline.
+		if err := a.mailer.send(mailJob{to: a.cfg.AlertEmail, subject: "tg-parser: session revoked", body: text}); err != nil {
+			a.lg.Error("Session alert email", zap.Error(err))
+		}
+	}
+	if errors.Is(cause, errSessionRevoked) {
+		return cause
+	}
+	return errors.Wrap(errSessionRevoked, cause.Error())
+}
+
+func postAlert(url, event, text string) error {
+	body, err := json.Marshal(map[string]string{"event": event, "text": text})
+	if err != nil {
+		return errors.Wrap(err, "marshal alert")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "alert request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "post alert")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return errors.Errorf("alert webhook: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"strconv"
+
+	"github.com/go-faster/errors"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+type fineTuneExample struct {
+	Messages []openai.ChatCompletionMessage `json:"messages"`
+}
+
+// ExportJSONL writes stored leads to path in the OpenAI fine-tuning chat
+// format, with the admin label as the assistant answer. With
+// includeModel, unlabeled leads are exported too, using the latest replay
+// verdict or else the original positive one. Image leads are skipped.
+func (a *App) ExportJSONL(ctx context.Context, path string, includeModel bool) (int, error) {
+	leads, err := a.leads.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+	campaigns := map[string]Campaign{}
+	for _, c := range a.cfg.Campaigns {
+		campaigns[c.Name] = c
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, errors.Wrap(err, "create export")
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+
+	n := 0
+	for _, l := range leads {
+		c, ok := campaigns[l.Campaign]
+		if !ok || l.FromImage || l.Text == "" {
+			continue
+		}
+		var answer bool
+		switch {
+		case l.Label != nil:
+			answer = *l.Label
+		case !includeModel:
+			continue
+		case l.ReplayVerdict != nil:
+			answer = *l.ReplayVerdict
+		default:
+			answer = true
+		}
+		input, _ := truncateInput(normalizeText(l.Text, a.cfg.StripURLs), a.cfg.MaxInputChars, a.cfg.InputTailChars)
+		if err := enc.Encode(fineTuneExample{Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: c.Prompt},
+			{Role: openai.ChatMessageRoleUser, Content: input},
+			{Role: openai.ChatMessageRoleAssistant, Content: strconv.FormatBool(answer)},
+		}}); err != nil {
+			return n, errors.Wrap(err, "write example")
+		}
+		n++
+	}
+	if err := w.Flush(); err != nil {
+		return n, errors.Wrap(err, "write export")
+	}
+	return n, errors.Wrap(f.Close(), "close export")
+}
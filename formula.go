@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/go-faster/errors"
+)
+
+// ScoreFormula combines lead signals into one weighted score:
+//
+//	confidence·Confidence + keywords·(SCORE_KEYWORDS found) +
+//	budget·(budget mentioned) + sender·Score
+//
+// The zero value is disabled: leads get no weighted score and nothing is
+// held back by it.
+type ScoreFormula struct {
+	Confidence, Keywords, Budget, Sender float64
+	// Words are the lowercase SCORE_KEYWORDS phrases.
+	Words     []string
+	Threshold float64
+	set       bool
+}
+
+// defaultScoreFormula weighs a confident verdict as much as a mentioned
+// budget, and a sender score point as a quarter of either.
+var defaultScoreFormula = ScoreFormula{Confidence: 1, Keywords: 0.5, Budget: 1, Sender: 0.25}
+
+// parseScoreFormula reads SCORE_THRESHOLD, SCORE_WEIGHTS
+// ("confidence=1,keywords=0.5,budget=1,sender=0.25", unset weights keep
+// their defaults) and SCORE_KEYWORDS. The formula is only enabled by a
+// threshold.
+func parseScoreFormula(threshold, weights, keywords string) (ScoreFormula, error) {
+	if threshold == "" {
+		if weights != "" || keywords != "" {
+			return ScoreFormula{}, errors.New("SCORE_WEIGHTS and SCORE_KEYWORDS need SCORE_THRESHOLD")
+		}
+		return ScoreFormula{}, nil
+	}
+	f := defaultScoreFormula
+	t, err := strconv.ParseFloat(threshold, 64)
+	if err != nil {
+		return ScoreFormula{}, errors.Errorf("SCORE_THRESHOLD %q: want a number", threshold)
+	}
+	f.Threshold, f.set = t, true
+
+	for _, pair := range strings.Split(weights, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, v, ok := strings.Cut(pair, "=")
+		w, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		if !ok || err != nil {
+			return ScoreFormula{}, errors.Errorf("SCORE_WEIGHTS %q: want signal=weight", pair)
+		}
+		switch strings.TrimSpace(name) {
+		case "confidence":
+			f.Confidence = w
+		case "keywords":
+			f.Keywords = w
+		case "budget":
+			f.Budget = w
+		case "sender":
+			f.Sender = w
+		default:
+			return ScoreFormula{}, errors.Errorf("SCORE_WEIGHTS %q: unknown signal (want confidence, keywords, budget or sender)", pair)
+		}
+	}
+
+	for _, k := range strings.Split(keywords, ",") {
+		if k = strings.ToLower(strings.TrimSpace(k)); k != "" {
+			f.Words = append(f.Words, k)
+		}
+	}
+	return f, nil
+}
+
+// Enabled reports whether SCORE_THRESHOLD is set.
+func (f ScoreFormula) Enabled() bool { return f.set }
+
+// Score computes the weighted score of a lead.
+func (f ScoreFormula) Score(l Lead) float64 {
+	if !f.set {
+		return 0
+	}
+	lower := strings.ToLower(l.Text)
+	keywords := 0
+	for _, k := range f.Words {
+		if strings.Contains(lower, k) {
+			keywords++
+		}
+	}
+	score := f.Confidence*l.Confidence + f.Keywords*float64(keywords) + f.Sender*float64(l.Score)
+	if l.Budget != nil {
+		score += f.Budget
+	}
+	return score
+}
+
+func (f ScoreFormula) String() string {
+	if !f.set {
+		return "off"
+	}
+	return fmt.Sprintf("> %g (confidence=%g, keywords=%g ×%d, budget=%g, sender=%g)",
+		f.Threshold, f.Confidence, f.Keywords, len(f.Words), f.Budget, f.Sender)
+}
+
+// formulaHook stores leads whose weighted score does not exceed
+// SCORE_THRESHOLD without forwarding them.
+func formulaHook(f ScoreFormula) LeadHook {
+	return func(_ context.Context, l Lead) (Lead, error) {
+		if !f.set || l.Urgent {
+			return l, nil
+		}
+		if l.Weighted <= f.Threshold {
+			l.Tags = append(l.Tags, "below-threshold")
+			return l, ErrSkipLead
+		}
+		return l, nil
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// startGrace opens the STARTUP_GRACE window: leads are still classified
+// and stored, but their forwards are queued until it ends, so recovery
+// of the update backlog and peer collection don't flood recipients.
+func (a *App) startGrace(ctx context.Context) {
+	if a.cfg.StartupGrace <= 0 {
+		return
+	}
+	until := time.Now().Add(a.cfg.StartupGrace)
+	a.graceUntil.Store(until.UnixNano())
+	go func() {
+		t := time.NewTimer(time.Until(until))
+		defer t.Stop()
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		items, err := a.queue.List()
+		if err != nil {
+			a.lg.Error("List queue", zap.Error(err))
+		}
+		a.lg.Info("Startup grace over", zap.Int("queued", len(items)))
+		select {
+		case a.flushNow <- struct{}{}:
+		default:
+		}
+	}()
+}
+
+// inGrace reports whether t falls in the STARTUP_GRACE window.
+func (a *App) inGrace(t time.Time) bool {
+	return t.UnixNano() < a.graceUntil.Load()
+}
+
+// startupJitter waits a random part of STARTUP_JITTER before recipient
+// resolution, peer collection and updates recovery, so instances rolled
+// out together don't hit Telegram and OpenAI at the same moment.
+func (a *App) startupJitter(ctx context.Context) error {
+	if a.cfg.StartupJitter <= 0 {
+		return nil
+	}
+	d := rand.N(a.cfg.StartupJitter)
+	fmt.Fprintf(a.out, "Waiting %s before startup (STARTUP_JITTER)\n", d.Round(time.Millisecond))
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/go-faster/errors"
+)
+
+// LeadHook post-processes a matched lead before it is stored and
+// forwarded. A hook may return a modified lead (e.g. with extra tags), or
+// stop the pipeline with ErrSkipLead or ErrDropLead.
+type LeadHook func(ctx context.Context, l Lead) (Lead, error)
+
+var (
+	// ErrSkipLead stores the lead but does not forward it.
+	ErrSkipLead = errors.New("skip lead")
+	// ErrDropLead discards the lead entirely.
+	ErrDropLead = errors.New("drop lead")
+)
+
+var customHooks []LeadHook
+
+// RegisterLeadHook adds a hook that runs after the built-in ones, in
+// registration order. Call it from an init function in a separate file to
+// extend the pipeline without touching the rest of the code.
+func RegisterLeadHook(h LeadHook) {
+	customHooks = append(customHooks, h)
+}
+
+// runHooks applies hooks in order, stopping at the first error.
+func runHooks(ctx context.Context, hooks []LeadHook, l Lead) (Lead, error) {
+	for _, h := range hooks {
+		var err error
+		if l, err = h(ctx, l); err != nil {
+			return l, err
+		}
+	}
+	return l, nil
+}
+
+// DedupScope is what a message is deduplicated within.
+type DedupScope string
+
+const (
+	// DedupCampaign allows one lead per message and campaign.
+	DedupCampaign DedupScope = "campaign"
+	// DedupGlobal allows one lead per message, whichever campaign
+	// matches first.
+	DedupGlobal DedupScope = "global"
+	// DedupPerRecipient delivers a message at most once to each
+	// recipient of each campaign; it is checked at delivery time.
+	DedupPerRecipient DedupScope = "per-recipient"
+)
+
+func parseDedupScope(s string) (DedupScope, error) {
+	switch sc := DedupScope(s); sc {
+	case "":
+		return DedupCampaign, nil
+	case DedupCampaign, DedupGlobal, DedupPerRecipient:
+		return sc, nil
+	default:
+		return "", errors.Errorf("DEDUP_SCOPE must be campaign, global or per-recipient, got %q", s)
+	}
+}
+
+// dedupHook drops leads for a message that was already processed within
+// the scope, e.g. when updates recovery replays a message. With
+// DedupPerRecipient it does nothing; see App.deliveredBefore.
+func dedupHook(store LeadStore, scope DedupScope) LeadHook {
+	return func(ctx context.Context, l Lead) (Lead, error) {
+		key := l.Campaign
+		switch scope {
+		case DedupPerRecipient:
+			return l, nil
+		case DedupGlobal:
+			key = "*" // shared by every campaign
+		}
+		seen, err := store.Seen(ctx, l.ChatID, l.MsgID, key)
+		if err != nil {
+			return l, err
+		}
+		if seen {
+			return l, ErrDropLead
+		}
+		return l, nil
+	}
+}
+
+func minScoreHook(minScore int) LeadHook {
+	return func(_ context.Context, l Lead) (Lead, error) {
+		if l.Urgent {
+			return l, nil
+		}
+		if l.Score < minScore {
+			l.Tags = append(l.Tags, "low-score")
+			return l, ErrSkipLead
+		}
+		return l, nil
+	}
+}
+
+// confidenceHook stores leads below their chat's CHAT_CONFIDENCE
+// threshold without forwarding them.
+func confidenceHook(cc ChatConfidence) LeadHook {
+	return func(_ context.Context, l Lead) (Lead, error) {
+		if l.Urgent {
+			return l, nil
+		}
+		if l.Confidence < cc.For(l.ChatID) {
+			l.Tags = append(l.Tags, "low-confidence")
+			return l, ErrSkipLead
+		}
+		return l, nil
+	}
+}
+
+// cooldownHook forwards at most one lead per sender and campaign within
+// the window. Leads inside it are still stored.
+func cooldownHook(window time.Duration) LeadHook {
+	type senderKey struct {
+		fromID   int64
+		campaign string
+	}
+	var (
+		mu   sync.Mutex
+		last = map[senderKey]time.Time{}
+	)
+	return func(_ context.Context, l Lead) (Lead, error) {
+		if window <= 0 || l.FromID == 0 || l.Urgent {
+			return l, nil
+		}
+		k := senderKey{fromID: l.FromID, campaign: l.Campaign}
+		now := time.Now()
+
+		mu.Lock()
+		defer mu.Unlock()
+		if t, ok := last[k]; ok && now.Sub(t) < window {
+			l.Tags = append(l.Tags, "cooldown")
+			return l, ErrSkipLead
+		}
+		last[k] = now
+		return l, nil
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-faster/errors"
+)
+
+// ActiveHours is a daily delivery window in a fixed location. A window
+// whose end is before its start wraps past midnight. The zero value is
+// always open.
+type ActiveHours struct {
+	start, end int // minutes since midnight
+	loc        *time.Location
+	set        bool
+}
+
+func parseClock(s string) (int, error) {
+	var h, m int
+	if _, err := fmt.Sscanf(s, "%d:%d", &h, &m); err != nil || h < 0 || h > 24 || m < 0 || m > 59 || (h == 24 && m != 0) {
+		return 0, errors.Errorf("invalid time %q (want HH:MM)", s)
+	}
+	return h*60 + m, nil
+}
+
+func parseActiveHours(window string, loc *time.Location) (ActiveHours, error) {
+	if window == "" {
+		return ActiveHours{}, nil
+	}
+	from, to, ok := strings.Cut(window, "-")
+	if !ok {
+		return ActiveHours{}, errors.Errorf("ACTIVE_HOURS %q: want HH:MM-HH:MM", window)
+	}
+	start, err := parseClock(strings.TrimSpace(from))
+	if err != nil {
+		return ActiveHours{}, errors.Wrap(err, "ACTIVE_HOURS")
+	}
+	end, err := parseClock(strings.TrimSpace(to))
+	if err != nil {
+		return ActiveHours{}, errors.Wrap(err, "ACTIVE_HOURS")
+	}
+	if start == end {
+		return ActiveHours{}, errors.Errorf("ACTIVE_HOURS %q: empty window", window)
+	}
+	return ActiveHours{start: start, end: end, loc: loc, set: true}, nil
+}
+
+func (h ActiveHours) Contains(t time.Time) bool {
+	if !h.set {
+		return true
+	}
+	t = t.In(h.loc)
+	m := t.Hour()*60 + t.Minute()
+	if h.start < h.end {
+		return m >= h.start && m < h.end
+	}
+	return m >= h.start || m < h.end
+}
+
+func (h ActiveHours) String() string {
+	if !h.set {
+		return "always"
+	}
+	return fmt.Sprintf("%02d:%02d-%02d:%02d %s", h.start/60, h.start%60, h.end/60, h.end%60, h.loc)
+}
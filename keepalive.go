@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// touch records connection activity for staleness detection.
+func (a *App) touch() {
+	a.lastUpdate.Store(time.Now().UnixNano())
+}
+
+func (a *App) sinceLastUpdate() time.Duration {
+	return time.Since(time.Unix(0, a.lastUpdate.Load()))
+}
+
+// keepAlive periodically issues a cheap request so sparse-traffic
+// sessions don't go stale unnoticed. Failures are connection-health
+// warnings, not fatal.
+func (a *App) keepAlive(ctx context.Context) {
+	ticker := time.NewTicker(a.cfg.KeepAliveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		idle := a.sinceLastUpdate()
+		if _, err := a.api.UpdatesGetState(ctx); err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			a.lg.Warn("Keep-alive failed", zap.Duration("idle", idle), zap.Error(err))
+			fmt.Fprintf(a.out, "keep-alive failed (idle %s): %v\n", idle.Round(time.Second), err)
+			continue
+		}
+		a.touch()
+		a.lg.Debug("Keep-alive", zap.Duration("idle", idle))
+	}
+}
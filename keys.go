@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/go-faster/errors"
+	openai "github.com/sashabaranov/go-openai"
+	"go.uber.org/zap"
+)
+
+// keyBench is how long a rate-limited key is skipped.
+const keyBench = time.Minute
+
+type pooledKey struct {
+	client ChatCompleter
+	// benchedUntil is zero while the key is usable.
+	benchedUntil time.Time
+	requests     int
+	errors       int
+}
+
+// keyPool spreads completions across several OpenAI keys round-robin,
+// moving on to the next key when one answers 429.
+type keyPool struct {
+	lg *zap.Logger
+
+	mu   sync.Mutex
+	keys []*pooledKey
+	next int
+}
+
+// newClassifier returns a plain client for a single key and a rotating
+// pool for several.
+func newClassifier(cfg Config, lg *zap.Logger, out io.Writer) ChatCompleter {
+	if (cfg.OpenAIOrg != "" || cfg.OpenAIProject != "") && !isOfficialOpenAI(cfg.OpenAIBaseURL) {
+		lg.Warn("OpenAI organization/project ignored for non-official endpoint", zap.String("base_url", cfg.OpenAIBaseURL))
+		fmt.Fprintf(out, "WARNING: OPENAI_ORG_ID/OPENAI_PROJECT_ID ignored, %s is not the official OpenAI API\n", cfg.OpenAIBaseURL)
+	}
+	keys := cfg.OpenAIKeys
+	if len(keys) == 1 {
+		return openai.NewClientWithConfig(openAIClientConfig(cfg, keys[0]))
+	}
+	p := &keyPool{lg: lg}
+	for _, k := range keys {
+		p.keys = append(p.keys, &pooledKey{client: openai.NewClientWithConfig(openAIClientConfig(cfg, k))})
+	}
+	return p
+}
+
+// isOfficialOpenAI reports whether baseURL, empty for the default, is the
+// official OpenAI API.
+func isOfficialOpenAI(baseURL string) bool {
+	if baseURL == "" {
+		return true
+	}
+	u, err := url.Parse(baseURL)
+	return err == nil && u.Host == "api.openai.com"
+}
+
+// openAIClientConfig builds the client config for a key. Organization and
+// project scoping only mean something to the official API, so against
+// another OPENAI_BASE_URL they are left out.
+func openAIClientConfig(cfg Config, key string) openai.ClientConfig {
+	cc := openai.DefaultConfig(key)
+	if cfg.OpenAIBaseURL != "" {
+		cc.BaseURL = cfg.OpenAIBaseURL
+	}
+	if !isOfficialOpenAI(cfg.OpenAIBaseURL) {
+		return cc
+	}
+	cc.OrgID = cfg.OpenAIOrg
+	if cfg.OpenAIProject != "" {
+		cc.HTTPClient = &http.Client{Transport: projectHeader{project: cfg.OpenAIProject, next: http.DefaultTransport}}
+	}
+	return cc
+}
+
+// projectHeader adds the OpenAI-Project header, which the client library
+// has no setting for.
+type projectHeader struct {
+	project string
+	next    http.RoundTripper
+}
+
+func (t projectHeader) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("OpenAI-Project", t.project)
+	return t.next.RoundTrip(req)
+}
+
+// pick returns the next key that isn't benched, or the one whose bench
+// ends soonest if all are.
+func (p *keyPool) pick(now time.Time) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	soonest := -1
+	for n := 0; n < len(p.keys); n++ {
+		i := (p.next + n) % len(p.keys)
+		k := p.keys[i]
+		if !now.Before(k.benchedUntil) {
+			p.next = i + 1
+			return i
+		}
+		if soonest < 0 || k.benchedUntil.Before(p.keys[soonest].benchedUntil) {
+			soonest = i
+		}
+	}
+	p.next = soonest + 1
+	return soonest
+}
+
+func (p *keyPool) report(i int, err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	k := p.keys[i]
+	k.requests++
+	if err == nil {
+		return
+	}
+	k.errors++
+	if isRateLimited(err) {
+		k.benchedUntil = time.Now().Add(keyBench)
+		p.lg.Warn("OpenAI key rate-limited, benching",
+			zap.Int("key", i),
+			zap.Duration("for", keyBench),
+			zap.Int("requests", k.requests),
+			zap.Int("errors", k.errors),
+		)
+	}
+}
+
+func (p *keyPool) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	var (
+		resp openai.ChatCompletionResponse
+		err  error
+	)
+	for range p.keys {
+		i := p.pick(time.Now())
+		resp, err = p.keys[i].client.CreateChatCompletion(ctx, req)
+		p.report(i, err)
+		if !isRateLimited(err) {
+			return resp, err
+		}
+	}
+	return resp, err
+}
+
+func isRateLimited(err error) bool {
+	return httpStatus(err) == http.StatusTooManyRequests
+}
+
+// httpStatus returns the HTTP status of an OpenAI error, or zero.
+func httpStatus(err error) int {
+	var apiErr *openai.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.HTTPStatusCode
+	}
+	var reqErr *openai.RequestError
+	if errors.As(err, &reqErr) {
+		return reqErr.HTTPStatusCode
+	}
+	return 0
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/go-faster/errors"
+	"go.uber.org/zap"
+)
+
+// detectLanguage guesses a text's language from its dominant script, as
+// an ISO 639-1 code, or "" for text without letters. Cyrillic text is
+// told apart by letters specific to Ukrainian, Belarusian and Kazakh;
+// Latin text is assumed English unless it has letters specific to a few
+// other languages. It is a cheap pre-filter, not a real detector.
+func detectLanguage(text string) string {
+	counts := map[string]int{}
+	marks := map[string]bool{}
+	for _, r := range strings.ToLower(text) {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		switch {
+		case unicode.Is(unicode.Cyrillic, r):
+			counts["cyrillic"]++
+			switch r {
+			case 'і', 'ї', 'є', 'ґ':
+				marks["uk"] = true
+			case 'ў':
+				marks["be"] = true
+			case 'ә', 'ғ', 'қ', 'ң', 'ө', 'ұ', 'ү', 'һ':
+				marks["kk"] = true
+			}
+		case unicode.Is(unicode.Latin, r):
+			counts["latin"]++
+			switch r {
+			case 'ä', 'ö', 'ü', 'ß':
+				marks["de"] = true
+			case 'ñ', '¿', '¡':
+				marks["es"] = true
+			case 'ç', 'ş', 'ğ', 'ı':
+				marks["tr"] = true
+			case 'ą', 'ę', 'ł', 'ś', 'ż', 'ź', 'ń':
+				marks["pl"] = true
+			}
+		case unicode.Is(unicode.Arabic, r):
+			counts["ar"]++
+		case unicode.Is(unicode.Hebrew, r):
+			counts["he"]++
+		case unicode.Is(unicode.Greek, r):
+			counts["el"]++
+		case unicode.Is(unicode.Georgian, r):
+			counts["ka"]++
+		case unicode.Is(unicode.Armenian, r):
+			counts["hy"]++
+		case unicode.Is(unicode.Devanagari, r):
+			counts["hi"]++
+		case unicode.Is(unicode.Hangul, r):
+			counts["ko"]++
+		case unicode.Is(unicode.Hiragana, r) || unicode.Is(unicode.Katakana, r):
+			counts["ja"]++
+		case unicode.Is(unicode.Han, r):
+			counts["zh"]++
+		default:
+			counts["other"]++
+		}
+	}
+	script, best := "", 0
+	for s, n := range counts {
+		if n > best || (n == best && s < script) {
+			script, best = s, n
+		}
+	}
+	// Kana decides Japanese even when Han characters outnumber it.
+	if script == "zh" && counts["ja"] > 0 {
+		script = "ja"
+	}
+	switch script {
+	case "cyrillic":
+		for _, l := range []string{"uk", "be", "kk"} {
+			if marks[l] {
+				return l
+			}
+		}
+		return "ru"
+	case "latin":
+		for _, l := range []string{"de", "es", "tr", "pl"} {
+			if marks[l] {
+				return l
+			}
+		}
+		return "en"
+	case "other":
+		return "und"
+	}
+	return script
+}
+
+// parseLanguages reads LANGUAGES, a comma-separated list of two-letter
+// codes; empty allows every language.
+func parseLanguages(s string) (map[string]bool, error) {
+	var langs map[string]bool
+	for _, l := range strings.Split(s, ",") {
+		l = strings.ToLower(strings.TrimSpace(l))
+		if l == "" {
+			continue
+		}
+		if len(l) != 2 {
+			return nil, errors.Errorf("LANGUAGES: %q is not a two-letter language code", l)
+		}
+		if langs == nil {
+			langs = map[string]bool{}
+		}
+		langs[l] = true
+	}
+	return langs, nil
+}
+
+// allowedLanguage reports whether text is in one of LANGUAGES. Text
+// without letters passes, since there is nothing to judge.
+func (a *App) allowedLanguage(text string) bool {
+	if a.cfg.Languages == nil {
+		return true
+	}
+	lang := detectLanguage(text)
+	if lang == "" || a.cfg.Languages[lang] {
+		return true
+	}
+	a.stats.IncSkippedLanguage()
+	a.lg.Debug("Skipped message language", zap.String("lang", lang))
+	return false
+}
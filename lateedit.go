@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"hash/fnv"
+	"time"
+
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+)
+
+// editTextHash identifies an edited text, ignoring case and spacing.
+func editTextHash(text string) uint64 {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(normalizeForHash(text)))
+	return h.Sum64()
+}
+
+// recheckEdit classifies a message again when its author edited it after
+// any debounce window, within LATE_EDITS of posting. The last edit date
+// and text seen are kept in the lead store, so an edit delivered twice
+// (e.g. replayed by updates recovery after a restart) or a later one that
+// left the text as it was is not processed again. Duplicate suppression
+// still applies, so a message that already produced a lead is not
+// forwarded twice.
+func (a *App) recheckEdit(ctx context.Context, msg *tg.Message) error {
+	if a.cfg.LateEdits <= 0 || msg.EditHide {
+		return nil
+	}
+	editDate, ok := msg.GetEditDate()
+	if !ok || time.Since(time.Unix(int64(msg.Date), 0)) > a.cfg.LateEdits {
+		return nil
+	}
+	chatID := getChatID(msg.GetPeerID())
+	seen, err := a.leads.EditSeen(ctx, chatID, msg.ID, editDate, editTextHash(a.extractText(msg)))
+	if err != nil {
+		return err
+	}
+	if seen {
+		return nil
+	}
+	a.lg.Info("Rechecking edited message", zap.Int64("chat_id", chatID), zap.Int("msg_id", msg.ID))
+	return a.dispatchMessage(ctx, msg)
+}
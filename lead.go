@@ -0,0 +1,442 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	pebbledb "github.com/cockroachdb/pebble"
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/tg"
+)
+
+type Lead struct {
+	// ID is assigned on first save and never changes.
+	ID       uint64 `json:"id"`
+	Campaign string `json:"campaign"`
+	ChatID   int64  `json:"chat_id"`
+	MsgID    int    `json:"msg_id"`
+	FromID   int64  `json:"from_id"`
+	// FromKind is the kind of peer FromID names: fromChannel for channel
+	// posts and messages sent as a channel, empty for users.
+	FromKind  string `json:"from_kind,omitempty"`
+	Username  string `json:"username"`
+	Text      string `json:"text"`
+	FromImage bool   `json:"from_image,omitempty"`
+	// Truncated reports that the classifier saw only part of Text.
+	Truncated bool `json:"truncated,omitempty"`
+	Score     int  `json:"score"`
+	// Weighted is the SCORE_THRESHOLD formula score, zero when it is off.
+	Weighted float64 `json:"weighted,omitempty"`
+	// Confidence is the model's probability for the verdict.
+	Confidence float64  `json:"confidence,omitempty"`
+	Tags       []string `json:"tags,omitempty"`
+	// Urgent is set when the text matched URGENT_KEYWORDS.
+	Urgent bool `json:"urgent,omitempty"`
+	// Context holds the surrounding chat messages, oldest first.
+	Context []string `json:"context,omitempty"`
+	// Link is a t.me link to the message, for channels and supergroups.
+	Link string `json:"link,omitempty"`
+	// ReplyTo is a preview of the message this one replies to.
+	ReplyTo string `json:"reply_to,omitempty"`
+	// Topic is the forum topic title, for messages in forums.
+	Topic string `json:"topic,omitempty"`
+	// RecentChats is how many monitored chats the sender posted in within
+	// SPAM_WINDOW, this one included.
+	RecentChats int `json:"recent_chats,omitempty"`
+	// Budget is the largest amount the text mentions, if any.
+	Budget *Budget `json:"budget,omitempty"`
+	// Contact is a link that opens a private chat with the author, empty
+	// for channel posts and unknown senders.
+	Contact string `json:"contact,omitempty"`
+	// SentAt is the original message date.
+	SentAt time.Time `json:"sent_at"`
+	// Recovered is set for messages processed long after they were sent,
+	// i.e. from the updates backlog after downtime.
+	Recovered bool `json:"recovered,omitempty"`
+	// ForwardedTo lists the recipients the lead was delivered to.
+	ForwardedTo []string `json:"forwarded_to,omitempty"`
+	// ReplayVerdict is the verdict from the latest -replay -replay-write
+	// run, if any.
+	ReplayVerdict *bool `json:"replay_verdict,omitempty"`
+	// ShadowVerdict is the SHADOW_MODEL/SHADOW_PROMPT verdict, if a
+	// shadow classifier ran.
+	ShadowVerdict *bool `json:"shadow_verdict,omitempty"`
+	// SelfTest marks the synthetic STARTUP_SELFTEST lead, which is never
+	// stored.
+	SelfTest bool `json:"-"`
+	// Label is the admin's ground-truth feedback, if given.
+	Label     *bool     `json:"label,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func leadKey(id uint64) []byte {
+	return []byte(fmt.Sprintf("lead/%020d", id))
+}
+
+var leadSeqKey = []byte("meta/lead_seq")
+
+// chatCountDay is the layout of the day in per-chat lead counter keys.
+const chatCountDay = "20060102"
+
+// chatCountKey is the counter of leads from a chat created on a day.
+func chatCountKey(day time.Time, chatID int64) []byte {
+	return []byte(fmt.Sprintf("chatleads/%s/%d", day.UTC().Format(chatCountDay), chatID))
+}
+
+// fromChannel is Lead.FromKind for a channel author.
+const fromChannel = "channel"
+
+// peerKind returns the Lead.FromKind for an author peer.
+func peerKind(p tg.PeerClass) string {
+	if _, ok := p.(*tg.PeerChannel); ok {
+		return fromChannel
+	}
+	return ""
+}
+
+// fromPeer is the peer of the lead's author, for looking it up in peer
+// storage.
+func (l Lead) fromPeer() tg.PeerClass {
+	if l.FromKind == fromChannel {
+		return &tg.PeerChannel{ChannelID: l.FromID}
+	}
+	return &tg.PeerUser{UserID: l.FromID}
+}
+
+// ErrLeadNotFound reports a lead ID that is not in the store.
+var ErrLeadNotFound = errors.New("lead not found")
+
+// LeadStore persists leads and remembers which messages were already
+// processed.
+type LeadStore interface {
+	// Save stores the lead, assigning it the next ID if it has none yet.
+	Save(ctx context.Context, l *Lead) error
+	// Get returns the lead, or an error matching ErrLeadNotFound.
+	Get(ctx context.Context, id uint64) (Lead, error)
+	// List returns all stored leads in ID order.
+	List(ctx context.Context) ([]Lead, error)
+	// Update applies fn to the stored lead and saves the result, with no
+	// other write to the lead in between. An error from fn is returned
+	// and nothing is saved.
+	Update(ctx context.Context, id uint64, fn func(l *Lead) error) error
+	// MarkForwarded records a successful delivery of the lead.
+	MarkForwarded(ctx context.Context, id uint64, recipient string) error
+	// Seen marks a message as processed within a dedup scope (see
+	// DedupScope) and reports whether it already was.
+	Seen(ctx context.Context, chatID int64, msgID int, scope string) (bool, error)
+	// EditSeen records the latest edit of a message, by edit date and
+	// text hash, and reports whether it was already seen: an edit date
+	// no newer than the recorded one, or the same text.
+	EditSeen(ctx context.Context, chatID int64, msgID, editDate int, textHash uint64) (bool, error)
+	// TextSeen records a sighting of a text, by content hash, and reports
+	// whether a different message with it was seen within window. The
+	// first message keeps the text until the window passes without it,
+	// so it is never a repeat of itself.
+	TextSeen(ctx context.Context, hash string, chatID int64, msgID int, window time.Duration) (bool, error)
+	// PruneTexts forgets texts not seen within window and returns how
+	// many it removed.
+	PruneTexts(ctx context.Context, window time.Duration) (int, error)
+	// CountByChat returns how many leads each chat produced from the day
+	// of since on.
+	CountByChat(ctx context.Context, since time.Time) (map[int64]int, error)
+}
+
+// PebbleLeadStore keeps leads in the shared pebble database.
+type PebbleLeadStore struct {
+	db     *pebbledb.DB
+	mu     sync.Mutex // serializes ID allocation and read-modify-write
+	seenMu sync.Mutex
+}
+
+func NewPebbleLeadStore(db *pebbledb.DB) *PebbleLeadStore {
+	return &PebbleLeadStore{db: db}
+}
+
+func (s *PebbleLeadStore) Save(_ context.Context, l *Lead) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.save(l)
+}
+
+func (s *PebbleLeadStore) save(l *Lead) error {
+	b := s.db.NewBatch()
+	defer b.Close()
+
+	if l.ID == 0 {
+		seq, err := s.lastID()
+		if err != nil {
+			return err
+		}
+		l.ID = seq + 1
+		var buf [8]byte
+		binary.BigEndian.PutUint64(buf[:], l.ID)
+		if err := b.Set(leadSeqKey, buf[:], nil); err != nil {
+			return errors.Wrap(err, "set lead seq")
+		}
+		if err := s.countChat(b, l); err != nil {
+			return err
+		}
+	}
+
+	data, err := json.Marshal(l)
+	if err != nil {
+		return errors.Wrap(err, "marshal lead")
+	}
+	if err := b.Set(leadKey(l.ID), data, nil); err != nil {
+		return errors.Wrap(err, "set lead")
+	}
+	if err := b.Commit(pebbledb.Sync); err != nil {
+		return errors.Wrap(err, "save lead")
+	}
+	return nil
+}
+
+func (s *PebbleLeadStore) Get(_ context.Context, id uint64) (Lead, error) {
+	data, closer, err := s.db.Get(leadKey(id))
+	if errors.Is(err, pebbledb.ErrNotFound) {
+		return Lead{}, errors.Wrapf(ErrLeadNotFound, "get lead %d", id)
+	}
+	if err != nil {
+		return Lead{}, errors.Wrapf(err, "get lead %d", id)
+	}
+	defer closer.Close()
+
+	var l Lead
+	if err := json.Unmarshal(data, &l); err != nil {
+		return Lead{}, errors.Wrapf(err, "unmarshal lead %d", id)
+	}
+	return l, nil
+}
+
+func (s *PebbleLeadStore) List(_ context.Context) ([]Lead, error) {
+	iter, err := s.db.NewIter(&pebbledb.IterOptions{
+		LowerBound: []byte("lead/"),
+		UpperBound: []byte("lead0"), // '0' follows '/'
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "lead iter")
+	}
+	defer iter.Close()
+
+	var out []Lead
+	for iter.First(); iter.Valid(); iter.Next() {
+		var l Lead
+		if err := json.Unmarshal(iter.Value(), &l); err != nil {
+			return nil, errors.Wrapf(err, "unmarshal %s", iter.Key())
+		}
+		out = append(out, l)
+	}
+	return out, iter.Error()
+}
+
+func (s *PebbleLeadStore) Update(ctx context.Context, id uint64, fn func(l *Lead) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	l, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := fn(&l); err != nil {
+		return err
+	}
+	l.ID = id
+	return s.save(&l)
+}
+
+func (s *PebbleLeadStore) MarkForwarded(ctx context.Context, id uint64, recipient string) error {
+	return s.Update(ctx, id, func(l *Lead) error {
+		l.ForwardedTo = append(l.ForwardedTo, recipient)
+		return nil
+	})
+}
+
+func (s *PebbleLeadStore) Seen(_ context.Context, chatID int64, msgID int, scope string) (bool, error) {
+	key := []byte(fmt.Sprintf("seen/%d/%d/%s", chatID, msgID, scope))
+
+	s.seenMu.Lock()
+	defer s.seenMu.Unlock()
+	_, closer, err := s.db.Get(key)
+	if err == nil {
+		closer.Close()
+		return true, nil
+	}
+	if !errors.Is(err, pebbledb.ErrNotFound) {
+		return false, errors.Wrap(err, "dedup lookup")
+	}
+	if err := s.db.Set(key, nil, pebbledb.NoSync); err != nil {
+		return false, errors.Wrap(err, "dedup mark")
+	}
+	return false, nil
+}
+
+func (s *PebbleLeadStore) EditSeen(_ context.Context, chatID int64, msgID, editDate int, textHash uint64) (bool, error) {
+	key := []byte(fmt.Sprintf("edit/%d/%d", chatID, msgID))
+
+	s.seenMu.Lock()
+	defer s.seenMu.Unlock()
+	v, closer, err := s.db.Get(key)
+	switch {
+	case err == nil:
+		seen := len(v) == 12 && (int(binary.BigEndian.Uint32(v)) >= editDate || binary.BigEndian.Uint64(v[4:]) == textHash)
+		closer.Close()
+		if seen {
+			return true, nil
+		}
+	case !errors.Is(err, pebbledb.ErrNotFound):
+		return false, errors.Wrap(err, "edit lookup")
+	}
+	var buf [12]byte
+	binary.BigEndian.PutUint32(buf[:4], uint32(editDate))
+	binary.BigEndian.PutUint64(buf[4:], textHash)
+	if err := s.db.Set(key, buf[:], pebbledb.NoSync); err != nil {
+		return false, errors.Wrap(err, "edit mark")
+	}
+	return false, nil
+}
+
+func (s *PebbleLeadStore) TextSeen(_ context.Context, hash string, chatID int64, msgID int, window time.Duration) (bool, error) {
+	key := []byte(string(spamTextPrefix) + hash)
+	now := time.Now()
+
+	s.seenMu.Lock()
+	defer s.seenMu.Unlock()
+	// Value: last seen (unix nanoseconds), then the chat and message ID
+	// of the first message with the text.
+	var buf [20]byte
+	fresh := false
+	v, closer, err := s.db.Get(key)
+	switch {
+	case err == nil:
+		if len(v) == 20 && now.Sub(time.Unix(0, int64(binary.BigEndian.Uint64(v)))) <= window {
+			copy(buf[:], v)
+			fresh = true
+		}
+		closer.Close()
+	case !errors.Is(err, pebbledb.ErrNotFound):
+		return false, errors.Wrap(err, "text lookup")
+	}
+	if !fresh {
+		binary.BigEndian.PutUint64(buf[8:16], uint64(chatID))
+		binary.BigEndian.PutUint32(buf[16:], uint32(msgID))
+	}
+	binary.BigEndian.PutUint64(buf[:8], uint64(now.UnixNano()))
+	if err := s.db.Set(key, buf[:], pebbledb.NoSync); err != nil {
+		return false, errors.Wrap(err, "text mark")
+	}
+	return fresh && (int64(binary.BigEndian.Uint64(buf[8:16])) != chatID || int(binary.BigEndian.Uint32(buf[16:])) != msgID), nil
+}
+
+var spamTextPrefix = []byte("spamtext/")
+
+func (s *PebbleLeadStore) PruneTexts(_ context.Context, window time.Duration) (int, error) {
+	iter, err := s.db.NewIter(&pebbledb.IterOptions{
+		LowerBound: spamTextPrefix,
+		UpperBound: []byte("spamtext0"), // '0' follows '/'
+	})
+	if err != nil {
+		return 0, errors.Wrap(err, "text iter")
+	}
+	cutoff := time.Now().Add(-window).UnixNano()
+	var stale [][]byte
+	for iter.First(); iter.Valid(); iter.Next() {
+		if v := iter.Value(); len(v) != 20 || int64(binary.BigEndian.Uint64(v)) < cutoff {
+			stale = append(stale, append([]byte(nil), iter.Key()...))
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return 0, errors.Wrap(err, "text iter")
+	}
+
+	// Deleted one by one under the lock, rechecked, so a text seen again
+	// since the scan keeps its record.
+	s.seenMu.Lock()
+	defer s.seenMu.Unlock()
+	n := 0
+	for _, key := range stale {
+		v, closer, err := s.db.Get(key)
+		if errors.Is(err, pebbledb.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return n, errors.Wrap(err, "text lookup")
+		}
+		fresh := len(v) == 20 && int64(binary.BigEndian.Uint64(v)) >= cutoff
+		closer.Close()
+		if fresh {
+			continue
+		}
+		if err := s.db.Delete(key, pebbledb.NoSync); err != nil {
+			return n, errors.Wrap(err, "text prune")
+		}
+		n++
+	}
+	return n, nil
+}
+
+// countChat adds a new lead to its chat's counter for the day.
+func (s *PebbleLeadStore) countChat(b *pebbledb.Batch, l *Lead) error {
+	created := l.CreatedAt
+	if created.IsZero() {
+		created = time.Now()
+	}
+	key := chatCountKey(created, l.ChatID)
+	var n uint64
+	v, closer, err := s.db.Get(key)
+	switch {
+	case err == nil:
+		n = binary.BigEndian.Uint64(v)
+		closer.Close()
+	case !errors.Is(err, pebbledb.ErrNotFound):
+		return errors.Wrap(err, "get chat count")
+	}
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], n+1)
+	if err := b.Set(key, buf[:], nil); err != nil {
+		return errors.Wrap(err, "set chat count")
+	}
+	return nil
+}
+
+func (s *PebbleLeadStore) CountByChat(_ context.Context, since time.Time) (map[int64]int, error) {
+	iter, err := s.db.NewIter(&pebbledb.IterOptions{
+		LowerBound: []byte("chatleads/" + since.UTC().Format(chatCountDay)),
+		UpperBound: []byte("chatleads0"), // '0' follows '/'
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "chat count iter")
+	}
+	defer iter.Close()
+
+	out := map[int64]int{}
+	for iter.First(); iter.Valid(); iter.Next() {
+		_, chat, ok := strings.Cut(strings.TrimPrefix(string(iter.Key()), "chatleads/"), "/")
+		if !ok {
+			continue
+		}
+		id, err := strconv.ParseInt(chat, 10, 64)
+		if err != nil {
+			continue
+		}
+		out[id] += int(binary.BigEndian.Uint64(iter.Value()))
+	}
+	return out, iter.Error()
+}
+
+func (s *PebbleLeadStore) lastID() (uint64, error) {
+	v, closer, err := s.db.Get(leadSeqKey)
+	if errors.Is(err, pebbledb.ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, errors.Wrap(err, "get lead seq")
+	}
+	defer closer.Close()
+	return binary.BigEndian.Uint64(v), nil
+}
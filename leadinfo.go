@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/go-faster/errors"
+)
+
+// maxReplyRunes is Telegram's message length limit.
+const maxReplyRunes = 4096
+
+// leadCommand handles "/lead <id>": every stored field of a lead, with
+// the full untruncated text.
+func (a *App) leadCommand(ctx context.Context, args string) (string, error) {
+	id, err := strconv.ParseUint(strings.TrimPrefix(args, "#"), 10, 64)
+	if err != nil {
+		return fmt.Sprintf("invalid lead ID %q, e.g. /lead 42", args), nil
+	}
+	l, err := a.leads.Get(ctx, id)
+	if errors.Is(err, ErrLeadNotFound) {
+		return fmt.Sprintf("Лид #%d не найден", id), nil
+	}
+	if err != nil {
+		return "", err
+	}
+
+	const layout = "02.01.2006 15:04:05"
+	var b strings.Builder
+	fmt.Fprintf(&b, "Лид #%d: %s", l.ID, l.Campaign)
+	fmt.Fprintf(&b, "\nНайден: %s", l.CreatedAt.In(a.cfg.Location).Format(layout))
+	if !l.SentAt.IsZero() {
+		fmt.Fprintf(&b, "\nОтправлен автором: %s", l.SentAt.In(a.cfg.Location).Format(layout))
+	}
+	fmt.Fprintf(&b, "\nЧат: %s (ID: %d), сообщение %d", a.chatTitle(ctx, l.ChatID), l.ChatID, l.MsgID)
+	if l.Topic != "" {
+		b.WriteString("\nТема: " + l.Topic)
+	}
+	if l.Link != "" {
+		b.WriteString("\nСсылка: " + l.Link)
+	}
+	fmt.Fprintf(&b, "\nАвтор: %s (ID: %d)", l.Username, l.FromID)
+	if l.Contact != "" {
+		b.WriteString("\nСвязаться: " + l.Contact)
+	}
+	fmt.Fprintf(&b, "\nОценка: %d", l.Score)
+	if l.Weighted != 0 {
+		fmt.Fprintf(&b, ", итог %.2f", l.Weighted)
+	}
+	if l.Confidence != 0 {
+		fmt.Fprintf(&b, "\nУверенность: %.2f", l.Confidence)
+	}
+	if l.Budget != nil {
+		b.WriteString("\nБюджет: " + l.Budget.String())
+	}
+	if l.RecentChats > 1 {
+		fmt.Fprintf(&b, "\nНедавно писал в чатах: %d", l.RecentChats)
+	}
+	if len(l.Tags) > 0 {
+		b.WriteString("\nТеги: " + strings.Join(l.Tags, ", "))
+	}
+	var flags []string
+	if l.Urgent {
+		flags = append(flags, "срочный")
+	}
+	if l.Recovered {
+		flags = append(flags, "из бэклога")
+	}
+	if l.FromImage {
+		flags = append(flags, "по изображению")
+	}
+	if l.Truncated {
+		flags = append(flags, "классифицирован по части текста")
+	}
+	if len(flags) > 0 {
+		b.WriteString("\nОтметки: " + strings.Join(flags, ", "))
+	}
+	if len(l.ForwardedTo) > 0 {
+		b.WriteString("\nПереслан: " + strings.Join(l.ForwardedTo, ", "))
+	} else {
+		b.WriteString("\nПереслан: нет")
+	}
+	if l.Label != nil {
+		b.WriteString("\nОценка админа: " + verdictMark(*l.Label))
+	}
+	if l.ShadowVerdict != nil {
+		b.WriteString("\nТеневой классификатор: " + verdictMark(*l.ShadowVerdict))
+	}
+	if l.ReplayVerdict != nil {
+		b.WriteString("\nПовторная проверка: " + verdictMark(*l.ReplayVerdict))
+	}
+	if len(l.Context) > 0 {
+		b.WriteString("\n\nКонтекст:")
+		for _, c := range l.Context {
+			b.WriteString("\n> " + c)
+		}
+	}
+	if l.ReplyTo != "" {
+		b.WriteString("\n\nВ ответ на: «" + l.ReplyTo + "»")
+	}
+	b.WriteString("\n\nСообщение:\n" + l.Text)
+	return truncateRunes(b.String(), maxReplyRunes), nil
+}
+
+func verdictMark(relevant bool) string {
+	if relevant {
+		return "👍"
+	}
+	return "👎"
+}
+
+// truncateRunes cuts s to at most n runes, marking the cut with "…".
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	r := []rune(s)
+	return string(r[:n-1]) + "…"
+}
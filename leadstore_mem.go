@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-faster/errors"
+)
+
+var (
+	_ LeadStore = (*PebbleLeadStore)(nil)
+	_ LeadStore = (*MemoryLeadStore)(nil)
+)
+
+// MemoryLeadStore is a LeadStore without disk I/O, for tests and
+// throwaway runs.
+type MemoryLeadStore struct {
+	mu    sync.Mutex
+	seq   uint64
+	leads map[uint64]Lead
+	seen  map[string]bool
+	edits map[string]seenEdit
+	texts map[string]seenText
+}
+
+type seenEdit struct {
+	date int
+	hash uint64
+}
+
+type seenText struct {
+	last   time.Time
+	chatID int64
+	msgID  int
+}
+
+func NewMemoryLeadStore() *MemoryLeadStore {
+	return &MemoryLeadStore{leads: map[uint64]Lead{}, seen: map[string]bool{}, edits: map[string]seenEdit{}, texts: map[string]seenText{}}
+}
+
+func (s *MemoryLeadStore) Save(_ context.Context, l *Lead) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if l.ID == 0 {
+		s.seq++
+		l.ID = s.seq
+	}
+	s.leads[l.ID] = cloneLead(*l)
+	return nil
+}
+
+func (s *MemoryLeadStore) Get(_ context.Context, id uint64) (Lead, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.leads[id]
+	if !ok {
+		return Lead{}, errors.Wrapf(ErrLeadNotFound, "get lead %d", id)
+	}
+	return cloneLead(l), nil
+}
+
+func (s *MemoryLeadStore) List(_ context.Context) ([]Lead, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]Lead, 0, len(s.leads))
+	for _, l := range s.leads {
+		out = append(out, cloneLead(l))
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out, nil
+}
+
+func (s *MemoryLeadStore) Update(_ context.Context, id uint64, fn func(l *Lead) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.leads[id]
+	if !ok {
+		return errors.Wrapf(ErrLeadNotFound, "get lead %d", id)
+	}
+	l = cloneLead(l)
+	if err := fn(&l); err != nil {
+		return err
+	}
+	l.ID = id
+	s.leads[id] = cloneLead(l)
+	return nil
+}
+
+func (s *MemoryLeadStore) MarkForwarded(ctx context.Context, id uint64, recipient string) error {
+	return s.Update(ctx, id, func(l *Lead) error {
+		l.ForwardedTo = append(l.ForwardedTo, recipient)
+		return nil
+	})
+}
+
+func (s *MemoryLeadStore) Seen(_ context.Context, chatID int64, msgID int, scope string) (bool, error) {
+	key := fmt.Sprintf("%d/%d/%s", chatID, msgID, scope)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.seen[key] {
+		return true, nil
+	}
+	s.seen[key] = true
+	return false, nil
+}
+
+func (s *MemoryLeadStore) EditSeen(_ context.Context, chatID int64, msgID, editDate int, textHash uint64) (bool, error) {
+	key := fmt.Sprintf("%d/%d", chatID, msgID)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.edits[key]; ok && (e.date >= editDate || e.hash == textHash) {
+		return true, nil
+	}
+	s.edits[key] = seenEdit{date: editDate, hash: textHash}
+	return false, nil
+}
+
+func (s *MemoryLeadStore) TextSeen(_ context.Context, hash string, chatID int64, msgID int, window time.Duration) (bool, error) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.texts[hash]; ok && now.Sub(t.last) <= window {
+		t.last = now
+		s.texts[hash] = t
+		return t.chatID != chatID || t.msgID != msgID, nil
+	}
+	s.texts[hash] = seenText{last: now, chatID: chatID, msgID: msgID}
+	return false, nil
+}
+
+func (s *MemoryLeadStore) PruneTexts(_ context.Context, window time.Duration) (int, error) {
+	cutoff := time.Now().Add(-window)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for hash, t := range s.texts {
+		if t.last.Before(cutoff) {
+			delete(s.texts, hash)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *MemoryLeadStore) CountByChat(_ context.Context, since time.Time) (map[int64]int, error) {
+	y, m, d := since.UTC().Date()
+	day := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := map[int64]int{}
+	for _, l := range s.leads {
+		if !l.CreatedAt.Before(day) {
+			out[l.ChatID]++
+		}
+	}
+	return out, nil
+}
+
+// cloneLead copies the slices and pointers of a lead, so callers can't
+// modify stored leads through them, as with the pebble store.
+func cloneLead(l Lead) Lead {
+	l.Tags = append([]string(nil), l.Tags...)
+	l.Context = append([]string(nil), l.Context...)
+	l.ForwardedTo = append([]string(nil), l.ForwardedTo...)
+	if l.ReplayVerdict != nil {
+		v := *l.ReplayVerdict
+		l.ReplayVerdict = &v
+	}
+	if l.ShadowVerdict != nil {
+		v := *l.ShadowVerdict
+		l.ShadowVerdict = &v
+	}
+	if l.Label != nil {
+		v := *l.Label
+		l.Label = &v
+	}
+	if l.Budget != nil {
+		v := *l.Budget
+		l.Budget = &v
+	}
+	return l
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	pebbledb "github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/vfs"
+	"github.com/go-faster/errors"
+)
+
+// testLeadStores returns a constructor for each LeadStore implementation,
+// so the same contract is checked against all of them.
+func testLeadStores() map[string]func(t *testing.T) LeadStore {
+	return map[string]func(t *testing.T) LeadStore{
+		"Pebble": func(t *testing.T) LeadStore {
+			db, err := pebbledb.Open("", &pebbledb.Options{FS: vfs.NewMem()})
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { _ = db.Close() })
+			return NewPebbleLeadStore(db)
+		},
+		"Memory": func(t *testing.T) LeadStore { return NewMemoryLeadStore() },
+	}
+}
+
+// runLeadStoreTest runs test as a subtest against every LeadStore.
+func runLeadStoreTest(t *testing.T, test func(t *testing.T, ctx context.Context, s LeadStore)) {
+	for name, newStore := range testLeadStores() {
+		t.Run(name, func(t *testing.T) {
+			test(t, context.Background(), newStore(t))
+		})
+	}
+}
+
+func TestLeadStoreSaveGet(t *testing.T) {
+	runLeadStoreTest(t, func(t *testing.T, ctx context.Context, s LeadStore) {
+		created := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+		first := Lead{Campaign: "dev", ChatID: 10, MsgID: 1, FromID: 200, Text: "нужен бот", Tags: []string{"a"}, Budget: &Budget{Amount: 500}, CreatedAt: created}
+		second := Lead{Campaign: "design", ChatID: 11, MsgID: 2, CreatedAt: created}
+		for _, l := range []*Lead{&first, &second} {
+			if err := s.Save(ctx, l); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if first.ID != 1 || second.ID != 2 {
+			t.Fatalf("IDs = %d, %d; want 1, 2", first.ID, second.ID)
+		}
+
+		got, err := s.Get(ctx, first.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Campaign != "dev" || got.Text != "нужен бот" || !slices.Equal(got.Tags, []string{"a"}) || !got.CreatedAt.Equal(created) {
+			t.Errorf("Get = %+v", got)
+		}
+		// The stored copy is not shared with the caller.
+		got.Tags[0] = "changed"
+		got.Budget.Amount = 1
+		if again, _ := s.Get(ctx, first.ID); again.Tags[0] != "a" || again.Budget.Amount != 500 {
+			t.Errorf("stored lead changed through a returned one: %v, %v", again.Tags, again.Budget)
+		}
+
+		first.Text = "edited"
+		if err := s.Save(ctx, &first); err != nil {
+			t.Fatal(err)
+		}
+		if first.ID != 1 {
+			t.Errorf("re-save changed the ID to %d", first.ID)
+		}
+		if got, _ := s.Get(ctx, 1); got.Text != "edited" {
+			t.Errorf("Text after re-save = %q", got.Text)
+		}
+
+		if _, err := s.Get(ctx, 42); !errors.Is(err, ErrLeadNotFound) {
+			t.Errorf("Get of a missing lead: %v, want ErrLeadNotFound", err)
+		}
+	})
+}
+
+func TestLeadStoreList(t *testing.T) {
+	runLeadStoreTest(t, func(t *testing.T, ctx context.Context, s LeadStore) {
+		if leads, err := s.List(ctx); err != nil || len(leads) != 0 {
+			t.Fatalf("List on an empty store = %v, %v", leads, err)
+		}
+		for i := 0; i < 12; i++ {
+			if err := s.Save(ctx, &Lead{Campaign: "dev", MsgID: i, CreatedAt: time.Now()}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		leads, err := s.List(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(leads) != 12 {
+			t.Fatalf("got %d leads, want 12", len(leads))
+		}
+		for i, l := range leads {
+			if l.ID != uint64(i+1) || l.MsgID != i {
+				t.Errorf("leads[%d] = #%d msg %d, want ID order", i, l.ID, l.MsgID)
+			}
+		}
+	})
+}
+
+func TestLeadStoreMarkForwarded(t *testing.T) {
+	runLeadStoreTest(t, func(t *testing.T, ctx context.Context, s LeadStore) {
+		l := Lead{Campaign: "dev", CreatedAt: time.Now()}
+		if err := s.Save(ctx, &l); err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range []string{"alice", "mailto:bob@example.com"} {
+			if err := s.MarkForwarded(ctx, l.ID, r); err != nil {
+				t.Fatal(err)
+			}
+		}
+		got, err := s.Get(ctx, l.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"alice", "mailto:bob@example.com"}; !slices.Equal(got.ForwardedTo, want) {
+			t.Errorf("ForwardedTo = %v, want %v", got.ForwardedTo, want)
+		}
+		if err := s.MarkForwarded(ctx, 42, "alice"); !errors.Is(err, ErrLeadNotFound) {
+			t.Errorf("MarkForwarded of a missing lead: %v, want ErrLeadNotFound", err)
+		}
+	})
+}
+
+func TestLeadStoreUpdate(t *testing.T) {
+	runLeadStoreTest(t, func(t *testing.T, ctx context.Context, s LeadStore) {
+		l := Lead{Campaign: "dev", Text: "нужен бот", CreatedAt: time.Now()}
+		if err := s.Save(ctx, &l); err != nil {
+			t.Fatal(err)
+		}
+		good := true
+		if err := s.Update(ctx, l.ID, func(l *Lead) error {
+			l.Label = &good
+			l.ID = 99 // the ID is not for fn to change
+			return nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+		failed := errors.New("rejected")
+		if err := s.Update(ctx, l.ID, func(l *Lead) error {
+			l.Text = "discarded"
+			return failed
+		}); !errors.Is(err, failed) {
+			t.Errorf("Update = %v, want fn's error", err)
+		}
+		got, err := s.Get(ctx, l.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Label == nil || !*got.Label || got.Text != "нужен бот" {
+			t.Errorf("after Update: label %v, text %q", got.Label, got.Text)
+		}
+		if _, err := s.Get(ctx, 99); !errors.Is(err, ErrLeadNotFound) {
+			t.Errorf("Update moved the lead to ID 99: %v", err)
+		}
+		if err := s.Update(ctx, 42, func(*Lead) error { return nil }); !errors.Is(err, ErrLeadNotFound) {
+			t.Errorf("Update of a missing lead: %v, want ErrLeadNotFound", err)
+		}
+	})
+}
+
+// TestLeadStoreConcurrentUpdates labels and forwards the same lead at
+// once; no write may be lost.
+func TestLeadStoreConcurrentUpdates(t *testing.T) {
+	runLeadStoreTest(t, func(t *testing.T, ctx context.Context, s LeadStore) {
+		l := Lead{Campaign: "dev", CreatedAt: time.Now()}
+		if err := s.Save(ctx, &l); err != nil {
+			t.Fatal(err)
+		}
+		const n = 50
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(2)
+			go func(i int) {
+				defer wg.Done()
+				if err := s.MarkForwarded(ctx, l.ID, fmt.Sprintf("r%d", i)); err != nil {
+					t.Error(err)
+				}
+			}(i)
+			go func(i int) {
+				defer wg.Done()
+				good := i%2 == 0
+				if err := s.Update(ctx, l.ID, func(l *Lead) error { l.Label = &good; return nil }); err != nil {
+					t.Error(err)
+				}
+			}(i)
+		}
+		wg.Wait()
+		got, err := s.Get(ctx, l.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got.ForwardedTo) != n || got.Label == nil {
+			t.Errorf("after concurrent updates: %d recipients, label %v", len(got.ForwardedTo), got.Label)
+		}
+	})
+}
+
+func TestLeadStoreSeen(t *testing.T) {
+	runLeadStoreTest(t, func(t *testing.T, ctx context.Context, s LeadStore) {
+		for _, tt := range []struct {
+			chatID int64
+			msgID  int
+			scope  string
+			seen   bool
+		}{
+			{chatID: 10, msgID: 1, scope: "dev"},
+			{chatID: 10, msgID: 1, scope: "dev", seen: true},
+			{chatID: 10, msgID: 1, scope: "design"},
+			{chatID: 10, msgID: 1, scope: "*"},
+			{chatID: 10, msgID: 2, scope: "dev"},
+			{chatID: 11, msgID: 1, scope: "dev"},
+			{chatID: 10, msgID: 1, scope: "*", seen: true},
+		} {
+			seen, err := s.Seen(ctx, tt.chatID, tt.msgID, tt.scope)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if seen != tt.seen {
+				t.Errorf("Seen(%d, %d, %q) = %v, want %v", tt.chatID, tt.msgID, tt.scope, seen, tt.seen)
+			}
+		}
+	})
+}
+
+func TestLeadStoreEditSeen(t *testing.T) {
+	runLeadStoreTest(t, func(t *testing.T, ctx context.Context, s LeadStore) {
+		for _, tt := range []struct {
+			name     string
+			msgID    int
+			editDate int
+			hash     uint64
+			seen     bool
+		}{
+			{name: "FirstEdit", msgID: 1, editDate: 100, hash: 1},
+			{name: "Redelivered", msgID: 1, editDate: 100, hash: 1, seen: true},
+			{name: "Older", msgID: 1, editDate: 90, hash: 2, seen: true},
+			{name: "SameText", msgID: 1, editDate: 110, hash: 1, seen: true},
+			{name: "NewText", msgID: 1, editDate: 120, hash: 3},
+			{name: "OtherMessage", msgID: 2, editDate: 100, hash: 1},
+		} {
+			seen, err := s.EditSeen(ctx, 10, tt.msgID, tt.editDate, tt.hash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if seen != tt.seen {
+				t.Errorf("%s: EditSeen = %v, want %v", tt.name, seen, tt.seen)
+			}
+		}
+	})
+}
+
+func TestLeadStoreCountByChat(t *testing.T) {
+	runLeadStoreTest(t, func(t *testing.T, ctx context.Context, s LeadStore) {
+		day := time.Date(2026, 3, 10, 15, 0, 0, 0, time.UTC)
+		for _, l := range []Lead{
+			{ChatID: 10, CreatedAt: day.AddDate(0, 0, -10)},
+			{ChatID: 10, CreatedAt: day.AddDate(0, 0, -1)},
+			{ChatID: 10, CreatedAt: day},
+			{ChatID: 11, CreatedAt: day.Add(-14 * time.Hour)}, // the same day, early
+			{ChatID: 12, CreatedAt: day.AddDate(0, 0, -2)},
+		} {
+			if err := s.Save(ctx, &l); err != nil {
+				t.Fatal(err)
+			}
+		}
+		counts, err := s.CountByChat(ctx, day.AddDate(0, 0, -1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(counts) != 2 || counts[10] != 2 || counts[11] != 1 {
+			t.Errorf("CountByChat = %v, want map[10:2 11:1]", counts)
+		}
+	})
+}
+
+func TestLeadStoreTextSeen(t *testing.T) {
+	runLeadStoreTest(t, func(t *testing.T, ctx context.Context, s LeadStore) {
+		const window = time.Hour
+		hash := contentHash("Нужен бот  для   магазина")
+		for _, tt := range []struct {
+			name   string
+			hash   string
+			chatID int64
+			msgID  int
+			seen   bool
+		}{
+			{name: "First", hash: hash, chatID: 10, msgID: 1},
+			{name: "SameMessage", hash: hash, chatID: 10, msgID: 1},
+			{name: "OtherChat", hash: hash, chatID: 11, msgID: 1, seen: true},
+			{name: "OtherMessage", hash: hash, chatID: 10, msgID: 2, seen: true},
+			{name: "FirstAgain", hash: hash, chatID: 10, msgID: 1},
+			{name: "OtherText", hash: contentHash("Нужен дизайнер"), chatID: 11, msgID: 1},
+		} {
+			seen, err := s.TextSeen(ctx, tt.hash, tt.chatID, tt.msgID, window)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if seen != tt.seen {
+				t.Errorf("%s: TextSeen = %v, want %v", tt.name, seen, tt.seen)
+			}
+		}
+		// Outside the window the text starts over with a new first message.
+		if seen, _ := s.TextSeen(ctx, hash, 12, 1, 0); seen {
+			t.Error("text seen outside the window")
+		}
+		if seen, _ := s.TextSeen(ctx, hash, 12, 1, window); seen {
+			t.Error("new first message reported as a repeat")
+		}
+	})
+}
+
+func TestLeadStorePruneTexts(t *testing.T) {
+	runLeadStoreTest(t, func(t *testing.T, ctx context.Context, s LeadStore) {
+		const window = time.Hour
+		old, fresh := contentHash("старый текст"), contentHash("свежий текст")
+		for _, h := range []string{old, fresh} {
+			if _, err := s.TextSeen(ctx, h, 10, 1, window); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if n, err := s.PruneTexts(ctx, window); err != nil || n != 0 {
+			t.Fatalf("PruneTexts within the window = %d, %v; want 0", n, err)
+		}
+		time.Sleep(20 * time.Millisecond)
+		if _, err := s.TextSeen(ctx, fresh, 11, 1, window); err != nil {
+			t.Fatal(err)
+		}
+		if n, err := s.PruneTexts(ctx, 10*time.Millisecond); err != nil || n != 1 {
+			t.Fatalf("PruneTexts = %d, %v; want 1", n, err)
+		}
+		// The pruned text starts over; the kept one is still a repeat.
+		if seen, _ := s.TextSeen(ctx, old, 12, 1, window); seen {
+			t.Error("pruned text reported as a repeat")
+		}
+		if seen, _ := s.TextSeen(ctx, fresh, 12, 1, window); !seen {
+			t.Error("kept text forgotten")
+		}
+	})
+}
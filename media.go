@@ -0,0 +1,84 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/tg"
+)
+
+// mediaTypes are the IGNORE_MEDIA_TYPES names mediaType can return.
+var mediaTypes = map[string]bool{
+	"photo": true, "video": true, "round": true, "gif": true, "sticker": true,
+	"voice": true, "audio": true, "document": true, "poll": true,
+	"contact": true, "location": true, "dice": true,
+}
+
+// mediaType names a message's media for IGNORE_MEDIA_TYPES, or returns ""
+// for text-only messages and media not listed in mediaTypes.
+func mediaType(msg *tg.Message) string {
+	switch m := msg.Media.(type) {
+	case *tg.MessageMediaPhoto:
+		return "photo"
+	case *tg.MessageMediaPoll:
+		return "poll"
+	case *tg.MessageMediaContact:
+		return "contact"
+	case *tg.MessageMediaGeo, *tg.MessageMediaGeoLive, *tg.MessageMediaVenue:
+		return "location"
+	case *tg.MessageMediaDice:
+		return "dice"
+	case *tg.MessageMediaDocument:
+		doc, ok := m.Document.(*tg.Document)
+		if !ok {
+			return "document"
+		}
+		kind := "document"
+		for _, attr := range doc.Attributes {
+			switch a := attr.(type) {
+			case *tg.DocumentAttributeSticker:
+				return "sticker"
+			case *tg.DocumentAttributeAnimated:
+				return "gif"
+			case *tg.DocumentAttributeAudio:
+				if a.Voice {
+					return "voice"
+				}
+				kind = "audio"
+			case *tg.DocumentAttributeVideo:
+				if a.RoundMessage {
+					return "round"
+				}
+				kind = "video"
+			}
+		}
+		return kind
+	default:
+		return ""
+	}
+}
+
+// parseMediaTypes parses the comma-separated IGNORE_MEDIA_TYPES list.
+func parseMediaTypes(s string) (map[string]bool, error) {
+	out := map[string]bool{}
+	for _, t := range strings.Split(s, ",") {
+		if t = strings.ToLower(strings.TrimSpace(t)); t == "" {
+			continue
+		}
+		if !mediaTypes[t] {
+			return nil, errors.Errorf("IGNORE_MEDIA_TYPES: unknown media type %q", t)
+		}
+		out[t] = true
+	}
+	return out, nil
+}
+
+// ignoredMedia reports whether msg carries an IGNORE_MEDIA_TYPES media
+// type. With IGNORE_MEDIA_KEEP_CAPTIONED, media with a caption are kept,
+// since the caption may carry the lead.
+func (a *App) ignoredMedia(msg *tg.Message) bool {
+	if len(a.cfg.IgnoreMediaTypes) == 0 || !a.cfg.IgnoreMediaTypes[mediaType(msg)] {
+		return false
+	}
+	return !a.cfg.KeepCaptionedMedia || strings.TrimSpace(msg.Message) == ""
+}
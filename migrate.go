@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	pebbledb "github.com/cockroachdb/pebble"
+	"github.com/go-faster/errors"
+	"go.etcd.io/bbolt"
+)
+
+var schemaVersionKey = []byte("meta/schema_version")
+
+// migration upgrades the pebble store by one schema version and describes
+// what it did.
+type migration struct {
+	name string
+	run  func(db *pebbledb.DB) (string, error)
+}
+
+// migrations are applied in order; migration i takes the store from
+// version i to i+1. Append new ones, never reorder or edit shipped ones.
+var migrations = []migration{
+	{"rebuild per-chat lead counters from stored leads", rebuildChatCounts},
+}
+
+func schemaLatest() int { return len(migrations) }
+
+func readSchemaVersion(db *pebbledb.DB) (int, bool, error) {
+	v, closer, err := db.Get(schemaVersionKey)
+	if errors.Is(err, pebbledb.ErrNotFound) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, errors.Wrap(err, "get schema version")
+	}
+	defer closer.Close()
+	return int(binary.BigEndian.Uint64(v)), true, nil
+}
+
+func writeSchemaVersion(db *pebbledb.DB, version int) error {
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], uint64(version))
+	return errors.Wrap(db.Set(schemaVersionKey, buf[:], pebbledb.Sync), "set schema version")
+}
+
+// checkSchema runs at startup. A new store is stamped with the latest
+// version; an older one only gets a hint to run -migrate, since the code
+// still reads it. A store from a newer build is refused.
+func checkSchema(db *pebbledb.DB, leads LeadStore, out io.Writer) error {
+	version, ok, err := readSchemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		stored, err := leads.List(context.Background())
+		if err != nil {
+			return err
+		}
+		if len(stored) == 0 {
+			return writeSchemaVersion(db, schemaLatest())
+		}
+	}
+	switch {
+	case version > schemaLatest():
+		return errors.Errorf("storage schema v%d is newer than this build supports (v%d), upgrade the binary", version, schemaLatest())
+	case version < schemaLatest():
+		fmt.Fprintf(out, "Storage schema v%d is older than v%d, run with -migrate to upgrade (a backup is made first)\n", version, schemaLatest())
+	}
+	return nil
+}
+
+type migrateReport struct {
+	From, To int
+	Backup   string
+	Steps    []string
+}
+
+func (r migrateReport) String() string {
+	if r.From == r.To {
+		return fmt.Sprintf("Storage schema is up to date (v%d)", r.To)
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "Migrated storage from v%d to v%d, backup in %s", r.From, r.To, r.Backup)
+	for _, s := range r.Steps {
+		b.WriteString("\n  " + s)
+	}
+	return b.String()
+}
+
+// Migrate backs up the session databases and applies pending migrations
+// in order, recording the version after each so an interrupted run
+// resumes where it stopped.
+func (a *App) Migrate(ctx context.Context) (migrateReport, error) {
+	version, _, err := readSchemaVersion(a.db)
+	if err != nil {
+		return migrateReport{}, err
+	}
+	rep := migrateReport{From: version, To: version}
+	if version >= schemaLatest() {
+		return rep, nil
+	}
+
+	rep.Backup = filepath.Join(a.sessionDir, "backup-"+time.Now().Format("20060102-150405"))
+	if err := a.db.Checkpoint(filepath.Join(rep.Backup, "peers.pebble.db")); err != nil {
+		return rep, errors.Wrap(err, "backup pebble")
+	}
+	if err := a.boltdb.View(func(tx *bbolt.Tx) error {
+		return tx.CopyFile(filepath.Join(rep.Backup, "updates.bolt.db"), 0o600)
+	}); err != nil {
+		return rep, errors.Wrap(err, "backup bolt")
+	}
+
+	for v := version; v < schemaLatest(); v++ {
+		if err := ctx.Err(); err != nil {
+			return rep, err
+		}
+		m := migrations[v]
+		done, err := m.run(a.db)
+		if err != nil {
+			return rep, errors.Wrapf(err, "migration v%d→v%d (%s)", v, v+1, m.name)
+		}
+		if err := writeSchemaVersion(a.db, v+1); err != nil {
+			return rep, err
+		}
+		rep.To = v + 1
+		rep.Steps = append(rep.Steps, fmt.Sprintf("v%d→v%d %s: %s", v, v+1, m.name, done))
+	}
+	return rep, nil
+}
+
+// rebuildChatCounts recomputes the chatleads/ counters behind /topchats
+// from every stored lead, so leads saved before the counters existed are
+// included.
+func rebuildChatCounts(db *pebbledb.DB) (string, error) {
+	leads, err := NewPebbleLeadStore(db).List(context.Background())
+	if err != nil {
+		return "", err
+	}
+	counts := map[string]uint64{}
+	for _, l := range leads {
+		counts[string(chatCountKey(l.CreatedAt, l.ChatID))]++
+	}
+
+	b := db.NewBatch()
+	defer b.Close()
+	if err := b.DeleteRange([]byte("chatleads/"), []byte("chatleads0"), nil); err != nil {
+		return "", errors.Wrap(err, "clear chat counts")
+	}
+	for k, n := range counts {
+		var buf [8]byte
+		binary.BigEndian.PutUint64(buf[:], n)
+		if err := b.Set([]byte(k), buf[:], nil); err != nil {
+			return "", errors.Wrap(err, "set chat count")
+		}
+	}
+	if err := b.Commit(pebbledb.Sync); err != nil {
+		return "", errors.Wrap(err, "commit chat counts")
+	}
+	return fmt.Sprintf("%d leads counted into %d chat/day counters", len(leads), len(counts)), nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+
+	"github.com/gotd/td/tg"
+)
+
+var urlRe = regexp.MustCompile(`(?i)\b(?:https?://|www\.|t\.me/)\S+`)
+
+// maxPunctRun is how many repeats of the same punctuation mark are kept.
+const maxPunctRun = 3
+
+// normalizeText cleans classifier input: it drops control and invisible
+// format characters (zero-width spaces, BOMs, …) except those joining an
+// emoji sequence, limits runs of repeated punctuation, collapses spaces
+// within lines and blank lines between them, and optionally removes URLs. Stored and forwarded text is left as is.
+func normalizeText(s string, stripURLs bool) string {
+	if stripURLs {
+		s = urlRe.ReplaceAllString(s, " ")
+	}
+
+	var b strings.Builder
+	var (
+		prev    rune
+		run     int
+		space   bool // pending space within a line
+		newline int  // pending newlines, at most two are kept
+	)
+	for _, r := range s {
+		switch {
+		case r == '\n':
+			space = false
+			newline++
+			continue
+		case unicode.IsSpace(r):
+			space = true
+			continue
+		case unicode.IsControl(r) || unicode.Is(unicode.Cf, r):
+			if !emojiJoiner(r, prev) {
+				continue
+			}
+		}
+
+		if b.Len() > 0 {
+			if newline > 0 {
+				b.WriteString(strings.Repeat("\n", min(newline, 2)))
+			} else if space {
+				b.WriteByte(' ')
+			}
+		}
+		if newline > 0 || space {
+			prev, run = 0, 0
+		}
+		space, newline = false, 0
+
+		if r == prev && unicode.IsPunct(r) {
+			if run++; run > maxPunctRun {
+				continue
+			}
+		} else {
+			prev, run = r, 1
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// emojiJoiner reports whether the format character r continues an emoji
+// sequence after prev: a zero-width joiner (👩‍💻) or a tag character
+// of a subdivision flag (🏴 + tags for England). Dropping them would
+// split the emoji into unrelated ones.
+func emojiJoiner(r, prev rune) bool {
+	if r != '\u200d' && !isEmojiTag(r) {
+		return false
+	}
+	return unicode.Is(unicode.So, prev) || unicode.Is(unicode.Sk, prev) ||
+		prev == '\ufe0f' || prev == '\u200d' || isEmojiTag(prev)
+}
+
+func isEmojiTag(r rune) bool { return r >= 0xE0020 && r <= 0xE007F }
+
+// stripCustomEmoji replaces each custom emoji in text with a space. Their
+// placeholder characters mean nothing without the Premium sticker set, to
+// the classifier or the admin reading the summary. Entity offsets are in
+// UTF-16 code units.
+func stripCustomEmoji(text string, entities []tg.MessageEntityClass) string {
+	var units []uint16
+	var b strings.Builder
+	pos := 0
+	for _, e := range entities {
+		ce, ok := e.(*tg.MessageEntityCustomEmoji)
+		if !ok {
+			continue
+		}
+		if units == nil {
+			units = utf16.Encode([]rune(text))
+		}
+		start, end := ce.Offset, ce.Offset+ce.Length
+		if start < pos || end > len(units) {
+			continue
+		}
+		b.WriteString(string(utf16.Decode(units[pos:start])))
+		b.WriteByte(' ')
+		pos = end
+	}
+	if units == nil {
+		return text
+	}
+	b.WriteString(string(utf16.Decode(units[pos:])))
+	return b.String()
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/gotd/td/tg"
+)
+
+func customEmoji(offset, length int) *tg.MessageEntityCustomEmoji {
+	return &tg.MessageEntityCustomEmoji{Offset: offset, Length: length, DocumentID: 1}
+}
+
+func TestStripCustomEmoji(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		text     string
+		entities []tg.MessageEntityClass
+		want     string
+	}{
+		{name: "NoEntities", text: "Ищу дизайнера 🔥", want: "Ищу дизайнера 🔥"},
+		{
+			name:     "OtherEntities",
+			text:     "Ищу дизайнера",
+			entities: []tg.MessageEntityClass{&tg.MessageEntityBold{Offset: 0, Length: 3}},
+			want:     "Ищу дизайнера",
+		},
+		{
+			name:     "Middle",
+			text:     "Ищу 🔥 дизайнера",
+			entities: []tg.MessageEntityClass{customEmoji(4, 2)},
+			want:     "Ищу   дизайнера",
+		},
+		{
+			name:     "StartAndEnd",
+			text:     "🔥Нужен бот🚀",
+			entities: []tg.MessageEntityClass{customEmoji(0, 2), customEmoji(11, 2)},
+			want:     " Нужен бот ",
+		},
+		{
+			// Offsets count UTF-16 units: the astral 😀 before the custom
+			// emoji takes two.
+			name:     "AfterAstralCharacter",
+			text:     "😀 ок ⭐ готово",
+			entities: []tg.MessageEntityClass{customEmoji(6, 1)},
+			want:     "😀 ок   готово",
+		},
+		{
+			name:     "Adjacent",
+			text:     "💎💎 VIP",
+			entities: []tg.MessageEntityClass{customEmoji(0, 2), customEmoji(2, 2)},
+			want:     "   VIP",
+		},
+		{
+			name:     "OutOfRange",
+			text:     "ок",
+			entities: []tg.MessageEntityClass{customEmoji(1, 5)},
+			want:     "ок",
+		},
+		{
+			name:     "Overlapping",
+			text:     "🔥🔥 ок",
+			entities: []tg.MessageEntityClass{customEmoji(0, 4), customEmoji(2, 2)},
+			want:     "  ок",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := stripCustomEmoji(tt.text, tt.entities); got != tt.want {
+				t.Errorf("stripCustomEmoji = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestExtractTextCustomEmoji checks the classifier input for a message
+// decorated with custom emoji, as normalized for OpenAI.
+func TestExtractTextCustomEmoji(t *testing.T) {
+	a := newTestApp(t, testConfig(), RegexClassifier{})
+	msg := groupMessage(1, 2, 3, "🔥🔥 Ищем 💻 разработчика 🔥")
+	msg.Entities = []tg.MessageEntityClass{customEmoji(0, 2), customEmoji(2, 2), customEmoji(10, 2), customEmoji(26, 2)}
+	if got, want := normalizeText(a.extractText(msg), false), "Ищем разработчика"; got != want {
+		t.Errorf("classifier input = %q, want %q", got, want)
+	}
+}
+
+func TestNormalizeText(t *testing.T) {
+	const englandFlag = "🏴\U000E0067\U000E0062\U000E0065\U000E006E\U000E0067\U000E007F"
+	for _, tt := range []struct {
+		name      string
+		in        string
+		stripURLs bool
+		want      string
+	}{
+		{name: "Empty", in: "", want: ""},
+		{name: "Plain", in: "Ищем Go-разработчика", want: "Ищем Go-разработчика"},
+		{name: "MixedScript", in: "Нужен fullstack (React + Node.js) для SaaS", want: "Нужен fullstack (React + Node.js) для SaaS"},
+		{name: "ZeroWidthInWord", in: "раз\u200bработ\u200cчик\u2060", want: "разработчик"},
+		{name: "BOM", in: "\ufeffПривет", want: "Привет"},
+		{name: "SoftHyphen", in: "раз\u00adработка", want: "разработка"},
+		{name: "BidiMarks", in: "\u202eнужен\u202c бот \u200fשלום\u200e", want: "нужен бот שלום"},
+		{name: "ControlChars", in: "бот\x00\x07 нужен\x1b", want: "бот нужен"},
+		{name: "Homoglyphs", in: "Нужен Gо-бот", want: "Нужен Gо-бот"}, // Cyrillic о is left alone
+		{name: "CombiningMarks", in: "и\u0306 е\u0308", want: "и\u0306 е\u0308"},
+		{name: "NoBreakAndWideSpaces", in: "нужен\u00a0\u00a0бот\u3000срочно\u2009!", want: "нужен бот срочно !"},
+		{name: "Tabs", in: "\tнужен\t\tбот  ", want: "нужен бот"},
+		{name: "CRLF", in: "строка 1\r\nстрока 2", want: "строка 1\nстрока 2"},
+		{name: "BlankLines", in: "a\n\n\n\n\nb\n \n c", want: "a\n\nb\n\nc"},
+		{name: "LeadingTrailingBlank", in: "\n\n  текст  \n\n", want: "текст"},
+		{name: "RepeatedPunctuation", in: "Срочно!!!!!!! Кто???? ...... ok", want: "Срочно!!! Кто??? ... ok"},
+		{name: "MixedPunctuationKept", in: "?!?!?!", want: "?!?!?!"},
+		{name: "PunctuationRunAcrossSpace", in: "!!! !!!", want: "!!! !!!"},
+		{name: "Emoji", in: "🔥🔥🔥🔥 Нужен дизайнер 🎨", want: "🔥🔥🔥🔥 Нужен дизайнер 🎨"},
+		{name: "EmojiZWJSequence", in: "Ищем 👩\u200d💻 и 👨\u200d👩\u200d👧", want: "Ищем 👩\u200d💻 и 👨\u200d👩\u200d👧"},
+		{name: "EmojiSkinTone", in: "👍🏽 ок", want: "👍🏽 ок"},
+		{name: "EmojiVariationSelector", in: "❤\ufe0f\u200d🔥 1\ufe0f\u20e3", want: "❤\ufe0f\u200d🔥 1\ufe0f\u20e3"},
+		{name: "FlagEmoji", in: "🇷🇺 " + englandFlag, want: "🇷🇺 " + englandFlag},
+		{name: "StrayJoiner", in: "\u200dнужен бот\u200d", want: "нужен бот"},
+		{name: "StrayTag", in: "бот\U000E0067", want: "бот"},
+		{name: "URLKept", in: "Пишите https://t.me/job", want: "Пишите https://t.me/job"},
+		{name: "URLStripped", in: "Пишите https://t.me/job или www.example.com сюда", stripURLs: true, want: "Пишите или сюда"},
+		{name: "URLOnly", in: "https://example.com/x", stripURLs: true, want: ""},
+		{name: "TMeLink", in: "Вакансия t.me/jobs/42!", stripURLs: true, want: "Вакансия"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeText(tt.in, tt.stripURLs); got != tt.want {
+				t.Errorf("normalizeText(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
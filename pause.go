@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+
+	pebbledb "github.com/cockroachdb/pebble"
+	"github.com/go-faster/errors"
+	"go.uber.org/zap"
+)
+
+var pauseKey = []byte("meta/paused_until")
+
+// pausedForever marks a /pause without a duration.
+const pausedForever = -1
+
+// loadPause restores the pause state saved by /pause, so a restart does
+// not silently resume forwarding.
+func (a *App) loadPause() error {
+	v, closer, err := a.db.Get(pauseKey)
+	if errors.Is(err, pebbledb.ErrNotFound) {
+		return nil
+	}
+	if err != nil {
+		return errors.Wrap(err, "get pause")
+	}
+	defer closer.Close()
+	a.pausedUntil.Store(int64(binary.BigEndian.Uint64(v)))
+	return nil
+}
+
+// setPause pauses forwarding until the given UnixNano time, forever for
+// pausedForever, or resumes it for zero.
+func (a *App) setPause(until int64) error {
+	if until == 0 {
+		if err := a.db.Delete(pauseKey, pebbledb.Sync); err != nil {
+			return errors.Wrap(err, "delete pause")
+		}
+	} else {
+		var buf [8]byte
+		binary.BigEndian.PutUint64(buf[:], uint64(until))
+		if err := a.db.Set(pauseKey, buf[:], pebbledb.Sync); err != nil {
+			return errors.Wrap(err, "save pause")
+		}
+	}
+	a.pausedUntil.Store(until)
+	return nil
+}
+
+// paused reports whether forwarding is paused at t.
+func (a *App) paused(t time.Time) bool {
+	until := a.pausedUntil.Load()
+	return until == pausedForever || t.UnixNano() < until
+}
+
+// pauseCommand handles "/pause [duration]".
+func (a *App) pauseCommand(args string) (string, error) {
+	until := int64(pausedForever)
+	if args != "" {
+		d, err := time.ParseDuration(args)
+		if err != nil || d <= 0 {
+			return fmt.Sprintf("invalid duration %q, e.g. /pause 1h", args), nil
+		}
+		until = time.Now().Add(d).UnixNano()
+	}
+	if err := a.setPause(until); err != nil {
+		return "", err
+	}
+	a.lg.Info("Forwarding paused", zap.Int64("until", until))
+	if until == pausedForever {
+		return "Пересылка приостановлена до /resume", nil
+	}
+	return fmt.Sprintf("Пересылка приостановлена до %s", time.Unix(0, until).Format("15:04")), nil
+}
+
+// resumeCommand handles "/resume" and delivers leads queued meanwhile.
+func (a *App) resumeCommand() (string, error) {
+	if err := a.setPause(0); err != nil {
+		return "", err
+	}
+	a.lg.Info("Forwarding resumed")
+	items, err := a.queue.List()
+	if err != nil {
+		return "", err
+	}
+	select {
+	case a.flushNow <- struct{}{}:
+	default:
+	}
+	return fmt.Sprintf("Пересылка возобновлена, в очереди: %d", len(items)), nil
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/contrib/storage"
+	"github.com/gotd/td/telegram/query/dialogs"
+	"github.com/gotd/td/tg"
+	"github.com/gotd/td/tgerr"
+)
+
+func getChatID(peer tg.PeerClass) int64 {
+	switch p := peer.(type) {
+	case *tg.PeerUser:
+		return p.UserID
+	case *tg.PeerChat:
+		return p.ChatID
+	case *tg.PeerChannel:
+		return p.ChannelID
+	default:
+		return 0
+	}
+}
+
+func getPeerKind(peer tg.PeerClass) dialogs.PeerKind {
+	switch peer.(type) {
+	case *tg.PeerUser:
+		return dialogs.User
+	case *tg.PeerChat:
+		return dialogs.Chat
+	case *tg.PeerChannel:
+		return dialogs.Channel
+	default:
+		return dialogs.User
+	}
+}
+
+// messageLink returns a t.me link to a message in a channel or
+// supergroup; basic groups and private chats have none.
+func messageLink(p storage.Peer, msgID int) string {
+	if p.Key.Kind != dialogs.Channel {
+		return ""
+	}
+	if p.Channel != nil && p.Channel.Username != "" {
+		return fmt.Sprintf("https://t.me/%s/%d", p.Channel.Username, msgID)
+	}
+	return fmt.Sprintf("https://t.me/c/%d/%d", p.Key.ID, msgID)
+}
+
+// contactLink returns a link that opens a private chat with the author:
+// their t.me username link if they have one, a tg://user link otherwise.
+func contactLink(sender *tg.User, fromID int64, post bool) string {
+	switch {
+	case post:
+		return ""
+	case sender != nil && sender.Username != "":
+		return "https://t.me/" + sender.Username
+	case fromID != 0:
+		return fmt.Sprintf("tg://user?id=%d", fromID)
+	default:
+		return ""
+	}
+}
+
+// channelName is how channel posts are attributed in summaries.
+func channelName(p storage.Peer) string {
+	switch {
+	case p.Channel == nil:
+		return "channel"
+	case p.Channel.Username != "":
+		return "@" + p.Channel.Username
+	default:
+		return p.Channel.Title
+	}
+}
+
+// UnknownUsernameError reports a recipient username that does not exist
+// or is malformed, which retrying can't fix.
+type UnknownUsernameError struct {
+	Username string
+	// Role says where the username is configured, e.g. ADMIN_USERNAME.
+	Role string
+	Code string
+}
+
+func (e *UnknownUsernameError) Error() string {
+	msg := fmt.Sprintf("username %s", e.Username)
+	if e.Role != "" {
+		msg += fmt.Sprintf(" (%s)", e.Role)
+	}
+	if e.Code == "USERNAME_INVALID" {
+		return msg + " is not a valid Telegram username, fix it in the configuration"
+	}
+	return msg + " does not exist on Telegram, check the spelling in the configuration"
+}
+
+// isSelfRecipient reports whether a recipient is "me", the account's own
+// Saved Messages. Real usernames are at least five characters long.
+func isSelfRecipient(r string) bool {
+	return strings.EqualFold(trimAt(r), "me")
+}
+
+func resolveAdminPeer(ctx context.Context, api *tg.Client, username string) (tg.InputPeerClass, error) {
+	if isSelfRecipient(username) {
+		return &tg.InputPeerSelf{}, nil
+	}
+	resp, err := api.ContactsResolveUsername(ctx, &tg.ContactsResolveUsernameRequest{
+		Username: trimAt(username),
+	})
+	if rpcErr, ok := tgerr.As(err); ok && rpcErr.IsOneOf("USERNAME_NOT_OCCUPIED", "USERNAME_INVALID") {
+		return nil, &UnknownUsernameError{Username: username, Code: rpcErr.Type}
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "resolve username")
+	}
+	for _, u := range resp.Users {
+		if user, ok := u.(*tg.User); ok {
+			return &tg.InputPeerUser{UserID: user.ID, AccessHash: user.AccessHash}, nil
+		}
+	}
+	return nil, errors.New("admin user not found")
+}
+
+// resolveRecipients resolves every Telegram recipient, retrying each with
+// exponential backoff up to AdminResolveRetries extra attempts. Email
+// recipients are skipped; unknown usernames fail at once, naming where
+// they are configured.
+func resolveRecipients(ctx context.Context, api *tg.Client, cfg Config, out io.Writer) (map[string]tg.InputPeerClass, error) {
+	peers := map[string]tg.InputPeerClass{}
+	for _, r := range cfg.recipients() {
+		if isEmailRecipient(r) {
+			continue
+		}
+		peer, err := resolveWithRetry(ctx, api, r, cfg.AdminResolveRetries, out)
+		if err != nil {
+			return nil, cfg.withRecipientRole(err, r)
+		}
+		peers[r] = peer
+	}
+	return peers, nil
+}
+
+func resolveWithRetry(ctx context.Context, api *tg.Client, username string, retries int, out io.Writer) (tg.InputPeerClass, error) {
+	var (
+		peer  tg.InputPeerClass
+		err   error
+		delay = time.Second
+	)
+	for attempt := 0; attempt <= retries; attempt++ {
+		if attempt > 0 {
+			fmt.Fprintf(out, "resolve %s failed (%v), retrying in %s\n", username, err, delay)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			delay = min(delay*2, 30*time.Second)
+		}
+		if peer, err = resolveAdminPeer(ctx, api, username); err == nil {
+			return peer, nil
+		}
+		var unknown *UnknownUsernameError
+		if errors.As(err, &unknown) {
+			return nil, err
+		}
+	}
+	return nil, errors.Wrapf(err, "resolve %s", username)
+}
+
+func trimAt(s string) string {
+	if len(s) > 0 && s[0] == '@' {
+		return s[1:]
+	}
+	return s
+}
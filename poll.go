@@ -0,0 +1,44 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/gotd/td/tg"
+)
+
+// extractText returns the text a message is classified and summarized
+// by: its own text, with custom emoji blanked out, plus, with
+// INCLUDE_POLLS, a poll's question and options, which otherwise carry no
+// text at all.
+func (a *App) extractText(msg *tg.Message) string {
+	text := stripCustomEmoji(msg.Message, msg.Entities)
+	if !a.cfg.IncludePolls {
+		return text
+	}
+	media, ok := msg.Media.(*tg.MessageMediaPoll)
+	if !ok {
+		return text
+	}
+	poll := formatPoll(media.Poll)
+	if strings.TrimSpace(text) == "" {
+		return poll
+	}
+	return text + "\n\n" + poll
+}
+
+// formatPoll renders a poll as the question followed by one option per
+// line.
+func formatPoll(p tg.Poll) string {
+	var b strings.Builder
+	if p.Quiz {
+		b.WriteString("📊 Викторина: ")
+	} else {
+		b.WriteString("📊 Опрос: ")
+	}
+	b.WriteString(stripCustomEmoji(p.Question.Text, p.Question.Entities))
+	for _, ans := range p.Answers {
+		b.WriteString("\n• ")
+		b.WriteString(stripCustomEmoji(ans.Text.Text, ans.Text.Entities))
+	}
+	return b.String()
+}
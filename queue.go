@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	pebbledb "github.com/cockroachdb/pebble"
+	"github.com/go-faster/errors"
+	"go.uber.org/zap"
+)
+
+// DeliveryQueue holds forwards that are deferred until they can be sent,
+// such as leads found outside ACTIVE_HOURS. It lives in pebble so a
+// restart does not lose them.
+type DeliveryQueue struct {
+	db *pebbledb.DB
+}
+
+type queuedDelivery struct {
+	LeadID    uint64
+	Recipient string
+}
+
+type deliveryKey struct{}
+
+// withDelivery tags a send context with the lead being delivered, so
+// middleware callbacks (e.g. FLOOD_WAIT) can attribute delays to it.
+func withDelivery(ctx context.Context, d queuedDelivery) context.Context {
+	return context.WithValue(ctx, deliveryKey{}, d)
+}
+
+func deliveryFromContext(ctx context.Context) (queuedDelivery, bool) {
+	d, ok := ctx.Value(deliveryKey{}).(queuedDelivery)
+	return d, ok
+}
+
+// errDeferred reports that a delivery was queued instead of sent, so the
+// caller must not treat it as delivered.
+var errDeferred = errors.New("delivery deferred")
+
+var queuePrefix = []byte("queue/")
+
+func NewDeliveryQueue(db *pebbledb.DB) *DeliveryQueue {
+	return &DeliveryQueue{db: db}
+}
+
+func (q *DeliveryQueue) key(d queuedDelivery) []byte {
+	return []byte(fmt.Sprintf("%s%020d/%s", queuePrefix, d.LeadID, d.Recipient))
+}
+
+func (q *DeliveryQueue) Push(d queuedDelivery) error {
+	if err := q.db.Set(q.key(d), nil, pebbledb.Sync); err != nil {
+		return errors.Wrap(err, "queue push")
+	}
+	return nil
+}
+
+func (q *DeliveryQueue) Remove(d queuedDelivery) error {
+	if err := q.db.Delete(q.key(d), pebbledb.Sync); err != nil {
+		return errors.Wrap(err, "queue remove")
+	}
+	return nil
+}
+
+// List returns queued deliveries in lead order.
+func (q *DeliveryQueue) List() ([]queuedDelivery, error) {
+	iter, err := q.db.NewIter(&pebbledb.IterOptions{
+		LowerBound: queuePrefix,
+		UpperBound: []byte("queue0"), // '0' follows '/'
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "queue iter")
+	}
+	defer iter.Close()
+
+	var out []queuedDelivery
+	for iter.First(); iter.Valid(); iter.Next() {
+		rest := strings.TrimPrefix(string(iter.Key()), string(queuePrefix))
+		id, recipient, ok := strings.Cut(rest, "/")
+		if !ok {
+			continue
+		}
+		leadID, err := strconv.ParseUint(id, 10, 64)
+		if err != nil {
+			continue
+		}
+		out = append(out, queuedDelivery{LeadID: leadID, Recipient: recipient})
+	}
+	return out, iter.Error()
+}
+
+// canDeliver reports whether forwards may be sent at t: inside the
+// active-hours window, past the startup grace and not paused.
+func (a *App) canDeliver(t time.Time) bool {
+	return a.cfg.ActiveHours.Contains(t) && !a.inGrace(t) && !a.paused(t)
+}
+
+// flushQueue delivers queued leads whenever delivery is allowed, checking
+// every minute or right after /resume.
+func (a *App) flushQueue(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		if a.canDeliver(time.Now()) {
+			a.flushQueueOnce(ctx)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-a.flushNow:
+		}
+	}
+}
+
+func (a *App) flushQueueOnce(ctx context.Context) {
+	items, err := a.queue.List()
+	if err != nil {
+		a.lg.Error("List queue", zap.Error(err))
+		return
+	}
+	for _, d := range items {
+		lead, err := a.leads.Get(ctx, d.LeadID)
+		if err != nil {
+			a.lg.Error("Load queued lead", zap.Uint64("lead_id", d.LeadID), zap.Error(err))
+			continue
+		}
+		if err := a.forward(ctx, lead, d.Recipient); err != nil && !errors.Is(err, errRecipientUnreachable) {
+			continue
+		}
+		if err := a.queue.Remove(d); err != nil {
+			a.lg.Error("Remove queued lead", zap.Uint64("lead_id", d.LeadID), zap.Error(err))
+		}
+	}
+}
+
+// deferOnShutdown queues a send that was cut off by shutdown, so it goes
+// out on the next start instead of being lost.
+func (a *App) deferOnShutdown(lead Lead, recipient string) error {
+	d := queuedDelivery{LeadID: lead.ID, Recipient: recipient}
+	if err := a.queue.Push(d); err != nil {
+		a.lg.Error("Queue deferred lead", zap.Uint64("lead_id", lead.ID), zap.Error(err))
+		return err
+	}
+	a.lg.Info("Delivery deferred due to shutdown",
+		zap.Uint64("lead_id", lead.ID),
+		zap.String("recipient", recipient),
+	)
+	return errDeferred
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-faster/errors"
+	"github.com/joho/godotenv"
+	"go.uber.org/zap"
+)
+
+// envFile is the file CONFIG_RELOAD watches, the one main loads.
+const envFile = ".env"
+
+// liveConfig is the configuration as last (re)loaded. Handlers read the
+// reloadable settings from it rather than App.cfg, which stays as it was
+// at startup.
+type liveConfig struct {
+	Config
+	// hooks are the built-in lead hooks for this configuration plus the
+	// custom ones.
+	hooks []LeadHook
+}
+
+// live returns the current configuration.
+func (a *App) live() *liveConfig {
+	return a.liveCfg.Load()
+}
+
+func (a *App) newLiveConfig(cfg Config) *liveConfig {
+	return &liveConfig{Config: cfg, hooks: append([]LeadHook{
+		dedupHook(a.leads, cfg.DedupScope),
+		contentSpamHook(a.leads, cfg.SpamContentWindow, &a.stats),
+		minScoreHook(cfg.MinScore),
+		formulaHook(cfg.ScoreFormula),
+		confidenceHook(cfg.ChatConfidence),
+		a.cooldown,
+		budgetHook(cfg.MinBudget),
+		spreadHook(cfg.SpamChatThreshold),
+	}, customHooks...)}
+}
+
+// liveRegexRules classifies with the REGEX_RULES_FILE rules as last
+// (re)loaded, so a campaign added by CONFIG_RELOAD gets its patterns.
+type liveRegexRules struct {
+	a *App
+}
+
+func (r liveRegexRules) Classify(ctx context.Context, c Campaign, text string) (verdict, error) {
+	return r.a.live().RegexRules.Classify(ctx, c, text)
+}
+
+// withReloadable returns cfg with the settings CONFIG_RELOAD may change
+// taken from fresh: campaigns (prompts and routing) with their regex
+// rules, urgent keywords and the lead thresholds.
+func withReloadable(cfg, fresh Config) Config {
+	cfg.Campaigns = fresh.Campaigns
+	cfg.RegexRulesFile = fresh.RegexRulesFile
+	cfg.RegexRules = fresh.RegexRules
+	cfg.MatchFirst = fresh.MatchFirst
+	cfg.UrgentKeywords = fresh.UrgentKeywords
+	cfg.MinScore = fresh.MinScore
+	cfg.ScoreFormula = fresh.ScoreFormula
+	cfg.MinBudget = fresh.MinBudget
+	cfg.ChatConfidence = fresh.ChatConfidence
+	cfg.SpamChatThreshold = fresh.SpamChatThreshold
+	return cfg
+}
+
+// restartNeeded lists the settings that differ between the applied and
+// the freshly loaded configuration, i.e. changed but not reloadable.
+func restartNeeded(applied, fresh Config) []string {
+	have := map[string]string{}
+	for _, l := range strings.Split(applied.Report(), "\n") {
+		name, v, _ := strings.Cut(l, ": ")
+		have[name] = v
+	}
+	var out []string
+	for _, l := range strings.Split(fresh.Report(), "\n") {
+		if name, v, ok := strings.Cut(l, ": "); ok && have[name] != v {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+// configWatcher tracks the files behind the configuration.
+type configWatcher struct {
+	// env is the .env content last applied; pinned are its variables
+	// that the process environment overrides, which reloads leave alone
+	// just like godotenv.Load did at startup.
+	env    map[string]string
+	pinned map[string]bool
+	mtimes map[string]time.Time
+}
+
+func newConfigWatcher(cfg Config) (*configWatcher, error) {
+	env, err := godotenv.Read(envFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "read .env")
+	}
+	w := &configWatcher{env: env, pinned: map[string]bool{}}
+	for k, v := range env {
+		if os.Getenv(k) != v {
+			w.pinned[k] = true
+		}
+	}
+	w.mtimes = w.stat(cfg)
+	return w, nil
+}
+
+// stat returns the modification times of .env, the prompt files and the
+// regex rules.
+func (w *configWatcher) stat(cfg Config) map[string]time.Time {
+	out := map[string]time.Time{}
+	files := []string{envFile}
+	if cfg.RegexRulesFile != "" {
+		files = append(files, cfg.RegexRulesFile)
+	}
+	for _, c := range cfg.Campaigns {
+		if c.PromptFile != "" {
+			files = append(files, c.PromptFile)
+		}
+	}
+	for _, f := range files {
+		if fi, err := os.Stat(f); err == nil {
+			out[f] = fi.ModTime()
+		}
+	}
+	return out
+}
+
+func (w *configWatcher) changed(cfg Config) bool {
+	now := w.stat(cfg)
+	if len(now) != len(w.mtimes) {
+		w.mtimes = now
+		return true
+	}
+	for f, t := range now {
+		if !w.mtimes[f].Equal(t) {
+			w.mtimes = now
+			return true
+		}
+	}
+	return false
+}
+
+// setEnv applies env to the process environment, skipping pinned
+// variables and unsetting ones removed from the file.
+func (w *configWatcher) setEnv(env map[string]string) {
+	for k := range w.env {
+		if _, ok := env[k]; !ok && !w.pinned[k] {
+			_ = os.Unsetenv(k)
+		}
+	}
+	for k, v := range env {
+		if !w.pinned[k] {
+			_ = os.Setenv(k, v)
+		}
+	}
+}
+
+// watchConfig polls .env, the prompt files and REGEX_RULES_FILE every
+// CONFIG_RELOAD and reloads the configuration when one of them changes.
+func (a *App) watchConfig(ctx context.Context) {
+	w, err := newConfigWatcher(a.cfg)
+	if err != nil {
+		a.lg.Error("Config reload disabled", zap.Error(err))
+		return
+	}
+	ticker := time.NewTicker(a.cfg.ConfigReload)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if w.changed(a.live().Config) {
+			a.reloadConfig(ctx, w)
+		}
+	}
+}
+
+// reloadConfig validates the changed configuration and applies its
+// reloadable settings. An invalid configuration is rejected as a whole
+// and the admin is alerted; the previous one stays in effect.
+func (a *App) reloadConfig(ctx context.Context, w *configWatcher) {
+	cur := a.live()
+	fresh, err := a.readConfig(w)
+	if err != nil {
+		text := fmt.Sprintf("Config reload failed, keeping the previous configuration: %v", err)
+		a.lg.Error("Config reload", zap.Error(err))
+		a.alertAdmin(ctx, "config_reload_failed", text)
+		return
+	}
+
+	applied := withReloadable(cur.Config, fresh)
+	a.liveCfg.Store(a.newLiveConfig(applied))
+	restart := restartNeeded(applied, fresh)
+	a.lg.Info("Config reloaded", zap.Strings("restart_needed", restart))
+
+	text := "Config reloaded."
+	if len(restart) > 0 {
+		text += " Changed but only applied after a restart: " + strings.Join(restart, ", ")
+	}
+	a.alertAdmin(ctx, "config_reloaded", text)
+}
+
+// readConfig loads the configuration from the current files, restoring
+// the environment if it is invalid.
+func (a *App) readConfig(w *configWatcher) (Config, error) {
+	env, err := godotenv.Read(envFile)
+	if err != nil {
+		return Config{}, errors.Wrap(err, "read .env")
+	}
+	prev := w.env
+	w.setEnv(env)
+	w.env = env
+
+	fresh, err := loadConfig()
+	if err == nil {
+		err = a.checkRouting(fresh)
+	}
+	if err != nil {
+		w.setEnv(prev)
+		w.env = prev
+		return Config{}, err
+	}
+	return fresh, nil
+}
+
+// checkRouting rejects campaign recipients that were not resolved at
+// startup; adding one needs a restart.
+func (a *App) checkRouting(cfg Config) error {
+	for _, c := range cfg.Campaigns {
+		for _, r := range c.Recipients {
+			if isEmailRecipient(r) {
+				continue
+			}
+			if _, ok := a.recipients[r]; !ok {
+				return errors.Errorf("campaign %q: recipient %s was not resolved at startup, restart to add it", c.Name, r)
+			}
+		}
+	}
+	return nil
+}
+
+// alertAdmin reports an event to ALERT_WEBHOOK_URL and the admin chat.
+func (a *App) alertAdmin(ctx context.Context, event, text string) {
+	fmt.Fprintln(a.out, text)
+	if a.cfg.AlertWebhook != "" {
+		if err := postAlert(a.cfg.AlertWebhook, event, text); err != nil {
+			a.lg.Error("Alert webhook", zap.String("event", event), zap.Error(err))
+		}
+	}
+	if peer, ok := a.recipients[a.cfg.AdminUsername]; ok && !a.dryRun {
+		if _, err := a.sender.To(peer).Text(ctx, text); err != nil {
+			a.lg.Error("Admin alert", zap.String("event", event), zap.Error(err))
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestReloadRegexRules checks that under CLASSIFIER=regex a campaign added
+// by CONFIG_RELOAD is matched with the rules reloaded along with it.
+func TestReloadRegexRules(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rules.txt")
+	load := func(rules string, campaigns []Campaign) RegexClassifier {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(rules), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		r, err := loadRegexRules(path, campaigns)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r
+	}
+
+	cfg := testConfig()
+	cfg.Classifier = ClassifierRegex
+	cfg.RegexRulesFile = path
+	cfg.RegexRules = load("[development]\nбот\n", cfg.Campaigns)
+	a := newTestApp(t, cfg, nil)
+	a.texts = liveRegexRules{a}
+
+	fresh := cfg
+	fresh.Campaigns = append(fresh.Campaigns[:1:1], Campaign{Name: "design", Recipients: []string{"admin"}})
+	fresh.RegexRules = load("[development]\nбот\n[design]\nлоготип\n", fresh.Campaigns)
+	a.liveCfg.Store(a.newLiveConfig(withReloadable(a.live().Config, fresh)))
+
+	matched, err := a.matchCampaigns(context.Background(), 200, "нужен логотип", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(matched) != 1 || matched[0].Name != "design" {
+		t.Errorf("matched %+v, want the reloaded design campaign", matched)
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"fmt"
+)
+
+type replayReport struct {
+	Total   int
+	Checked int
+	Changed int
+	Skipped int
+	Failed  int
+}
+
+// Replay re-classifies stored leads with the current campaign prompts and
+// reports how many verdicts would differ. Every stored lead was a match
+// when it was saved, so a changed verdict means the new prompt rejects it.
+// The classification cache is bypassed, since it holds old verdicts.
+func (a *App) Replay(ctx context.Context, write bool) (replayReport, error) {
+	var rep replayReport
+
+	leads, err := a.leads.List(ctx)
+	if err != nil {
+		return rep, err
+	}
+	campaigns := map[string]Campaign{}
+	for _, c := range a.cfg.Campaigns {
+		campaigns[c.Name] = c
+	}
+
+	for _, l := range leads {
+		rep.Total++
+		c, ok := campaigns[l.Campaign]
+		if !ok || l.FromImage || l.Text == "" {
+			rep.Skipped++
+			continue
+		}
+		input, _ := a.classifierInput(normalizeText(l.Text, a.cfg.StripURLs))
+		v, err := a.texts.Classify(ctx, c, input)
+		relevant, err := a.ambiguousAs(c.Name, v.Relevant, err)
+		if err != nil {
+			fmt.Fprintf(a.out, "lead #%d: %v\n", l.ID, err)
+			rep.Failed++
+			continue
+		}
+		rep.Checked++
+		if !relevant {
+			rep.Changed++
+			fmt.Fprintf(a.out, "lead #%d (%s) no longer matches: %s\n", l.ID, l.Campaign, l.Text)
+		}
+		if write {
+			err := a.leads.Update(ctx, l.ID, func(l *Lead) error {
+				l.ReplayVerdict = &relevant
+				return nil
+			})
+			if err != nil {
+				return rep, err
+			}
+		}
+	}
+	return rep, nil
+}
+
+func (r replayReport) String() string {
+	return fmt.Sprintf("Replayed %d leads: %d checked, %d changed, %d skipped, %d failed",
+		r.Total, r.Checked, r.Changed, r.Skipped, r.Failed)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	pebbledb "github.com/cockroachdb/pebble"
+	"github.com/go-faster/errors"
+	"github.com/gotd/contrib/storage"
+	"github.com/gotd/td/telegram/query/dialogs"
+	"go.uber.org/zap"
+)
+
+// replyConfirmWindow is how long a first /reply to a user waits for
+// /confirm.
+const replyConfirmWindow = 5 * time.Minute
+
+// pendingReplies holds first replies awaiting /confirm, per admin.
+type pendingReplies struct {
+	mu      sync.Mutex
+	byAdmin map[int64]pendingReply
+}
+
+type pendingReply struct {
+	leadID uint64
+	text   string
+	at     time.Time
+}
+
+// repliedKey marks an author already replied to. Users keep the original
+// "replied/<id>" form; channels get their own namespace, as their IDs can
+// coincide with user IDs.
+func repliedKey(author dialogs.DialogKey) []byte {
+	if author.Kind == dialogs.Channel {
+		return []byte(fmt.Sprintf("replied/channel/%d", author.ID))
+	}
+	return []byte(fmt.Sprintf("replied/%d", author.ID))
+}
+
+// replyCommand handles "/reply <lead ID> <text>", which sends text to the
+// lead's author from this account. The first reply to a user is only
+// sent after /confirm.
+func (a *App) replyCommand(ctx context.Context, adminID int64, args string) (string, error) {
+	// The text may start on a new line: "/reply 42\nHello".
+	id, text := args, ""
+	if i := strings.IndexAny(args, " \n"); i >= 0 {
+		id, text = args[:i], strings.TrimSpace(args[i:])
+	}
+	leadID, err := strconv.ParseUint(strings.TrimPrefix(id, "#"), 10, 64)
+	if err != nil || text == "" {
+		return "usage: /reply <lead ID> <text>", nil
+	}
+	lead, err := a.leads.Get(ctx, leadID)
+	if errors.Is(err, ErrLeadNotFound) {
+		return fmt.Sprintf("lead #%d not found", leadID), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	author, err := storage.FindPeer(ctx, a.peerDB, lead.fromPeer())
+	if err != nil {
+		return fmt.Sprintf("#%d: автор не найден, ответить нельзя", leadID), nil
+	}
+
+	_, closer, err := a.db.Get(repliedKey(author.Key))
+	switch {
+	case err == nil:
+		closer.Close()
+		return a.sendReply(ctx, lead, author, text)
+	case !errors.Is(err, pebbledb.ErrNotFound):
+		return "", errors.Wrap(err, "get replied")
+	}
+
+	a.replies.mu.Lock()
+	a.replies.byAdmin[adminID] = pendingReply{leadID: leadID, text: text, at: time.Now()}
+	a.replies.mu.Unlock()
+	return fmt.Sprintf("Первое сообщение для %s (#%d). Отправить от вашего аккаунта? /confirm в течение %s",
+		lead.Username, leadID, replyConfirmWindow), nil
+}
+
+// confirmCommand sends the admin's pending first reply.
+func (a *App) confirmCommand(ctx context.Context, adminID int64) (string, error) {
+	a.replies.mu.Lock()
+	p, ok := a.replies.byAdmin[adminID]
+	delete(a.replies.byAdmin, adminID)
+	a.replies.mu.Unlock()
+	if !ok || time.Since(p.at) > replyConfirmWindow {
+		return "Нет ответа для подтверждения", nil
+	}
+
+	lead, err := a.leads.Get(ctx, p.leadID)
+	if errors.Is(err, ErrLeadNotFound) {
+		return fmt.Sprintf("lead #%d not found", p.leadID), nil
+	}
+	if err != nil {
+		return "", err
+	}
+	author, err := storage.FindPeer(ctx, a.peerDB, lead.fromPeer())
+	if err != nil {
+		return fmt.Sprintf("#%d: автор не найден, ответить нельзя", p.leadID), nil
+	}
+	return a.sendReply(ctx, lead, author, p.text)
+}
+
+func (a *App) sendReply(ctx context.Context, lead Lead, author storage.Peer, text string) (string, error) {
+	if _, err := a.sender.To(author.AsInputPeer()).Text(ctx, text); err != nil {
+		a.lg.Error("Reply to lead author", zap.Uint64("lead_id", lead.ID), zap.Error(err))
+		return fmt.Sprintf("Не удалось отправить %s: %v", lead.Username, err), nil
+	}
+	if err := a.db.Set(repliedKey(author.Key), nil, pebbledb.Sync); err != nil {
+		a.lg.Warn("Mark replied", zap.Int64("user_id", author.Key.ID), zap.Error(err))
+	}
+	a.lg.Info("Replied to lead author", zap.Uint64("lead_id", lead.ID), zap.Int64("user_id", author.Key.ID))
+	return fmt.Sprintf("Отправлено %s (#%d)", lead.Username, lead.ID), nil
+}
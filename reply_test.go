@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gotd/contrib/storage"
+	"github.com/gotd/td/tg"
+)
+
+// TestLeadFromPeer checks that /reply looks the author up as the peer
+// the lead came from: a message sent as a channel must not resolve to a
+// user that happens to share the channel's ID, or to nobody.
+func TestLeadFromPeer(t *testing.T) {
+	a, _ := discussionApp(t, testConfig(), OpenAIClassifier{client: &fakeCompleter{resp: answer("true")}, model: textModel})
+	ctx := context.Background()
+	var user storage.Peer
+	user.FromUser(&tg.User{ID: 200, AccessHash: 1, Username: "alice", Photo: &tg.UserProfilePhotoEmpty{}, Status: &tg.UserStatusEmpty{}})
+	if err := a.peerDB.Add(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+
+	asChannel := groupMessage(testDiscussionID, 0, 2, "нужен разработчик")
+	asChannel.FromID = &tg.PeerChannel{ChannelID: testAuthorID}
+
+	for _, tt := range []struct {
+		name string
+		msg  *tg.Message
+		id   int64
+		user string
+	}{
+		{name: "User", msg: groupMessage(testDiscussionID, 200, 1, "нужен разработчик"), id: 200, user: "alice"},
+		{name: "AsChannel", msg: asChannel, id: testAuthorID, user: "blog"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := a.processMessage(ctx, tt.msg); err != nil {
+				t.Fatal(err)
+			}
+			leads, err := a.leads.List(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(leads) == 0 {
+				t.Fatal("no lead stored")
+			}
+			l := leads[len(leads)-1]
+			p, err := storage.FindPeer(ctx, a.peerDB, l.fromPeer())
+			if err != nil {
+				t.Fatalf("author of %+v not found: %v", l, err)
+			}
+			username := ""
+			switch {
+			case p.User != nil:
+				username = p.User.Username
+			case p.Channel != nil:
+				username = p.Channel.Username
+			}
+			if p.Key.ID != tt.id || username != tt.user {
+				t.Errorf("author = %d %q, want %d %q", p.Key.ID, username, tt.id, tt.user)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/contrib/storage"
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+)
+
+// replyPreviewMax is how many runes of a replied-to message are quoted.
+const replyPreviewMax = 200
+
+// replyTargetID returns the message msg replies to in the same chat. A
+// forum message "replying" to its topic's first message is not a reply.
+func replyTargetID(msg *tg.Message) (int, bool) {
+	reply, ok := msg.ReplyTo.(*tg.MessageReplyHeader)
+	if !ok {
+		return 0, false
+	}
+	if _, other := reply.GetReplyToPeerID(); other {
+		return 0, false
+	}
+	id, ok := reply.GetReplyToMsgID()
+	if !ok {
+		return 0, false
+	}
+	if _, inThread := reply.GetReplyToTopID(); reply.ForumTopic && !inThread {
+		return 0, false
+	}
+	return id, true
+}
+
+// replyPreview is the short, single-line form of a replied-to text.
+func replyPreview(text string) string {
+	text, _ = truncateInput(strings.Join(strings.Fields(text), " "), replyPreviewMax, 0)
+	return text
+}
+
+// replyPreviews caches previews of replied-to messages by chat and
+// message ID, empty for inaccessible ones. Cleared when it grows past
+// replyPreviewsMax.
+type replyPreviews struct {
+	mu       sync.Mutex
+	previews map[channelPost]string
+}
+
+const replyPreviewsMax = 10000
+
+func (r *replyPreviews) reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.previews = nil
+}
+
+func (r *replyPreviews) get(k channelPost) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	v, ok := r.previews[k]
+	return v, ok
+}
+
+func (r *replyPreviews) put(k channelPost, preview string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.previews == nil || len(r.previews) >= replyPreviewsMax {
+		r.previews = map[channelPost]string{}
+	}
+	r.previews[k] = preview
+}
+
+// replyTo returns a preview of the message msg replies to, empty when it
+// is not a reply or the parent is inaccessible or has no text. A quote
+// the author selected is used as is, without fetching the parent.
+func (a *App) replyTo(ctx context.Context, p storage.Peer, msg *tg.Message) string {
+	id, ok := replyTargetID(msg)
+	if !ok {
+		return ""
+	}
+	if reply := msg.ReplyTo.(*tg.MessageReplyHeader); reply.Quote {
+		if quote, ok := reply.GetQuoteText(); ok {
+			return replyPreview(quote)
+		}
+	}
+	k := channelPost{channelID: p.Key.ID, postID: id}
+	if preview, ok := a.parents.get(k); ok {
+		return preview
+	}
+	parent, err := a.getMessage(ctx, p, id)
+	if err != nil {
+		a.lg.Info("Replied-to message unavailable", zap.Int64("chat_id", p.Key.ID), zap.Int("msg_id", id), zap.Error(err))
+		return ""
+	}
+	var preview string
+	if parent != nil {
+		preview = replyPreview(stripCustomEmoji(parent.Message, parent.Entities))
+	}
+	a.parents.put(k, preview)
+	return preview
+}
+
+// getMessage fetches one message of the chat, nil if it was deleted or
+// is not a regular message.
+func (a *App) getMessage(ctx context.Context, p storage.Peer, id int) (*tg.Message, error) {
+	if err := a.chatLimit.Wait(ctx, p.Key.ID); err != nil {
+		return nil, err
+	}
+	ids := []tg.InputMessageClass{&tg.InputMessageID{ID: id}}
+	var (
+		res tg.MessagesMessagesClass
+		err error
+	)
+	if p.Channel != nil {
+		res, err = a.api.ChannelsGetMessages(ctx, &tg.ChannelsGetMessagesRequest{
+			Channel: &tg.InputChannel{ChannelID: p.Channel.ID, AccessHash: p.Channel.AccessHash},
+			ID:      ids,
+		})
+	} else {
+		res, err = a.api.MessagesGetMessages(ctx, ids)
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "get message")
+	}
+	msgs, ok := res.(tg.ModifiedMessagesMessages)
+	if !ok {
+		return nil, nil
+	}
+	for _, m := range msgs.GetMessages() {
+		if m, ok := m.(*tg.Message); ok && m.ID == id {
+			return m, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+// messageResult is one OUTPUT_NDJSON line per processed message. Skipped
+// is set, and the verdict fields are empty, for a message that never
+// reached the classifier.
+type messageResult struct {
+	Time      time.Time `json:"time"`
+	ChatID    int64     `json:"chat_id"`
+	MsgID     int       `json:"msg_id"`
+	FromID    int64     `json:"from_id"`
+	Username  string    `json:"username"`
+	Relevant  bool      `json:"relevant"`
+	Campaigns []string  `json:"campaigns,omitempty"`
+	LeadIDs   []uint64  `json:"lead_ids,omitempty"`
+	Forwarded bool      `json:"forwarded"`
+	Skipped   string    `json:"skipped,omitempty"`
+}
+
+// Reasons in messageResult.Skipped.
+const (
+	skippedFilter    = "filter"     // LANGUAGES, request shape, forwarded, …
+	skippedEmpty     = "empty"      // no text or image to classify
+	skippedPeerError = "peer_error" // SKIP_ON_PEER_ERROR
+	skippedTopic     = "topic"      // MONITOR_TOPICS
+	skippedHeld      = "held"       // OpenAI unavailable; classified later
+)
+
+// emitSkipped writes the result line for a message dropped before
+// classification.
+func (a *App) emitSkipped(msg *tg.Message, reason string) {
+	r := messageResult{Time: time.Now(), ChatID: getChatID(msg.GetPeerID()), MsgID: msg.ID, Skipped: reason}
+	if fu, ok := msg.FromID.(*tg.PeerUser); ok {
+		r.FromID = fu.UserID
+	}
+	a.results.Emit(r)
+}
+
+// resultStream writes results as NDJSON. Handlers run concurrently, so
+// each line is encoded and written whole under a lock.
+type resultStream struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+func newResultStream(w io.Writer) *resultStream {
+	return &resultStream{enc: json.NewEncoder(w)}
+}
+
+// Emit writes r; a nil stream discards it.
+func (s *resultStream) Emit(r messageResult) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_ = s.enc.Encode(r)
+}
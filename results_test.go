@@ -0,0 +1,53 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+)
+
+// TestResultStream checks that OUTPUT_NDJSON gets a line for every
+// processed message, with the reason for those never classified.
+func TestResultStream(t *testing.T) {
+	cfg := testConfig()
+	langs, err := parseLanguages("ru")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Languages = langs
+	a := newTestApp(t, cfg, OpenAIClassifier{client: &fakeCompleter{resp: answer("true")}, model: textModel})
+	var out bytes.Buffer
+	a.results = newResultStream(&out)
+	ctx := context.Background()
+
+	for _, msg := range []struct {
+		id   int
+		text string
+	}{
+		{id: 1, text: "Ищу разработчика телеграм-бота"},
+		{id: 2, text: "Looking for a bot developer"},
+	} {
+		if err := a.processMessage(ctx, groupMessage(100, 200, msg.id, msg.text)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []messageResult{
+		{ChatID: 100, MsgID: 1, FromID: 200, Relevant: true},
+		{ChatID: 100, MsgID: 2, FromID: 200, Skipped: skippedFilter},
+	}
+	dec := json.NewDecoder(&out)
+	for i, w := range want {
+		var got messageResult
+		if err := dec.Decode(&got); err != nil {
+			t.Fatalf("line %d: %v", i+1, err)
+		}
+		if got.ChatID != w.ChatID || got.MsgID != w.MsgID || got.FromID != w.FromID || got.Relevant != w.Relevant || got.Skipped != w.Skipped {
+			t.Errorf("line %d = %+v, want %+v", i+1, got, w)
+		}
+	}
+	if dec.More() {
+		t.Error("more lines than processed messages")
+	}
+}
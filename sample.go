@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gotd/td/tg"
+)
+
+// Rough tokens-per-rune ratio for mixed Russian/English text.
+const runesPerToken = 3
+
+// sampler watches incoming messages for -sample without classifying them.
+type sampler struct {
+	target int
+	done   context.CancelFunc
+
+	mu       sync.Mutex
+	start    time.Time
+	seen     int
+	passed   int
+	inRunes  int
+	finished bool
+}
+
+func (s *sampler) observe(text string, passed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.finished {
+		return
+	}
+	if s.seen == 0 {
+		s.start = time.Now()
+	}
+	s.seen++
+	if passed {
+		s.passed++
+		s.inRunes += utf8.RuneCountInString(text)
+	}
+	if s.seen >= s.target {
+		s.finished = true
+		s.done()
+	}
+}
+
+// hasPhoto reports whether the message carries a photo.
+func hasPhoto(msg *tg.Message) bool {
+	_, ok := msg.Media.(*tg.MessageMediaPhoto)
+	return ok
+}
+
+func isForwarded(msg *tg.Message) bool {
+	_, ok := msg.GetFwdFrom()
+	return ok
+}
+
+// passesPrefilter reports whether a message would be sent to the
+// classifier at all, given its normalized text.
+func (a *App) passesPrefilter(msg *tg.Message, text string) bool {
+	if a.cfg.IgnoreForwarded && isForwarded(msg) {
+		return false
+	}
+	if !a.isWatchedSender(msg) {
+		return false
+	}
+	if msg.Post && !a.cfg.IncludeChannelPosts {
+		return false
+	}
+	if a.ignoredMedia(msg) {
+		return false
+	}
+	// Urgent keyword matches skip the language and shape filters.
+	urgent := text != "" && a.isUrgent(text)
+	if text != "" && !urgent && !a.allowedLanguage(text) {
+		return false
+	}
+	// Photos are judged by the vision model, so only text is shaped.
+	if a.cfg.RequireRequestShape && text != "" && !urgent && !looksLikeRequest(text) {
+		return false
+	}
+	return text != "" || (a.cfg.Vision && hasPhoto(msg))
+}
+
+// Sample observes the next n incoming messages and prints a daily OpenAI
+// volume and cost estimate, without classifying or forwarding anything.
+func (a *App) Sample(ctx context.Context, n int) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	a.sampler = &sampler{target: n, done: cancel}
+
+	err := a.Run(ctx)
+
+	s := a.sampler
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.finished && err != nil {
+		return err
+	}
+	fmt.Fprintln(a.out, a.sampleReport(s, time.Since(s.start)))
+	return nil
+}
+
+func (a *App) sampleReport(s *sampler, elapsed time.Duration) string {
+	if s.seen == 0 || elapsed <= 0 {
+		return "No messages observed"
+	}
+	perDay := float64(s.seen) / elapsed.Seconds() * 86400
+	passRate := float64(s.passed) / float64(s.seen)
+
+	var promptRunes int
+	for _, c := range a.cfg.Campaigns {
+		promptRunes += utf8.RuneCountInString(c.Prompt)
+	}
+	avgInput := 0
+	if s.passed > 0 {
+		avgInput = s.inRunes / s.passed
+	}
+	campaigns := len(a.cfg.Campaigns)
+
+	callsPerDay := perDay * passRate * float64(campaigns)
+	// Each call sends one campaign prompt plus the message.
+	inTokensPerCall := float64(promptRunes/campaigns+avgInput) / runesPerToken
+	const outTokensPerCall = 2
+	inTokensPerDay := callsPerDay * inTokensPerCall
+	outTokensPerDay := callsPerDay * outTokensPerCall
+	cost := inTokensPerDay/1e6*a.cfg.PriceInputPer1M + outTokensPerDay/1e6*a.cfg.PriceOutputPer1M
+
+	return fmt.Sprintf(`Observed %d messages in %s, %d (%.0f%%) pass the pre-filter
+Estimated per day (with %d campaign(s)):
+  messages:      %.0f
+  OpenAI calls:  %.0f
+  input tokens:  %.0f
+  output tokens: %.0f
+  cost:          $%.2f`,
+		s.seen, elapsed.Round(time.Second), s.passed, passRate*100,
+		campaigns, perDay, callsPerDay, inTokensPerDay, outTokensPerDay, cost)
+}
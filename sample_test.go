@@ -0,0 +1,39 @@
+package main
+
+import "testing"
+
+func TestPassesPrefilter(t *testing.T) {
+	cfg := testConfig()
+	langs, err := parseLanguages("ru")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.Languages = langs
+	cfg.RequireRequestShape = true
+	cfg.UrgentKeywords = []string{"urgent", "срочно"}
+	a := newTestApp(t, cfg, RegexClassifier{})
+
+	for _, tt := range []struct {
+		name string
+		text string
+		pass bool
+	}{
+		{name: "Request", text: "Ищу разработчика бота", pass: true},
+		{name: "NotARequest", text: "Я сделал бота"},
+		{name: "OtherLanguage", text: "Looking for a bot developer?"},
+		{name: "UrgentOtherLanguage", text: "URGENT: bot developer needed today", pass: true},
+		{name: "UrgentNotARequest", text: "Срочно. Бот для магазина", pass: true},
+		{name: "NoLetters", text: "???", pass: true},
+		{name: "Empty"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			msg := groupMessage(100, 200, 1, tt.text)
+			if got := a.passesPrefilter(msg, normalizeText(tt.text, false)); got != tt.pass {
+				t.Errorf("passesPrefilter(%q) = %v, want %v", tt.text, got, tt.pass)
+			}
+		})
+	}
+	if n := a.stats.Snapshot().SkippedLanguage; n != 1 {
+		t.Errorf("SkippedLanguage = %d, want 1", n)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"regexp"
+	"unicode/utf8"
+
+	"github.com/gotd/td/tg"
+)
+
+var contactRe = regexp.MustCompile(`(?i)(\+?\d[\d\s()-]{8,}\d|[\w.+-]+@[\w-]+\.[\w.]+|@[a-z]\w{4,}|t\.me/\w+)`)
+
+// scoreLead rates how promising a lead looks from cheap signals about the
+// sender and the message. Higher is better.
+func scoreLead(sender *tg.User, text string) int {
+	score := 0
+	if sender != nil {
+		if sender.Username != "" {
+			score++
+		}
+		if sender.Premium {
+			score++
+		}
+		if sender.Verified {
+			score++
+		}
+	}
+	switch n := utf8.RuneCountInString(text); {
+	case n >= 200:
+		score += 2
+	case n >= 50:
+		score++
+	}
+	if contactRe.MatchString(text) {
+		score += 2
+	}
+	return score
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/go-faster/errors"
+	"go.uber.org/zap"
+)
+
+// selfTest runs a synthetic message through classification and delivers
+// a marked test summary to the admin, to check the pipeline end to end
+// after a deploy. A negative verdict is reported but the test forward is
+// still sent, so delivery is checked either way.
+func (a *App) selfTest(ctx context.Context) error {
+	c := a.cfg.Campaigns[0]
+	v, err := a.texts.Classify(ctx, c, checkSample)
+	if err != nil {
+		return errors.Wrap(err, "classify")
+	}
+	fmt.Fprintf(a.out, "Self-test: sample classified as %v by campaign %s\n", v.Relevant, c.Name)
+
+	peer, ok := a.recipients[a.cfg.AdminUsername]
+	if !ok {
+		return errors.Errorf("admin %s is not resolved", a.cfg.AdminUsername)
+	}
+	username := "unknown"
+	if a.self.Username != "" {
+		username = "@" + a.self.Username
+	}
+	lead := Lead{
+		Campaign:   c.Name,
+		Confidence: v.Confidence,
+		FromID:     a.self.ID,
+		Username:   username,
+		Text:       checkSample,
+		SelfTest:   true,
+		SentAt:     time.Now(),
+		CreatedAt:  time.Now(),
+	}
+	if !v.Relevant {
+		lead.Tags = append(lead.Tags, "self-test-negative")
+	}
+	if _, err := a.sender.To(peer).StyledText(ctx, styledSummary(lead, a.cfg.SummaryStyle, a.cfg.Location)...); err != nil {
+		return errors.Wrap(err, "deliver")
+	}
+	a.lg.Info("Self-test delivered", zap.String("admin", a.cfg.AdminUsername), zap.Bool("relevant", v.Relevant))
+	fmt.Fprintf(a.out, "Self-test: test lead delivered to %s\n", a.cfg.AdminUsername)
+	return nil
+}
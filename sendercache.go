@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// senderSimilarity is the minimum word overlap (Jaccard index) for a
+// follow-up to count as near-identical to the sender's relevant message.
+const senderSimilarity = 0.8
+
+// senderVerdicts remembers the latest relevant verdict per sender and
+// campaign, so near-identical follow-ups within the TTL inherit it instead
+// of being classified again. Unlike SENDER_COOLDOWN it changes verdicts,
+// not forwarding. A zero TTL disables it.
+type senderVerdicts struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	senders map[senderVerdictKey]senderVerdict
+}
+
+type senderVerdictKey struct {
+	fromID   int64
+	campaign string
+}
+
+type senderVerdict struct {
+	words map[string]bool
+	v     verdict
+	at    time.Time
+}
+
+func newSenderVerdicts(ttl time.Duration) *senderVerdicts {
+	return &senderVerdicts{ttl: ttl, senders: map[senderVerdictKey]senderVerdict{}}
+}
+
+// Get returns the sender's relevant verdict if text is near-identical to
+// the message it was given for and the TTL has not passed.
+func (s *senderVerdicts) Get(fromID int64, campaign, text string) (verdict, bool) {
+	if s.ttl <= 0 || fromID == 0 {
+		return verdict{}, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	k := senderVerdictKey{fromID: fromID, campaign: campaign}
+	sv, ok := s.senders[k]
+	if !ok {
+		return verdict{}, false
+	}
+	if time.Since(sv.at) > s.ttl {
+		delete(s.senders, k)
+		return verdict{}, false
+	}
+	if jaccard(sv.words, wordSet(text)) < senderSimilarity {
+		return verdict{}, false
+	}
+	return sv.v, true
+}
+
+// Put records a verdict; only relevant ones are kept.
+func (s *senderVerdicts) Put(fromID int64, campaign, text string, v verdict) {
+	if s.ttl <= 0 || fromID == 0 || !v.Relevant {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.senders[senderVerdictKey{fromID: fromID, campaign: campaign}] = senderVerdict{
+		words: wordSet(text),
+		v:     v,
+		at:    time.Now(),
+	}
+}
+
+func wordSet(text string) map[string]bool {
+	words := map[string]bool{}
+	for _, w := range strings.Fields(normalizeForHash(text)) {
+		words[w] = true
+	}
+	return words
+}
+
+func jaccard(a, b map[string]bool) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 1
+	}
+	shared := 0
+	for w := range a {
+		if b[w] {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
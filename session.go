@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/telegram"
+)
+
+func sessionFolder(phone string) string {
+	var out []rune
+	for _, r := range phone {
+		if r >= '0' && r <= '9' {
+			out = append(out, r)
+		}
+	}
+	return "phone-" + string(out)
+}
+
+// normalizePhone drops formatting but keeps a leading '+', so numbers that
+// only look alike once punctuation is stripped stay distinct.
+func normalizePhone(phone string) string {
+	var b strings.Builder
+	for i, r := range strings.TrimSpace(phone) {
+		if (r >= '0' && r <= '9') || (r == '+' && i == 0) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// hashedSessionFolder is collision-safe: it appends a short hash of the
+// full normalized phone to the legacy digits-only name.
+func hashedSessionFolder(phone string) string {
+	sum := sha256.Sum256([]byte(normalizePhone(phone)))
+	return sessionFolder(phone) + "-" + hex.EncodeToString(sum[:4])
+}
+
+// sessionPath picks the per-account directory. With SESSION_DIR unset, an
+// existing legacy "session/phone-<digits>" directory keeps being used
+// unless a hash-based one already exists.
+func sessionPath(base, phone string) string {
+	if base != "" {
+		return filepath.Join(base, hashedSessionFolder(phone))
+	}
+	hashed := filepath.Join("session", hashedSessionFolder(phone))
+	legacy := filepath.Join("session", sessionFolder(phone))
+	if _, err := os.Stat(hashed); err != nil {
+		if _, err := os.Stat(legacy); err == nil {
+			return legacy
+		}
+	}
+	return hashed
+}
+
+// encryptedMagic prefixes session files written by encryptedSession.
+var encryptedMagic = []byte("TGPENC1\n")
+
+// encryptedSession wraps a session storage with AES-GCM. The key is
+// derived from SESSION_ENCRYPTION_KEY with SHA-256. With no key it passes
+// data through, but still refuses to hand an encrypted session to the
+// client. Plaintext sessions are read as-is and encrypted on next store.
+type encryptedSession struct {
+	next telegram.SessionStorage
+	aead cipher.AEAD
+}
+
+func newEncryptedSession(next telegram.SessionStorage, passphrase string) (*encryptedSession, error) {
+	s := &encryptedSession{next: next}
+	if passphrase == "" {
+		return s, nil
+	}
+	key := sha256.Sum256([]byte(passphrase))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, errors.Wrap(err, "session cipher")
+	}
+	if s.aead, err = cipher.NewGCM(block); err != nil {
+		return nil, errors.Wrap(err, "session cipher")
+	}
+	return s, nil
+}
+
+func (s *encryptedSession) LoadSession(ctx context.Context) ([]byte, error) {
+	data, err := s.next.LoadSession(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.HasPrefix(data, encryptedMagic) {
+		return data, nil
+	}
+	if s.aead == nil {
+		return nil, errors.New("session is encrypted: SESSION_ENCRYPTION_KEY is required")
+	}
+	data = data[len(encryptedMagic):]
+	n := s.aead.NonceSize()
+	if len(data) < n {
+		return nil, errors.New("session is encrypted: file is truncated")
+	}
+	plain, err := s.aead.Open(nil, data[:n], data[n:], nil)
+	if err != nil {
+		return nil, errors.New("session is encrypted: wrong SESSION_ENCRYPTION_KEY")
+	}
+	return plain, nil
+}
+
+func (s *encryptedSession) StoreSession(ctx context.Context, data []byte) error {
+	if s.aead == nil {
+		return s.next.StoreSession(ctx, data)
+	}
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return errors.Wrap(err, "session nonce")
+	}
+	out := append([]byte{}, encryptedMagic...)
+	out = append(out, nonce...)
+	out = s.aead.Seal(out, nonce, data, nil)
+	return s.next.StoreSession(ctx, out)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+
+	pebbledb "github.com/cockroachdb/pebble"
+	"github.com/go-faster/errors"
+	"go.uber.org/zap"
+)
+
+// ShadowStats counts how often the shadow classifier agrees with the
+// primary one, per campaign. It lives in pebble so comparisons
+// accumulate across restarts.
+type ShadowStats struct {
+	db *pebbledb.DB
+	mu sync.Mutex
+}
+
+// shadowCounts compares verdicts for one campaign. PrimaryOnly and
+// ShadowOnly count the disagreements by which side said relevant.
+type shadowCounts struct {
+	Total       int64 `json:"total"`
+	Agree       int64 `json:"agree"`
+	PrimaryOnly int64 `json:"primary_only"`
+	ShadowOnly  int64 `json:"shadow_only"`
+}
+
+const shadowPrefix = "shadow/"
+
+func NewShadowStats(db *pebbledb.DB) *ShadowStats {
+	return &ShadowStats{db: db}
+}
+
+func (s *ShadowStats) get(campaign string) (shadowCounts, error) {
+	var c shadowCounts
+	data, closer, err := s.db.Get([]byte(shadowPrefix + campaign))
+	if errors.Is(err, pebbledb.ErrNotFound) {
+		return c, nil
+	}
+	if err != nil {
+		return c, errors.Wrap(err, "get shadow stats")
+	}
+	defer closer.Close()
+	if err := json.Unmarshal(data, &c); err != nil {
+		return c, errors.Wrap(err, "unmarshal shadow stats")
+	}
+	return c, nil
+}
+
+// Record adds one comparison.
+func (s *ShadowStats) Record(campaign string, primary, shadow bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, err := s.get(campaign)
+	if err != nil {
+		return err
+	}
+	c.Total++
+	switch {
+	case primary == shadow:
+		c.Agree++
+	case primary:
+		c.PrimaryOnly++
+	default:
+		c.ShadowOnly++
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return errors.Wrap(err, "marshal shadow stats")
+	}
+	if err := s.db.Set([]byte(shadowPrefix+campaign), data, pebbledb.NoSync); err != nil {
+		return errors.Wrap(err, "save shadow stats")
+	}
+	return nil
+}
+
+// shadowVerdict classifies text with SHADOW_MODEL/SHADOW_PROMPT and
+// records how it compares with the primary verdict. It never affects
+// routing; nil means no shadow is configured or it failed.
+func (a *App) shadowVerdict(ctx context.Context, c Campaign, text string, primary bool) *bool {
+	if a.cfg.ShadowModel == "" && a.cfg.ShadowPrompt == "" {
+		return nil
+	}
+	model, prompt := a.cfg.ShadowModel, a.cfg.ShadowPrompt
+	if model == "" {
+		model = textModel
+	}
+	if prompt == "" {
+		prompt = c.Prompt
+	}
+	v, err := classifyTextWith(ctx, a.classifier, model, prompt, text)
+	if err != nil {
+		var amb *AmbiguousVerdictError
+		if !errors.As(err, &amb) {
+			a.lg.Warn("Shadow classify", zap.String("campaign", c.Name), zap.Error(err))
+			return nil
+		}
+		v.Relevant = a.cfg.AmbiguousAs
+	}
+	if v.Relevant != primary {
+		a.lg.Info("Shadow verdict differs",
+			zap.String("campaign", c.Name),
+			zap.Bool("primary", primary),
+			zap.Bool("shadow", v.Relevant),
+			zap.String("text", text),
+		)
+	}
+	if err := a.shadow.Record(c.Name, primary, v.Relevant); err != nil {
+		a.lg.Warn("Record shadow verdict", zap.Error(err))
+	}
+	return &v.Relevant
+}
+
+// shadowStatsCommand handles "/shadow-stats".
+func (a *App) shadowStatsCommand() (string, error) {
+	if a.cfg.ShadowModel == "" && a.cfg.ShadowPrompt == "" {
+		return "Теневой классификатор не настроен (SHADOW_MODEL / SHADOW_PROMPT)", nil
+	}
+	var b strings.Builder
+	b.WriteString("Совпадение с теневым классификатором:")
+	for _, c := range a.live().Campaigns {
+		s, err := a.shadow.get(c.Name)
+		if err != nil {
+			return "", err
+		}
+		if s.Total == 0 {
+			fmt.Fprintf(&b, "\n%s: нет данных", c.Name)
+			continue
+		}
+		fmt.Fprintf(&b, "\n%s: %.0f%% (%d/%d), только основной: %d, только теневой: %d",
+			c.Name, 100*float64(s.Agree)/float64(s.Total), s.Agree, s.Total, s.PrimaryOnly, s.ShadowOnly)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,28 @@
+package main
+
+import "strings"
+
+// requestMarkers are word stems that usually start a request or a
+// hiring post, in Russian and English.
+var requestMarkers = []string{
+	"ищу", "ищем", "нуж", "требует", "кто может", "кто сможет", "кто делает",
+	"кто сделает", "подскаж", "посовет", "помогите", "сделайте", "напишите",
+	"порекоменд", "готов заплат", "готов плат",
+	"looking for", "need", "hiring", "anyone", "recommend", "wanted",
+}
+
+// looksLikeRequest is a cheap heuristic for REQUIRE_REQUEST_SHAPE: it
+// passes questions and texts with a request marker, which cuts most
+// declaratives ("я сделал бота") before the OpenAI call.
+func looksLikeRequest(text string) bool {
+	if strings.ContainsAny(text, "?？") {
+		return true
+	}
+	lower := strings.ToLower(text)
+	for _, m := range requestMarkers {
+		if strings.Contains(lower, m) {
+			return true
+		}
+	}
+	return false
+}
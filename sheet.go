@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	pebbledb "github.com/cockroachdb/pebble"
+	"github.com/go-faster/errors"
+	"go.uber.org/zap"
+)
+
+// sheetRow is one forwarded lead for SHEET_SINK.
+type sheetRow struct {
+	Lead      Lead   `json:"lead"`
+	Recipient string `json:"recipient"`
+	Summary   string `json:"summary"`
+}
+
+// sheetHeader are the CSV columns, in order.
+var sheetHeader = []string{
+	"forwarded_at", "lead_id", "campaign", "recipient", "chat_id", "msg_id",
+	"from_id", "username", "score", "budget", "link", "contact", "text",
+}
+
+func (r sheetRow) record(at time.Time) []string {
+	var budget string
+	if r.Lead.Budget != nil {
+		budget = r.Lead.Budget.String()
+	}
+	return []string{
+		at.Format(time.RFC3339),
+		strconv.FormatUint(r.Lead.ID, 10),
+		r.Lead.Campaign,
+		r.Recipient,
+		strconv.FormatInt(r.Lead.ChatID, 10),
+		strconv.Itoa(r.Lead.MsgID),
+		strconv.FormatInt(r.Lead.FromID, 10),
+		r.Lead.Username,
+		strconv.Itoa(r.Lead.Score),
+		budget,
+		r.Lead.Link,
+		r.Lead.Contact,
+		r.Lead.Text,
+	}
+}
+
+// isWebhookSink reports whether SHEET_SINK is a webhook URL rather than a
+// CSV file path.
+func isWebhookSink(sink string) bool {
+	return strings.HasPrefix(sink, "http://") || strings.HasPrefix(sink, "https://")
+}
+
+// SheetSink appends forwarded leads to a CSV file or posts them to a
+// webhook (e.g. a Google Sheets Apps Script) on its own goroutine, in
+// lead order, so a slow or failing sink never blocks Telegram. Rows wait
+// in pebble until the sink accepts them, so a restart does not lose them.
+//
+// Each webhook POST carries two headers:
+//   - Idempotency-Key: "lead-<id>-<recipient>", the same on every attempt
+//     at a row, so a receiver can drop a row it already recorded;
+//   - X-Delivery-Attempt: 1 on the first attempt at a row and one more on
+//     each retry, counted across restarts.
+//
+// Any 2xx response accepts the row; anything else is retried.
+type SheetSink struct {
+	target string
+	db     *pebbledb.DB
+	lg     *zap.Logger
+	out    io.Writer
+	// wake tells Run a row was appended.
+	wake chan struct{}
+}
+
+// queuedRow is a sheetRow as persisted in pebble, with the number of
+// attempts made at it so far.
+type queuedRow struct {
+	Row      sheetRow `json:"row"`
+	Attempts int      `json:"attempts"`
+}
+
+const (
+	// sheetAttempts failures in a row are reported on stdout; the row is
+	// still retried.
+	sheetAttempts = 3
+	sheetMaxDelay = 5 * time.Minute
+)
+
+var sheetPrefix = []byte("sheet/")
+
+func NewSheetSink(target string, db *pebbledb.DB, lg *zap.Logger, out io.Writer) *SheetSink {
+	return &SheetSink{target: target, db: db, lg: lg, out: out, wake: make(chan struct{}, 1)}
+}
+
+func sheetKey(r sheetRow) []byte {
+	return []byte(fmt.Sprintf("%s%020d/%s", sheetPrefix, r.Lead.ID, r.Recipient))
+}
+
+// Append stores a row for the sink; a nil sink discards it. A row that
+// can't be stored is logged, since the lead was already delivered.
+func (s *SheetSink) Append(lead Lead, recipient, summary string) {
+	if s == nil {
+		return
+	}
+	r := sheetRow{Lead: lead, Recipient: recipient, Summary: summary}
+	if err := s.save(queuedRow{Row: r}); err != nil {
+		s.lg.Error("Queue sheet row", zap.Uint64("lead_id", lead.ID), zap.Error(err))
+		return
+	}
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *SheetSink) save(q queuedRow) error {
+	data, err := json.Marshal(q)
+	if err != nil {
+		return errors.Wrap(err, "encode sheet row")
+	}
+	if err := s.db.Set(sheetKey(q.Row), data, pebbledb.Sync); err != nil {
+		return errors.Wrap(err, "store sheet row")
+	}
+	return nil
+}
+
+// Run writes queued rows, starting with those left from before a restart,
+// until ctx is done.
+func (s *SheetSink) Run(ctx context.Context) {
+	for {
+		s.deliverPending(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-s.wake:
+		}
+	}
+}
+
+// pending returns the queued rows in lead order.
+func (s *SheetSink) pending() ([]queuedRow, error) {
+	iter, err := s.db.NewIter(&pebbledb.IterOptions{
+		LowerBound: sheetPrefix,
+		UpperBound: []byte("sheet0"), // '0' follows '/'
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "sheet iter")
+	}
+	defer iter.Close()
+
+	var rows []queuedRow
+	for iter.First(); iter.Valid(); iter.Next() {
+		var q queuedRow
+		if err := json.Unmarshal(iter.Value(), &q); err != nil {
+			s.lg.Error("Decode queued sheet row", zap.ByteString("key", iter.Key()), zap.Error(err))
+			continue
+		}
+		rows = append(rows, q)
+	}
+	return rows, iter.Error()
+}
+
+func (s *SheetSink) deliverPending(ctx context.Context) {
+	rows, err := s.pending()
+	if err != nil {
+		s.lg.Error("List queued sheet rows", zap.Error(err))
+		return
+	}
+	for _, q := range rows {
+		if !s.deliver(ctx, q) {
+			// Shutting down: the row stays queued for the next start.
+			return
+		}
+		if err := s.db.Delete(sheetKey(q.Row), pebbledb.Sync); err != nil {
+			s.lg.Error("Remove queued sheet row", zap.Uint64("lead_id", q.Row.Lead.ID), zap.Error(err))
+		}
+	}
+}
+
+// deliver retries a row until the sink accepts it, so later rows never
+// overtake it, and returns false when ctx ends first. The attempt count
+// is stored before each attempt, so it keeps growing across restarts.
+func (s *SheetSink) deliver(ctx context.Context, q queuedRow) bool {
+	delay := 2 * time.Second
+	for failures := 1; ; failures++ {
+		q.Attempts++
+		if err := s.save(q); err != nil {
+			s.lg.Warn("Store sheet row attempt", zap.Uint64("lead_id", q.Row.Lead.ID), zap.Error(err))
+		}
+		err := s.write(ctx, q)
+		if err == nil {
+			return true
+		}
+		s.lg.Warn("Append lead to sheet", zap.Uint64("lead_id", q.Row.Lead.ID), zap.Int("attempt", q.Attempts), zap.Error(err))
+		if failures == sheetAttempts {
+			fmt.Fprintf(s.out, "sheet %s: %v; retrying\n", redactedSink(s.target), err)
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(delay):
+		}
+		delay = min(2*delay, sheetMaxDelay)
+	}
+}
+
+func (s *SheetSink) write(ctx context.Context, q queuedRow) error {
+	if isWebhookSink(s.target) {
+		return s.post(ctx, q.Row, q.Attempts)
+	}
+	return s.appendCSV(q.Row)
+}
+
+// appendCSV appends the row under an exclusive lock, so other processes
+// appending to the same file don't interleave, and syncs it to disk. A
+// header is written first when the file is empty.
+func (s *SheetSink) appendCSV(r sheetRow) error {
+	f, err := os.OpenFile(s.target, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return errors.Wrap(err, "open")
+	}
+	defer f.Close()
+	if err := lockFile(f); err != nil {
+		return errors.Wrap(err, "lock")
+	}
+	defer unlockFile(f)
+
+	info, err := f.Stat()
+	if err != nil {
+		return errors.Wrap(err, "stat")
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	if info.Size() == 0 {
+		_ = w.Write(sheetHeader)
+	}
+	_ = w.Write(r.record(time.Now()))
+	w.Flush()
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		return errors.Wrap(err, "write")
+	}
+	return f.Sync()
+}
+
+// idempotencyKey identifies the row across retries and restarts, so a
+// webhook that saw an attempt whose response was lost can drop the
+// repeat: one row per lead and recipient, the same one the row is
+// queued under.
+func (r sheetRow) idempotencyKey() string {
+	return fmt.Sprintf("lead-%d-%s", r.Lead.ID, r.Recipient)
+}
+
+func (s *SheetSink) post(ctx context.Context, r sheetRow, attempt int) error {
+	body, err := json.Marshal(r)
+	if err != nil {
+		return errors.Wrap(err, "marshal row")
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.target, bytes.NewReader(body))
+	if err != nil {
+		return errors.Wrap(err, "sheet request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", r.idempotencyKey())
+	req.Header.Set("X-Delivery-Attempt", strconv.Itoa(attempt))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "post row")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.Errorf("sheet webhook: %s", resp.Status)
+	}
+	return nil
+}
+
+// redactedSink hides webhook URLs, which usually embed a secret.
+func redactedSink(sink string) string {
+	if isWebhookSink(sink) {
+		return redacted(sink)
+	}
+	return orOff(sink)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"testing"
+
+	pebbledb "github.com/cockroachdb/pebble"
+	"github.com/cockroachdb/pebble/vfs"
+	"go.uber.org/zap"
+)
+
+func testDB(t *testing.T) *pebbledb.DB {
+	t.Helper()
+	db, err := pebbledb.Open("", &pebbledb.Options{FS: vfs.NewMem()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+// TestSheetWebhookIdempotencyKey checks that every attempt at a row
+// carries the same key, and different rows different ones.
+func TestSheetWebhookIdempotencyKey(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		keys []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		keys = append(keys, r.Header.Get("Idempotency-Key"))
+		first := len(keys) == 1
+		mu.Unlock()
+		if first {
+			w.WriteHeader(http.StatusBadGateway) // the first attempt fails
+		}
+	}))
+	defer srv.Close()
+
+	s := NewSheetSink(srv.URL, testDB(t), zap.NewNop(), io.Discard)
+	ctx := context.Background()
+	rows := []sheetRow{
+		{Lead: Lead{ID: 7}, Recipient: "alice"},
+		{Lead: Lead{ID: 7}, Recipient: "alice"},
+		{Lead: Lead{ID: 7}, Recipient: "mailto:bob@example.com"},
+		{Lead: Lead{ID: 8}, Recipient: "alice"},
+	}
+	if err := s.post(ctx, rows[0], 1); err == nil {
+		t.Fatal("failed post reported as success")
+	}
+	for _, r := range rows[1:] {
+		if err := s.post(ctx, r, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := []string{"lead-7-alice", "lead-7-alice", "lead-7-mailto:bob@example.com", "lead-8-alice"}
+	if len(keys) != len(want) {
+		t.Fatalf("got %d requests, want %d", len(keys), len(want))
+	}
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Errorf("request %d: Idempotency-Key = %q, want %q", i, keys[i], want[i])
+		}
+	}
+}
+
+// TestSheetQueue checks that rows wait in the database until the sink
+// accepts them, so neither a failing webhook nor a restart loses one, and
+// that the attempt header keeps counting across the restart.
+func TestSheetQueue(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		accept   bool
+		received []string
+	)
+	// The sink fails, and the process stops before a retry.
+	ctx, stop := context.WithCancel(context.Background())
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, r.Header.Get("Idempotency-Key")+" #"+r.Header.Get("X-Delivery-Attempt"))
+		if !accept {
+			stop()
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	db := testDB(t)
+	s := NewSheetSink(srv.URL, db, zap.NewNop(), io.Discard)
+	s.Append(Lead{ID: 2}, "alice", "второй")
+	s.Append(Lead{ID: 1}, "alice", "первый")
+	s.deliverPending(ctx)
+
+	restarted := NewSheetSink(srv.URL, db, zap.NewNop(), io.Discard)
+	rows, err := restarted.pending()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || rows[0].Row.Lead.ID != 1 || rows[0].Attempts != 1 || rows[1].Attempts != 0 {
+		t.Fatalf("pending after a failed attempt = %+v", rows)
+	}
+
+	mu.Lock()
+	accept = true
+	mu.Unlock()
+	restarted.deliverPending(context.Background())
+	if want := []string{"lead-1-alice #1", "lead-1-alice #2", "lead-2-alice #1"}; !slices.Equal(received, want) {
+		t.Errorf("delivered %v, want %v", received, want)
+	}
+	if left, _ := restarted.pending(); len(left) != 0 {
+		t.Errorf("%d rows left after delivery", len(left))
+	}
+}
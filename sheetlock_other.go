@@ -0,0 +1,11 @@
+//go:build !unix
+
+package main
+
+import "os"
+
+// Appends from this process are already serialized by SheetSink; other
+// platforms get no cross-process lock.
+func lockFile(*os.File) error { return nil }
+
+func unlockFile(*os.File) {}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+)
+
+// shortMessages routes the compact updateShortMessage and
+// updateShortChatMessage forms into handleMessage. The updates manager
+// normally expands them into UpdateNewMessage before they get here, but
+// tg.UpdateDispatcher silently drops them, so any that slip through
+// would otherwise be lost.
+type shortMessages struct {
+	next   telegram.UpdateHandler
+	selfID *atomic.Int64
+	handle func(ctx context.Context, msg *tg.Message) error
+}
+
+func (h shortMessages) Handle(ctx context.Context, u tg.UpdatesClass) error {
+	switch u := u.(type) {
+	case *tg.UpdateShortMessage:
+		return h.handle(ctx, shortMessageToMessage(u, h.selfID.Load()))
+	case *tg.UpdateShortChatMessage:
+		return h.handle(ctx, shortChatMessageToMessage(u))
+	default:
+		return h.next.Handle(ctx, u)
+	}
+}
+
+func shortMessageToMessage(u *tg.UpdateShortMessage, selfID int64) *tg.Message {
+	msg := &tg.Message{
+		ID:      u.ID,
+		PeerID:  &tg.PeerUser{UserID: u.UserID},
+		Message: u.Message,
+		Date:    u.Date,
+	}
+	msg.SetOut(u.Out)
+	if u.Out {
+		msg.SetFromID(&tg.PeerUser{UserID: selfID})
+	} else {
+		msg.SetFromID(&tg.PeerUser{UserID: u.UserID})
+	}
+	if v, ok := u.GetFwdFrom(); ok {
+		msg.SetFwdFrom(v)
+	}
+	if v, ok := u.GetReplyTo(); ok {
+		msg.SetReplyTo(v)
+	}
+	if v, ok := u.GetEntities(); ok {
+		msg.SetEntities(v)
+	}
+	return msg
+}
+
+func shortChatMessageToMessage(u *tg.UpdateShortChatMessage) *tg.Message {
+	msg := &tg.Message{
+		ID:      u.ID,
+		PeerID:  &tg.PeerChat{ChatID: u.ChatID},
+		Message: u.Message,
+		Date:    u.Date,
+	}
+	msg.SetOut(u.Out)
+	msg.SetFromID(&tg.PeerUser{UserID: u.FromID})
+	if v, ok := u.GetFwdFrom(); ok {
+		msg.SetFwdFrom(v)
+	}
+	if v, ok := u.GetReplyTo(); ok {
+		msg.SetReplyTo(v)
+	}
+	if v, ok := u.GetEntities(); ok {
+		msg.SetEntities(v)
+	}
+	return msg
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// contentHash identifies a message text, ignoring case and spacing.
+func contentHash(text string) string {
+	sum := sha256.Sum256([]byte(normalizeForHash(text)))
+	return hex.EncodeToString(sum[:])
+}
+
+// contentSpamHook stores leads whose exact normalized text was already
+// seen in another message, from any sender and chat, within
+// SPAM_CONTENT_WINDOW, without forwarding them. It catches the same
+// request pasted by several accounts, which SPAM_CHAT_THRESHOLD (per
+// sender) and DEDUP_SCOPE (per message) let through. Like spreadHook it
+// applies to urgent leads too. It runs right after dedupHook: a copy that
+// a later hook skips must still be recorded, or the next copy from
+// another chat would pass.
+func contentSpamHook(store LeadStore, window time.Duration, stats *Stats) LeadHook {
+	return func(ctx context.Context, l Lead) (Lead, error) {
+		if window <= 0 || strings.TrimSpace(l.Text) == "" {
+			return l, nil
+		}
+		seen, err := store.TextSeen(ctx, contentHash(l.Text), l.ChatID, l.MsgID, window)
+		if err != nil {
+			return l, err
+		}
+		if seen {
+			stats.IncDuplicateText()
+			l.Tags = append(l.Tags, "duplicate-text")
+			return l, ErrSkipLead
+		}
+		return l, nil
+	}
+}
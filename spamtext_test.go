@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/go-faster/errors"
+)
+
+// TestContentSpamSkippedCopy checks that a copy skipped by a later hook
+// (here MIN_SCORE) still counts, so the next copy from another chat is
+// caught as duplicate text.
+func TestContentSpamSkippedCopy(t *testing.T) {
+	cfg := testConfig()
+	cfg.MinScore = 5
+	cfg.SpamContentWindow = time.Hour
+	a := newTestApp(t, cfg, RegexClassifier{})
+	ctx := context.Background()
+	hooks := a.live().hooks
+
+	const text = "Нужен бот для магазина, пишите в ЛС"
+	first := Lead{Campaign: "development", ChatID: 10, MsgID: 1, Text: text, Score: 1, CreatedAt: time.Now()}
+	l, err := runHooks(ctx, hooks, first)
+	if !errors.Is(err, ErrSkipLead) || !slices.Contains(l.Tags, "low-score") {
+		t.Fatalf("first copy: %v, tags %v; want skipped as low-score", err, l.Tags)
+	}
+
+	second := Lead{Campaign: "development", ChatID: 11, MsgID: 7, Text: text, Score: 9, CreatedAt: time.Now()}
+	l, err = runHooks(ctx, hooks, second)
+	if !errors.Is(err, ErrSkipLead) || !slices.Contains(l.Tags, "duplicate-text") {
+		t.Errorf("second copy: %v, tags %v; want skipped as duplicate-text", err, l.Tags)
+	}
+	if n := a.stats.Snapshot().DuplicateText; n != 1 {
+		t.Errorf("DuplicateText = %d, want 1", n)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	pebbledb "github.com/cockroachdb/pebble"
+	"github.com/go-faster/errors"
+	openai "github.com/sashabaranov/go-openai"
+	"go.uber.org/zap"
+)
+
+// errBudgetExhausted is returned instead of calling OpenAI once the day's
+// DAILY_TOKEN_BUDGET or DAILY_SPEND_CAP_USD is used up.
+var errBudgetExhausted = errors.New("daily OpenAI budget exhausted")
+
+// spendUsage is what OpenAI reported for a day, persisted so a restart
+// doesn't reset the cap.
+type spendUsage struct {
+	Tokens int64   `json:"tokens"`
+	USD    float64 `json:"usd"`
+}
+
+// spendCap counts the tokens and estimated cost of every completion per
+// day in TIMEZONE and refuses new calls once a cap is reached. The cap is
+// checked before each call, so concurrent calls may overshoot it by a
+// few requests.
+type spendCap struct {
+	next     ChatCompleter
+	db       *pebbledb.DB
+	lg       *zap.Logger
+	out      io.Writer
+	loc      *time.Location
+	tokens   int64
+	usd      float64
+	priceIn  float64 // USD per million tokens
+	priceOut float64
+
+	mu   sync.Mutex
+	day  string
+	used spendUsage
+}
+
+func newSpendCap(next ChatCompleter, db *pebbledb.DB, cfg Config, lg *zap.Logger, out io.Writer) *spendCap {
+	return &spendCap{
+		next:     next,
+		db:       db,
+		lg:       lg,
+		out:      out,
+		loc:      cfg.Location,
+		tokens:   cfg.DailyTokenBudget,
+		usd:      cfg.DailySpendCapUSD,
+		priceIn:  cfg.PriceInputPer1M,
+		priceOut: cfg.PriceOutputPer1M,
+	}
+}
+
+func spendKey(day string) []byte { return []byte("spend/" + day) }
+
+// rollover switches to today's usage, loading it if it was stored.
+// Callers hold mu.
+func (s *spendCap) rollover(now time.Time) {
+	day := now.In(s.loc).Format(chatCountDay)
+	if day == s.day {
+		return
+	}
+	s.day, s.used = day, spendUsage{}
+	v, closer, err := s.db.Get(spendKey(day))
+	if err != nil {
+		if !errors.Is(err, pebbledb.ErrNotFound) {
+			s.lg.Error("Load OpenAI spend", zap.Error(err))
+		}
+		return
+	}
+	defer closer.Close()
+	if err := json.Unmarshal(v, &s.used); err != nil {
+		s.lg.Error("Decode OpenAI spend", zap.Error(err))
+	}
+}
+
+func (s *spendCap) exhausted() bool {
+	return (s.tokens > 0 && s.used.Tokens >= s.tokens) || (s.usd > 0 && s.used.USD >= s.usd)
+}
+
+func (s *spendCap) CreateChatCompletion(ctx context.Context, req openai.ChatCompletionRequest) (openai.ChatCompletionResponse, error) {
+	s.mu.Lock()
+	s.rollover(time.Now())
+	if s.exhausted() {
+		s.mu.Unlock()
+		return openai.ChatCompletionResponse{}, errBudgetExhausted
+	}
+	s.mu.Unlock()
+
+	resp, err := s.next.CreateChatCompletion(ctx, req)
+	if err != nil {
+		return resp, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rollover(time.Now())
+	was := s.exhausted()
+	s.used.Tokens += int64(resp.Usage.TotalTokens)
+	s.used.USD += float64(resp.Usage.PromptTokens)/1e6*s.priceIn + float64(resp.Usage.CompletionTokens)/1e6*s.priceOut
+	if data, err := json.Marshal(s.used); err == nil {
+		if err := s.db.Set(spendKey(s.day), data, pebbledb.NoSync); err != nil {
+			s.lg.Error("Store OpenAI spend", zap.Error(err))
+		}
+	}
+	if !was && s.exhausted() {
+		s.lg.Warn("Daily OpenAI budget exhausted", zap.Int64("tokens", s.used.Tokens), zap.Float64("usd", s.used.USD))
+		fmt.Fprintf(s.out, "Daily OpenAI budget exhausted (%d tokens, $%.2f), OpenAI is not called until midnight\n", s.used.Tokens, s.used.USD)
+	}
+	return resp, nil
+}
+
+// Report describes today's usage against the caps for /stats.
+func (s *spendCap) Report() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.rollover(time.Now())
+	out := fmt.Sprintf("OpenAI сегодня: %d токенов, $%.4f", s.used.Tokens, s.used.USD)
+	if s.tokens > 0 {
+		out += fmt.Sprintf("\nОсталось токенов: %d", max(s.tokens-s.used.Tokens, 0))
+	}
+	if s.usd > 0 {
+		out += fmt.Sprintf("\nОсталось бюджета: $%.4f", max(s.usd-s.used.USD, 0))
+	}
+	return out
+}
+
+// replayAtMidnight wakes replayHeld when the day, and with it the spend
+// cap, rolls over.
+func (a *App) replayAtMidnight(ctx context.Context) {
+	for {
+		now := time.Now().In(a.cfg.Location)
+		next := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, a.cfg.Location)
+		t := time.NewTimer(next.Sub(now))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return
+		case <-t.C:
+		}
+		select {
+		case a.replayNow <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// senderSpread counts the distinct monitored chats each sender posted in
+// within a sliding window. Accounts spraying the same request across many
+// groups are usually spam.
+type senderSpread struct {
+	window time.Duration
+
+	mu        sync.Mutex
+	senders   map[int64]map[int64]time.Time // fromID → chatID → last post
+	lastSweep time.Time
+}
+
+func newSenderSpread(window time.Duration) *senderSpread {
+	return &senderSpread{window: window, senders: map[int64]map[int64]time.Time{}, lastSweep: time.Now()}
+}
+
+// Record notes a post by fromID in chatID and returns how many chats the
+// sender posted in within the window, this one included.
+func (s *senderSpread) Record(fromID, chatID int64) int {
+	if fromID == 0 {
+		return 0
+	}
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.lastSweep) > s.window {
+		// Forget senders that went quiet, so the map stays bounded.
+		for id, chats := range s.senders {
+			if s.prune(chats, now) == 0 {
+				delete(s.senders, id)
+			}
+		}
+		s.lastSweep = now
+	}
+	chats, ok := s.senders[fromID]
+	if !ok {
+		chats = map[int64]time.Time{}
+		s.senders[fromID] = chats
+	}
+	chats[chatID] = now
+	return s.prune(chats, now)
+}
+
+func (s *senderSpread) prune(chats map[int64]time.Time, now time.Time) int {
+	for id, t := range chats {
+		if now.Sub(t) > s.window {
+			delete(chats, id)
+		}
+	}
+	return len(chats)
+}
+
+// spreadHook stores leads from senders who posted in threshold or more
+// chats within SPAM_WINDOW without forwarding them. Unlike the other
+// filters it applies to urgent leads too, since spam often claims urgency.
+func spreadHook(threshold int) LeadHook {
+	return func(_ context.Context, l Lead) (Lead, error) {
+		if threshold > 0 && l.RecentChats >= threshold {
+			l.Tags = append(l.Tags, "cross-post")
+			return l, ErrSkipLead
+		}
+		return l, nil
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Stats counts pipeline events. Update handlers run concurrently, so all
+// counters are atomic; the zero value is ready to use.
+type Stats struct {
+	messages  atomic.Int64
+	leads     atomic.Int64
+	forwarded atomic.Int64
+	errors    atomic.Int64
+	// skippedLanguage counts messages dropped by LANGUAGES.
+	skippedLanguage atomic.Int64
+	// emptyResponses counts classifications left with an empty OpenAI
+	// answer after any retry.
+	emptyResponses atomic.Int64
+	// duplicateText counts leads held back by SPAM_CONTENT_WINDOW.
+	duplicateText atomic.Int64
+
+	// Telegram API throttling: FLOOD_WAIT errors and calls delayed by
+	// the RATE_INTERVAL limiter, with the total time waited.
+	floodWaits    atomic.Int64
+	floodWaitTime atomic.Int64
+	throttles     atomic.Int64
+	throttleTime  atomic.Int64
+}
+
+// StatsSnapshot is a point-in-time copy of Stats.
+type StatsSnapshot struct {
+	Messages  int64
+	Leads     int64
+	Forwarded int64
+	Errors    int64
+
+	SkippedLanguage int64
+	EmptyResponses  int64
+	DuplicateText   int64
+
+	FloodWaits    int64
+	FloodWaitTime time.Duration
+	Throttles     int64
+	ThrottleTime  time.Duration
+}
+
+func (s *Stats) IncMessages()  { s.messages.Add(1) }
+func (s *Stats) IncLeads()     { s.leads.Add(1) }
+func (s *Stats) IncForwarded() { s.forwarded.Add(1) }
+func (s *Stats) IncErrors()    { s.errors.Add(1) }
+
+func (s *Stats) IncSkippedLanguage() { s.skippedLanguage.Add(1) }
+func (s *Stats) IncEmptyResponses()  { s.emptyResponses.Add(1) }
+func (s *Stats) IncDuplicateText()   { s.duplicateText.Add(1) }
+
+func (s *Stats) AddFloodWait(d time.Duration) {
+	s.floodWaits.Add(1)
+	s.floodWaitTime.Add(int64(d))
+}
+
+func (s *Stats) AddThrottle(d time.Duration) {
+	s.throttles.Add(1)
+	s.throttleTime.Add(int64(d))
+}
+
+// Snapshot reads every counter. The values are individually consistent
+// but may be read at slightly different moments.
+func (s *Stats) Snapshot() StatsSnapshot {
+	return StatsSnapshot{
+		Messages:  s.messages.Load(),
+		Leads:     s.leads.Load(),
+		Forwarded: s.forwarded.Load(),
+		Errors:    s.errors.Load(),
+
+		SkippedLanguage: s.skippedLanguage.Load(),
+		EmptyResponses:  s.emptyResponses.Load(),
+		DuplicateText:   s.duplicateText.Load(),
+
+		FloodWaits:    s.floodWaits.Load(),
+		FloodWaitTime: time.Duration(s.floodWaitTime.Load()),
+		Throttles:     s.throttles.Load(),
+		ThrottleTime:  time.Duration(s.throttleTime.Load()),
+	}
+}
+
+// statsCommand reports the session counters and the circuit breaker.
+func (a *App) statsCommand() string {
+	st := a.stats.Snapshot()
+	var b strings.Builder
+	fmt.Fprintf(&b, "Сообщений: %d\nЛидов: %d\nПереслано: %d\nОшибок: %d", st.Messages, st.Leads, st.Forwarded, st.Errors)
+	if a.cfg.Languages != nil {
+		fmt.Fprintf(&b, "\nПропущено по языку: %d", st.SkippedLanguage)
+	}
+	if a.cfg.SpamContentWindow > 0 {
+		fmt.Fprintf(&b, "\nНе переслано как повтор текста: %d", st.DuplicateText)
+	}
+	if st.EmptyResponses > 0 {
+		fmt.Fprintf(&b, "\nПустых ответов OpenAI: %d", st.EmptyResponses)
+	}
+	fmt.Fprintf(&b, "\nFLOOD_WAIT: %d (ожидание %s)", st.FloodWaits, st.FloodWaitTime.Round(time.Second))
+	fmt.Fprintf(&b, "\nЗадержано лимитом: %d (ожидание %s)", st.Throttles, st.ThrottleTime.Round(time.Millisecond))
+	if a.spend != nil {
+		b.WriteString("\n" + a.spend.Report())
+	}
+	if a.breaker == nil {
+		b.WriteString("\nOpenAI: circuit breaker выключен")
+		return b.String()
+	}
+	state, failures := a.breaker.State()
+	fmt.Fprintf(&b, "\nOpenAI: %s (ошибок подряд: %d)", state, failures)
+	if held := a.heldCount(); held > 0 {
+		fmt.Fprintf(&b, "\nОтложено до восстановления: %d", held)
+	}
+	return b.String()
+}
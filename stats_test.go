@@ -0,0 +1,56 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestStatsConcurrent updates every counter from many goroutines while
+// others take snapshots; run it with -race.
+func TestStatsConcurrent(t *testing.T) {
+	const goroutines, perGoroutine = 16, 1000
+	var s Stats
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				s.Snapshot()
+			}
+		}
+	}()
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < perGoroutine; i++ {
+				s.IncMessages()
+				s.IncLeads()
+				s.IncForwarded()
+				s.IncErrors()
+				s.IncSkippedLanguage()
+				s.IncEmptyResponses()
+				s.IncDuplicateText()
+				s.AddFloodWait(time.Millisecond)
+				s.AddThrottle(time.Microsecond)
+			}
+		}()
+	}
+	wg.Wait()
+	close(stop)
+
+	const n = goroutines * perGoroutine
+	want := StatsSnapshot{
+		Messages: n, Leads: n, Forwarded: n, Errors: n,
+		SkippedLanguage: n, EmptyResponses: n, DuplicateText: n,
+		FloodWaits: n, FloodWaitTime: n * time.Millisecond,
+		Throttles: n, ThrottleTime: n * time.Microsecond,
+	}
+	if got := s.Snapshot(); got != want {
+		t.Errorf("Snapshot = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/telegram/message/styling"
+)
+
+type SummaryStyle string
+
+const (
+	StyleEmoji    SummaryStyle = "emoji"
+	StylePlain    SummaryStyle = "plain"
+	StyleMarkdown SummaryStyle = "markdown"
+)
+
+func parseSummaryStyle(s string) (SummaryStyle, error) {
+	switch st := SummaryStyle(s); st {
+	case "":
+		return StyleEmoji, nil
+	case StyleEmoji, StylePlain, StyleMarkdown:
+		return st, nil
+	default:
+		return "", errors.Errorf("SUMMARY_STYLE must be emoji, plain or markdown, got %q", s)
+	}
+}
+
+// summarySegment is a piece of the summary; label segments are bold in
+// the markdown style, and segments with a url are rendered as a link.
+type summarySegment struct {
+	text  string
+	label bool
+	url   string
+}
+
+func summarySegments(l Lead, style SummaryStyle, loc *time.Location) []summarySegment {
+	var segs []summarySegment
+	add := func(text string, label bool) {
+		segs = append(segs, summarySegment{text: text, label: label})
+	}
+
+	// Emoji only in the emoji style; plain and markdown keep the words.
+	selfTest, urgent := "SELF-TEST, not a real lead\n", "URGENT\n"
+	if style == StyleEmoji {
+		selfTest, urgent = "🧪 "+selfTest, "🚨 "+urgent
+	}
+	if l.SelfTest {
+		add(selfTest, true)
+	}
+	if l.Urgent {
+		add(urgent, true)
+	}
+	if l.Recovered {
+		add(fmt.Sprintf("(recovered, sent %s)\n", l.SentAt.In(loc).Format("02.01 15:04")), true)
+	}
+	image := "[по изображению] "
+	if style == StyleEmoji {
+		add(fmt.Sprintf("🔍 Найден запрос: %s (#%d)", l.Campaign, l.ID), false)
+		add(fmt.Sprintf("\n\n👤 %s (ID: %d)", l.Username, l.FromID), false)
+		if l.Topic != "" {
+			add("\n🗂 Тема: "+l.Topic, false)
+		}
+		if l.Contact != "" {
+			add("\n✉️ ", false)
+			segs = append(segs, summarySegment{text: "Написать автору", url: l.Contact})
+		}
+		add(fmt.Sprintf("\n⭐ Оценка: %d", l.Score), false)
+		if l.Weighted != 0 {
+			add(fmt.Sprintf(" (итог %.2f)", l.Weighted), false)
+		}
+		if l.Budget != nil {
+			add("\n💰 Бюджет: "+l.Budget.String(), false)
+		}
+		if l.RecentChats > 1 {
+			add(fmt.Sprintf("\n📢 Писал недавно в %d чатах", l.RecentChats), false)
+		}
+		if l.ReplyTo != "" {
+			add("\n\n↩️ в ответ на: «"+l.ReplyTo+"»", false)
+		}
+		add("\n\n💬 ", false)
+		image = "🖼 (по изображению) "
+	} else {
+		add(fmt.Sprintf("Найден запрос: %s (#%d)", l.Campaign, l.ID), true)
+		add("\n\nАвтор: ", true)
+		add(fmt.Sprintf("%s (ID: %d)", l.Username, l.FromID), false)
+		if l.Topic != "" {
+			add("\nТема: ", true)
+			add(l.Topic, false)
+		}
+		if l.Contact != "" {
+			add("\nСвязаться: ", true)
+			segs = append(segs, summarySegment{text: "написать автору", url: l.Contact})
+		}
+		add("\nОценка: ", true)
+		add(fmt.Sprint(l.Score), false)
+		if l.Weighted != 0 {
+			add(fmt.Sprintf(", итог %.2f", l.Weighted), false)
+		}
+		if l.Budget != nil {
+			add("\nБюджет: ", true)
+			add(l.Budget.String(), false)
+		}
+		if l.RecentChats > 1 {
+			add("\nНедавно писал в чатах: ", true)
+			add(fmt.Sprint(l.RecentChats), false)
+		}
+		if l.ReplyTo != "" {
+			add("\n\nВ ответ на: ", true)
+			add("«"+l.ReplyTo+"»", false)
+		}
+		add("\n\nСообщение: ", true)
+	}
+	if l.FromImage {
+		add(image, false)
+	}
+	add(l.Text, false)
+	if l.Link != "" {
+		if style == StyleEmoji {
+			add("\n\n🔗 "+l.Link, false)
+		} else {
+			add("\n\nСсылка: ", true)
+			add(l.Link, false)
+		}
+	}
+	if len(l.Context) > 0 {
+		if style == StyleEmoji {
+			add("\n\n📜 Контекст:", false)
+		} else {
+			add("\n\nКонтекст:", true)
+		}
+		for _, c := range l.Context {
+			add("\n— "+c, false)
+		}
+	}
+	return segs
+}
+
+// formatSummary renders the summary as plain text, with times in loc; the
+// markdown style falls back to its unformatted form (e.g. for email) and
+// links are spelled out after their text.
+func formatSummary(l Lead, style SummaryStyle, loc *time.Location) string {
+	var b strings.Builder
+	for _, s := range summarySegments(l, style, loc) {
+		b.WriteString(s.text)
+		if s.url != "" {
+			fmt.Fprintf(&b, " (%s)", s.url)
+		}
+	}
+	return b.String()
+}
+
+// styledSummary renders the summary with Telegram formatting entities.
+// Entities carry the formatting, so user text is never parsed as markup
+// and needs no escaping; the builder computes their UTF-16 offsets.
+func styledSummary(l Lead, style SummaryStyle, loc *time.Location) []styling.StyledTextOption {
+	var opts []styling.StyledTextOption
+	for _, s := range summarySegments(l, style, loc) {
+		if s.url != "" {
+			opts = append(opts, styling.TextURL(s.text, s.url))
+		} else if s.label && style == StyleMarkdown {
+			opts = append(opts, styling.Bold(s.text))
+		} else {
+			opts = append(opts, styling.Plain(s.text))
+		}
+	}
+	return opts
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+	"unicode"
+)
+
+// hasEmoji reports whether s contains a pictograph.
+func hasEmoji(s string) bool {
+	return strings.IndexFunc(s, func(r rune) bool { return unicode.Is(unicode.So, r) }) >= 0
+}
+
+func TestSummaryStyles(t *testing.T) {
+	l := Lead{
+		ID: 7, Campaign: "development", FromID: 200, Username: "@alice",
+		Text: "Нужен бот", Score: 3, Topic: "Заказы", Contact: "https://t.me/alice",
+		Budget: &Budget{Amount: 50000, Currency: "RUB"}, RecentChats: 3, ReplyTo: "кто сделает?",
+		Link: "https://t.me/c/1/2", Context: []string{"привет"}, FromImage: true,
+		SelfTest: true, Urgent: true,
+	}
+	for _, tt := range []struct {
+		style SummaryStyle
+		emoji bool
+	}{
+		{style: StyleEmoji, emoji: true},
+		{style: StylePlain},
+		{style: StyleMarkdown},
+	} {
+		t.Run(string(tt.style), func(t *testing.T) {
+			got := formatSummary(l, tt.style, time.UTC)
+			if hasEmoji(got) != tt.emoji {
+				t.Errorf("emoji in %s summary: %v, want %v\n%s", tt.style, !tt.emoji, tt.emoji, got)
+			}
+			for _, want := range []string{"SELF-TEST", "URGENT", "#7", "@alice", "Нужен бот", "https://t.me/c/1/2"} {
+				if !strings.Contains(got, want) {
+					t.Errorf("%s summary lacks %q:\n%s", tt.style, want, got)
+				}
+			}
+		})
+	}
+}
+
+// TestSummaryRecoveredTime checks that the send time of a recovered lead
+// is shown in TIMEZONE, like every other time the bot prints.
+func TestSummaryRecoveredTime(t *testing.T) {
+	loc := time.FixedZone("UTC+3", 3*60*60)
+	l := Lead{ID: 7, Campaign: "development", Recovered: true, SentAt: time.Date(2026, 3, 1, 22, 30, 0, 0, time.UTC)}
+	if got := formatSummary(l, StylePlain, loc); !strings.Contains(got, "sent 02.03 01:30") {
+		t.Errorf("summary does not show the send time in TIMEZONE:\n%s", got)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/gotd/td/bin"
+	"github.com/gotd/td/telegram"
+	"github.com/gotd/td/tg"
+	"golang.org/x/time/rate"
+)
+
+// throttle limits Telegram API calls to RATE_INTERVAL with RATE_BURST,
+// like the contrib ratelimit middleware, and counts the calls it had to
+// delay for /stats.
+func (a *App) throttle(lim *rate.Limiter) telegram.Middleware {
+	return telegram.MiddlewareFunc(func(next tg.Invoker) telegram.InvokeFunc {
+		return func(ctx context.Context, input bin.Encoder, output bin.Decoder) error {
+			r := lim.Reserve()
+			if delay := r.Delay(); delay > 0 {
+				a.stats.AddThrottle(delay)
+				t := time.NewTimer(delay)
+				select {
+				case <-t.C:
+				case <-ctx.Done():
+					t.Stop()
+					r.Cancel()
+					return ctx.Err()
+				}
+			}
+			return next.Invoke(ctx, input, output)
+		}
+	})
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gotd/contrib/storage"
+	"github.com/gotd/td/telegram/query/dialogs"
+)
+
+// topChatsShown is how many chats /topchats lists.
+const topChatsShown = 10
+
+// topChatsCommand handles "/topchats [days]": the chats that produced the
+// most leads over the window, 7 days by default.
+func (a *App) topChatsCommand(ctx context.Context, args string) (string, error) {
+	days := 7
+	if args != "" {
+		n, err := strconv.Atoi(args)
+		if err != nil || n <= 0 {
+			return fmt.Sprintf("invalid number of days %q, e.g. /topchats 30", args), nil
+		}
+		days = n
+	}
+	counts, err := a.leads.CountByChat(ctx, time.Now().AddDate(0, 0, -(days-1)))
+	if err != nil {
+		return "", err
+	}
+	if len(counts) == 0 {
+		return fmt.Sprintf("Нет лидов за %d дн.", days), nil
+	}
+
+	ids := make([]int64, 0, len(counts))
+	for id := range counts {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		if counts[ids[i]] != counts[ids[j]] {
+			return counts[ids[i]] > counts[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+	if len(ids) > topChatsShown {
+		ids = ids[:topChatsShown]
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Лиды по чатам за %d дн.:", days)
+	for i, id := range ids {
+		fmt.Fprintf(&b, "\n%d. %s (ID: %d) — %d", i+1, a.chatTitle(ctx, id), id, counts[id])
+	}
+	return b.String(), nil
+}
+
+// chatTitle looks a bare chat ID up in peer storage for display, trying
+// each peer kind since leads don't record it.
+func (a *App) chatTitle(ctx context.Context, id int64) string {
+	for _, kind := range []dialogs.PeerKind{dialogs.Channel, dialogs.Chat, dialogs.User} {
+		p, err := a.peerDB.Find(ctx, storage.PeerKey{Kind: kind, ID: id})
+		if err != nil {
+			continue
+		}
+		switch {
+		case p.Channel != nil:
+			return p.Channel.Title
+		case p.Chat != nil:
+			return p.Chat.Title
+		case p.User != nil && p.User.Username != "":
+			return "@" + p.User.Username
+		case p.User != nil:
+			return strings.TrimSpace(p.User.FirstName + " " + p.User.LastName)
+		}
+	}
+	return "unknown"
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/contrib/storage"
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+)
+
+// generalTopicID is the forum's default "General" topic, which messages
+// without a topic reply header belong to.
+const generalTopicID = 1
+
+// forumTopicID returns the forum topic msg was posted in.
+func forumTopicID(msg *tg.Message) int {
+	reply, ok := msg.ReplyTo.(*tg.MessageReplyHeader)
+	if !ok || !reply.ForumTopic {
+		return generalTopicID
+	}
+	if top, ok := reply.GetReplyToTopID(); ok {
+		return top
+	}
+	if id, ok := reply.GetReplyToMsgID(); ok {
+		return id
+	}
+	return generalTopicID
+}
+
+// MonitorTopics filters forum messages by topic title (MONITOR_TOPICS):
+// with any allowed titles only those topics are classified, and blocked
+// ("!"-prefixed) titles never are. Titles match case-insensitively. The
+// zero value allows every topic.
+type MonitorTopics struct {
+	allow, block map[string]bool
+}
+
+func parseMonitorTopics(s string) MonitorTopics {
+	var t MonitorTopics
+	for _, title := range strings.Split(s, ",") {
+		title = strings.ToLower(strings.TrimSpace(title))
+		blocked := strings.HasPrefix(title, "!")
+		if title = strings.TrimSpace(strings.TrimPrefix(title, "!")); title == "" {
+			continue
+		}
+		set := &t.allow
+		if blocked {
+			set = &t.block
+		}
+		if *set == nil {
+			*set = map[string]bool{}
+		}
+		(*set)[title] = true
+	}
+	return t
+}
+
+// Allows reports whether messages in the topic are classified.
+func (t MonitorTopics) Allows(title string) bool {
+	title = strings.ToLower(title)
+	if t.block[title] {
+		return false
+	}
+	return len(t.allow) == 0 || t.allow[title]
+}
+
+func (t MonitorTopics) String() string {
+	var parts []string
+	for title := range t.allow {
+		parts = append(parts, title)
+	}
+	for title := range t.block {
+		parts = append(parts, "!"+title)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+// topicTitles caches forum topic titles by chat and topic ID. Cleared
+// when it grows past topicTitlesMax.
+type topicTitles struct {
+	mu     sync.Mutex
+	titles map[channelPost]string
+}
+
+const topicTitlesMax = 10000
+
+func (t *topicTitles) reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.titles = nil
+}
+
+func (t *topicTitles) get(k channelPost) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	v, ok := t.titles[k]
+	return v, ok
+}
+
+func (t *topicTitles) put(k channelPost, title string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.titles == nil || len(t.titles) >= topicTitlesMax {
+		t.titles = map[channelPost]string{}
+	}
+	t.titles[k] = title
+}
+
+// forumTopic returns the title of the forum topic msg was posted in,
+// empty outside forums or when it can't be fetched.
+func (a *App) forumTopic(ctx context.Context, p storage.Peer, msg *tg.Message) string {
+	if p.Channel == nil || !p.Channel.Forum {
+		return ""
+	}
+	k := channelPost{channelID: p.Key.ID, postID: forumTopicID(msg)}
+	if title, ok := a.topics.get(k); ok {
+		return title
+	}
+	title, err := a.fetchTopicTitle(ctx, p, k.postID)
+	if err != nil {
+		a.lg.Info("Forum topic unavailable", zap.Int64("chat_id", p.Key.ID), zap.Int("topic", k.postID), zap.Error(err))
+		return ""
+	}
+	a.topics.put(k, title)
+	return title
+}
+
+func (a *App) fetchTopicTitle(ctx context.Context, p storage.Peer, topicID int) (string, error) {
+	if err := a.chatLimit.Wait(ctx, p.Key.ID); err != nil {
+		return "", err
+	}
+	res, err := a.api.ChannelsGetForumTopicsByID(ctx, &tg.ChannelsGetForumTopicsByIDRequest{
+		Channel: &tg.InputChannel{ChannelID: p.Channel.ID, AccessHash: p.Channel.AccessHash},
+		Topics:  []int{topicID},
+	})
+	if err != nil {
+		return "", errors.Wrap(err, "get forum topic")
+	}
+	for _, t := range res.Topics {
+		if t, ok := t.(*tg.ForumTopic); ok && t.ID == topicID {
+			return t.Title, nil
+		}
+	}
+	return "", errors.Errorf("topic %d not found", topicID)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/contrib/storage"
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+)
+
+// isTriage reports whether msg was forwarded into the account's own Saved
+// Messages, which is treated as a manual triage inbox.
+func (a *App) isTriage(msg *tg.Message) bool {
+	pu, ok := msg.PeerID.(*tg.PeerUser)
+	return ok && pu.UserID == a.selfID.Load() && isForwarded(msg)
+}
+
+// triage classifies a message forwarded to Saved Messages for every
+// campaign, replies with the verdicts and routes relevant ones like any
+// other lead, tagged "triage".
+func (a *App) triage(ctx context.Context, msg *tg.Message) error {
+	text := a.extractText(msg)
+	clean := normalizeText(text, a.cfg.StripURLs)
+	var reply string
+	if clean == "" {
+		reply = "Нет текста для классификации"
+	} else {
+		reply = a.triageText(ctx, msg, text, clean)
+	}
+	if _, err := a.sender.To(&tg.InputPeerSelf{}).Reply(msg.ID).Text(ctx, reply); err != nil {
+		return errors.Wrap(err, "triage reply")
+	}
+	return nil
+}
+
+func (a *App) triageText(ctx context.Context, msg *tg.Message, text, clean string) string {
+	fwd, _ := msg.GetFwdFrom()
+	fromID, username, sender := a.forwardedAuthor(ctx, fwd)
+	from, _ := fwd.GetFromID()
+	fromKind := peerKind(from)
+	input, truncated := a.classifierInput(clean)
+
+	var b strings.Builder
+	b.WriteString("Разбор:")
+	for _, c := range a.live().Campaigns {
+		v, err := a.texts.Classify(ctx, c, input)
+		v.Relevant, err = a.ambiguousAs(c.Name, v.Relevant, err)
+		if err != nil {
+			fmt.Fprintf(&b, "\n%s: ошибка: %v", c.Name, err)
+			continue
+		}
+		answer := "нерелевантно"
+		if v.Relevant {
+			answer = "релевантно"
+		}
+		fmt.Fprintf(&b, "\n%s: %s (уверенность %.0f%%)", c.Name, answer, v.Confidence*100)
+		if !v.Relevant {
+			continue
+		}
+
+		lead := Lead{
+			Campaign:   c.Name,
+			Confidence: v.Confidence,
+			ChatID:     a.selfID.Load(),
+			MsgID:      msg.ID,
+			FromID:     fromID,
+			FromKind:   fromKind,
+			Username:   username,
+			Text:       text,
+			Truncated:  truncated,
+			Score:      scoreLead(sender, text),
+			Urgent:     a.isUrgent(clean),
+			Budget:     parseBudget(text),
+			Tags:       []string{"triage"},
+			SentAt:     time.Unix(int64(fwd.Date), 0),
+			CreatedAt:  time.Now(),
+		}
+		r := a.routeLead(ctx, c, lead)
+		switch {
+		case errors.Is(r.Held, ErrDropLead):
+			fmt.Fprintf(&b, " — отброшен: %s", strings.Join(r.Lead.Tags, ", "))
+		case r.Held != nil:
+			fmt.Fprintf(&b, " — лид #%d сохранён, не переслан: %s", r.Lead.ID, strings.Join(r.Lead.Tags, ", "))
+		case r.Forwarded:
+			fmt.Fprintf(&b, " — лид #%d переслан", r.Lead.ID)
+		case r.Saved:
+			fmt.Fprintf(&b, " — лид #%d сохранён", r.Lead.ID)
+		}
+	}
+	a.lg.Info("Triaged forwarded message", zap.Int("msg_id", msg.ID), zap.Int64("from_id", fromID))
+	return b.String()
+}
+
+// forwardedAuthor identifies the original author of a forwarded message
+// as far as the forward header and peer storage allow.
+func (a *App) forwardedAuthor(ctx context.Context, fwd tg.MessageFwdHeader) (int64, string, *tg.User) {
+	username := "unknown"
+	if name, ok := fwd.GetFromName(); ok {
+		username = name
+	}
+	from, ok := fwd.GetFromID()
+	if !ok {
+		return 0, username, nil
+	}
+	id := getChatID(from)
+	p, err := storage.FindPeer(ctx, a.peerDB, from)
+	if err != nil {
+		return id, username, nil
+	}
+	switch {
+	case p.User != nil && p.User.Username != "":
+		username = "@" + p.User.Username
+	case p.User == nil:
+		username = channelName(p)
+	}
+	return id, username, p.User
+}
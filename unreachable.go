@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/tgerr"
+	"go.uber.org/zap"
+)
+
+// errRecipientUnreachable reports that a recipient can never be sent to
+// again in this run, so the delivery must not be retried.
+var errRecipientUnreachable = errors.New("recipient unreachable")
+
+// isTerminalSendError reports whether a send failed because the recipient
+// blocked the account, deleted the chat or is gone, rather than for a
+// transient reason.
+func isTerminalSendError(err error) bool {
+	return tgerr.Is(err,
+		"USER_IS_BLOCKED", "YOU_BLOCKED_USER", "PEER_ID_INVALID",
+		"INPUT_USER_DEACTIVATED", "USER_DEACTIVATED_BAN", "CHAT_WRITE_FORBIDDEN",
+	)
+}
+
+func (a *App) isUnreachable(recipient string) bool {
+	a.unreachableMu.Lock()
+	defer a.unreachableMu.Unlock()
+	return a.unreachable[recipient]
+}
+
+// markUnreachable stops deliveries to recipient for the rest of the run
+// and raises a warning, once per recipient.
+func (a *App) markUnreachable(recipient string, cause error) {
+	a.unreachableMu.Lock()
+	already := a.unreachable[recipient]
+	a.unreachable[recipient] = true
+	a.unreachableMu.Unlock()
+	if already {
+		return
+	}
+
+	a.lg.Error("Recipient unreachable, not retrying", zap.String("recipient", recipient), zap.Error(cause))
+	text := fmt.Sprintf("Recipient %s is unreachable (%v): the account was blocked or the chat deleted", recipient, cause)
+	if a.cfg.FallbackRecipient != "" {
+		text += fmt.Sprintf("; leads go to %s instead", a.cfg.FallbackRecipient)
+	}
+	fmt.Fprintf(a.out, "WARNING: %s\n", text)
+	if a.cfg.AlertWebhook != "" {
+		if err := postAlert(a.cfg.AlertWebhook, "recipient_unreachable", text); err != nil {
+			a.lg.Error("Unreachable alert webhook", zap.Error(err))
+		}
+	}
+}
+
+// forwardFallback delivers a lead meant for an unreachable recipient to
+// FALLBACK_RECIPIENT, or returns errRecipientUnreachable without one.
+func (a *App) forwardFallback(ctx context.Context, lead Lead, recipient string) error {
+	fb := a.cfg.FallbackRecipient
+	if fb == "" || fb == recipient || a.isUnreachable(fb) {
+		return errors.Wrap(errRecipientUnreachable, recipient)
+	}
+	a.lg.Info("Lead redirected to fallback", zap.Uint64("lead_id", lead.ID), zap.String("recipient", recipient), zap.String("fallback", fb))
+	return a.forward(ctx, lead, fb)
+}
@@ -0,0 +1,27 @@
+package main
+
+import "strings"
+
+// isUrgent reports whether text contains one of the URGENT_KEYWORDS.
+func (a *App) isUrgent(text string) bool {
+	keywords := a.live().UrgentKeywords
+	if len(keywords) == 0 {
+		return false
+	}
+	lower := strings.ToLower(text)
+	for _, k := range keywords {
+		if strings.Contains(lower, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// leadRecipients returns where a lead goes: URGENT_RECIPIENT for urgent
+// leads when it is set, the campaign recipients otherwise.
+func (a *App) leadRecipients(c Campaign, lead Lead) []string {
+	if lead.Urgent && a.cfg.UrgentRecipient != "" {
+		return []string{a.cfg.UrgentRecipient}
+	}
+	return c.Recipients
+}
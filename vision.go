@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/telegram/downloader"
+	"github.com/gotd/td/tg"
+)
+
+// Captions shorter than this (in runes) are too thin to classify on their
+// own, so the attached photo is used instead.
+const visionCaptionMax = 20
+
+// largestPhotoSize picks the size with the highest resolution and reports
+// its type and byte size.
+func largestPhotoSize(photo *tg.Photo) (string, int, bool) {
+	var (
+		bestType  string
+		bestArea  int
+		bestBytes int
+	)
+	for _, s := range photo.Sizes {
+		var (
+			typ     string
+			w, h, n int
+		)
+		switch s := s.(type) {
+		case *tg.PhotoSize:
+			typ, w, h, n = s.Type, s.W, s.H, s.Size
+		case *tg.PhotoSizeProgressive:
+			if len(s.Sizes) == 0 {
+				continue
+			}
+			typ, w, h, n = s.Type, s.W, s.H, s.Sizes[len(s.Sizes)-1]
+		default:
+			continue
+		}
+		if w*h > bestArea {
+			bestType, bestArea, bestBytes = typ, w*h, n
+		}
+	}
+	return bestType, bestBytes, bestType != ""
+}
+
+// downloadPhoto returns the largest size of the message photo, or nil if
+// the message has none or it exceeds the configured cap.
+func (a *App) downloadPhoto(ctx context.Context, msg *tg.Message) ([]byte, error) {
+	media, ok := msg.Media.(*tg.MessageMediaPhoto)
+	if !ok {
+		return nil, nil
+	}
+	photo, ok := media.Photo.(*tg.Photo)
+	if !ok {
+		return nil, nil
+	}
+	sizeType, size, ok := largestPhotoSize(photo)
+	if !ok {
+		return nil, nil
+	}
+	if int64(size) > a.cfg.VisionMaxBytes {
+		return nil, nil
+	}
+
+	var buf bytes.Buffer
+	if _, err := downloader.NewDownloader().Download(a.api, &tg.InputPhotoFileLocation{
+		ID:            photo.ID,
+		AccessHash:    photo.AccessHash,
+		FileReference: photo.FileReference,
+		ThumbSize:     sizeType,
+	}).Stream(ctx, &buf); err != nil {
+		return nil, errors.Wrap(err, "download photo")
+	}
+	return buf.Bytes(), nil
+}
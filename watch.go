@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/go-faster/errors"
+	"github.com/gotd/td/tg"
+)
+
+// parseWatchSenders splits WATCH_SENDERS into user IDs and usernames.
+func parseWatchSenders(s string) (ids []int64, usernames []string, err error) {
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		if f == "" {
+			continue
+		}
+		if id, err := strconv.ParseInt(f, 10, 64); err == nil {
+			if id <= 0 {
+				return nil, nil, errors.Errorf("WATCH_SENDERS: %q is not a user ID", f)
+			}
+			ids = append(ids, id)
+			continue
+		}
+		if trimAt(f) == "" || strings.ContainsAny(f, " /") {
+			return nil, nil, errors.Errorf("WATCH_SENDERS: %q is neither a user ID nor a username", f)
+		}
+		usernames = append(usernames, f)
+	}
+	return ids, usernames, nil
+}
+
+// resolveWatchedSenders builds the WATCH_SENDERS set, resolving usernames
+// to user IDs. It returns nil when the setting is empty.
+func resolveWatchedSenders(ctx context.Context, api *tg.Client, cfg Config, out io.Writer) (map[int64]bool, error) {
+	if len(cfg.WatchSenderIDs) == 0 && len(cfg.WatchSenderNames) == 0 {
+		return nil, nil
+	}
+	watched := make(map[int64]bool, len(cfg.WatchSenderIDs)+len(cfg.WatchSenderNames))
+	for _, id := range cfg.WatchSenderIDs {
+		watched[id] = true
+	}
+	for _, name := range cfg.WatchSenderNames {
+		peer, err := resolveWithRetry(ctx, api, name, cfg.AdminResolveRetries, out)
+		var unknown *UnknownUsernameError
+		if errors.As(err, &unknown) {
+			unknown.Role = "WATCH_SENDERS"
+		}
+		if err != nil {
+			return nil, err
+		}
+		watched[peer.(*tg.InputPeerUser).UserID] = true
+	}
+	return watched, nil
+}
+
+// isWatchedSender reports whether msg passes WATCH_SENDERS: every message
+// does when it is unset. Channel posts are attributed to the channel.
+func (a *App) isWatchedSender(msg *tg.Message) bool {
+	if a.watched == nil {
+		return len(a.cfg.WatchSenderIDs) == 0 && len(a.cfg.WatchSenderNames) == 0
+	}
+	var id int64
+	switch {
+	case msg.Out:
+		id = a.selfID.Load()
+	case msg.Post:
+		id = getChatID(msg.PeerID)
+	default:
+		if fu, ok := msg.FromID.(*tg.PeerUser); ok {
+			id = fu.UserID
+		} else if pu, ok := msg.PeerID.(*tg.PeerUser); ok {
+			id = pu.UserID
+		}
+	}
+	return a.watched[id]
+}
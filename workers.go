@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+
+	"github.com/gotd/td/tg"
+	"go.uber.org/zap"
+)
+
+// QueueFull is what happens when the worker queue is full.
+type QueueFull string
+
+const (
+	// QueueFullBlock holds up the update handler until a worker frees a
+	// slot.
+	QueueFullBlock QueueFull = "block"
+	// QueueFullDropOldest discards the longest-waiting message to make
+	// room.
+	QueueFullDropOldest QueueFull = "drop-oldest"
+)
+
+// dispatchMessage hands a message to handleMessage: directly, or with
+// WORKERS (or ORDERED, a single worker) through the worker queue, so at
+// most that many messages are processed at once.
+func (a *App) dispatchMessage(ctx context.Context, msg *tg.Message) error {
+	if a.early != nil && a.early.Hold(msg) {
+		return nil
+	}
+	if a.work == nil {
+		return a.handleMessage(ctx, msg)
+	}
+	if a.cfg.QueueFull == QueueFullBlock {
+		select {
+		case a.work <- msg:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	for {
+		select {
+		case a.work <- msg:
+			return nil
+		default:
+		}
+		select {
+		case old := <-a.work:
+			a.stats.IncErrors()
+			a.lg.Warn("Worker queue full, dropped oldest message",
+				zap.Int64("chat_id", getChatID(old.GetPeerID())),
+				zap.Int("msg_id", old.ID),
+			)
+		default:
+		}
+	}
+}
+
+// runWorkers starts the WORKERS goroutines. They use the run context
+// rather than the update's, which ends once the message is queued.
+func (a *App) runWorkers(ctx context.Context) {
+	for i := 0; i < a.cfg.Workers; i++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case msg := <-a.work:
+					if err := a.handleMessage(ctx, msg); err != nil {
+						a.lg.Error("Handle message", zap.Int("msg_id", msg.ID), zap.Error(err))
+					}
+				}
+			}
+		}()
+	}
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gotd/td/tg"
+)
+
+// startWorkers gives a the worker queue New would build for cfg and runs
+// the workers until the test ends.
+func startWorkers(t *testing.T, a *App) {
+	t.Helper()
+	a.work = make(chan *tg.Message, a.cfg.QueueSize)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	a.runWorkers(ctx)
+}
+
+// waitStats polls the stats until done reports true or a deadline passes.
+func waitStats(t *testing.T, a *App, done func(StatsSnapshot) bool) StatsSnapshot {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		s := a.stats.Snapshot()
+		if done(s) {
+			return s
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out, stats %+v", s)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// TestWorkersConcurrent feeds many messages at once through the worker
+// pool; run it with -race. Every message must end up as exactly one lead.
+func TestWorkersConcurrent(t *testing.T) {
+	const senders, perSender = 20, 25
+	for _, tt := range []struct {
+		name    string
+		workers int
+	}{
+		{name: "Ordered", workers: 1},
+		{name: "Pool", workers: 8},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.Workers, cfg.QueueSize, cfg.QueueFull = tt.workers, 16, QueueFullBlock
+			f := &fakeCompleter{resp: answer("true")}
+			a := newTestApp(t, cfg, OpenAIClassifier{client: f, model: textModel})
+			startWorkers(t, a)
+			ctx := context.Background()
+
+			var wg sync.WaitGroup
+			for s := 0; s < senders; s++ {
+				wg.Add(1)
+				go func(s int) {
+					defer wg.Done()
+					for i := 0; i < perSender; i++ {
+						id := s*perSender + i + 1
+						if err := a.dispatchMessage(ctx, groupMessage(int64(100+s%4), int64(1000+id), id, benchText)); err != nil {
+							t.Error(err)
+							return
+						}
+					}
+				}(s)
+			}
+			wg.Wait()
+
+			const total = senders * perSender
+			st := waitStats(t, a, func(s StatsSnapshot) bool { return s.Leads >= total })
+			if st.Messages != total || st.Leads != total || st.Errors != 0 {
+				t.Errorf("stats = %+v, want %d messages and leads", st, total)
+			}
+			if n := f.Calls(); n != total {
+				t.Errorf("classifier called %d times, want %d", n, total)
+			}
+			leads, err := a.leads.List(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids := make(map[int]bool, len(leads))
+			for _, l := range leads {
+				if ids[l.MsgID] {
+					t.Errorf("message %d stored twice", l.MsgID)
+				}
+				ids[l.MsgID] = true
+			}
+			if len(ids) != total {
+				t.Errorf("got %d distinct leads, want %d", len(ids), total)
+			}
+		})
+	}
+}
+
+// TestWorkersOrdered checks that ORDERED handles messages in the order
+// they were dispatched.
+func TestWorkersOrdered(t *testing.T) {
+	cfg := testConfig()
+	cfg.Workers, cfg.QueueSize, cfg.QueueFull = 1, 4, QueueFullBlock
+	a := newTestApp(t, cfg, OpenAIClassifier{client: &fakeCompleter{resp: answer("true")}, model: textModel})
+	startWorkers(t, a)
+	ctx := context.Background()
+
+	const total = 100
+	for id := 1; id <= total; id++ {
+		if err := a.dispatchMessage(ctx, groupMessage(100, int64(1000+id), id, benchText)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitStats(t, a, func(s StatsSnapshot) bool { return s.Leads >= total })
+	leads, err := a.leads.List(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, l := range leads {
+		if l.MsgID != i+1 {
+			t.Fatalf("lead %d is message %d, want %d", l.ID, l.MsgID, i+1)
+		}
+	}
+}
+
+// gatedClassifier holds every classification until gate is closed.
+type gatedClassifier struct {
+	gate chan struct{}
+}
+
+func (g gatedClassifier) Classify(ctx context.Context, _ Campaign, _ string) (verdict, error) {
+	select {
+	case <-g.gate:
+		return verdict{}, nil
+	case <-ctx.Done():
+		return verdict{}, ctx.Err()
+	}
+}
+
+// TestWorkersLoad floods a stalled pool. With QUEUE_FULL=drop-oldest the
+// update handler never blocks, and every message is either handled or
+// counted as dropped once the workers catch up.
+func TestWorkersLoad(t *testing.T) {
+	cfg := testConfig()
+	cfg.Workers, cfg.QueueSize, cfg.QueueFull = 4, 8, QueueFullDropOldest
+	gate := make(chan struct{})
+	a := newTestApp(t, cfg, gatedClassifier{gate: gate})
+	startWorkers(t, a)
+	ctx := context.Background()
+
+	const producers, perProducer = 10, 100
+	dispatched := make(chan struct{})
+	go func() {
+		defer close(dispatched)
+		var wg sync.WaitGroup
+		for p := 0; p < producers; p++ {
+			wg.Add(1)
+			go func(p int) {
+				defer wg.Done()
+				for i := 0; i < perProducer; i++ {
+					id := p*perProducer + i + 1
+					if err := a.dispatchMessage(ctx, groupMessage(100, int64(1000+id), id, benchText)); err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			}(p)
+		}
+		wg.Wait()
+	}()
+	select {
+	case <-dispatched:
+	case <-time.After(10 * time.Second):
+		t.Fatal("dispatch blocked on a full queue")
+	}
+	close(gate)
+
+	const total = producers * perProducer
+	st := waitStats(t, a, func(s StatsSnapshot) bool { return s.Messages+s.Errors >= total })
+	if st.Messages+st.Errors != total {
+		t.Errorf("handled %d + dropped %d, want %d in all", st.Messages, st.Errors, total)
+	}
+	if st.Errors == 0 {
+		t.Error("no message dropped from a full queue")
+	}
+	if st.Messages < int64(cfg.QueueSize) {
+		t.Errorf("handled only %d messages", st.Messages)
+	}
+}